@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/aks-deployer/pkg/syncer"
+)
+
+// runBundle builds the bundle of a cluster for the bundle configuration source
+// of the syncer, signed with --signing-key as <output>.sig
+func runBundle(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	source := addSourceFlags(fs)
+	clusterName := fs.String("cluster", "", "name of the cluster")
+	region := fs.String("region", "", "region of the cluster, selects the region layer, required when the cluster container has region layers")
+	environment := fs.String("environment", "", "environment of the cluster, selects the environment layer")
+	toggleURL := fs.String("toggle-url", "", "toggle URL")
+	output := fs.String("output", "", "path of the bundle")
+	signingKey := fs.String("signing-key", "", "PEM file of the ed25519 or ECDSA private key signing the bundle")
+	publicKeys := fs.String("signature-public-keys", "",
+		"PEM file of the public keys verifying the <blob>.sig signatures of the blobs bundled")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *clusterName == "" || *environment == "" || *output == "" {
+		return fmt.Errorf("--cluster, --environment and --output must be set")
+	}
+
+	configSource, err := source.configSource()
+	if err != nil {
+		return err
+	}
+	opt := syncer.Options{
+		ToggleURL:   *toggleURL,
+		Region:      *region,
+		Environment: *environment,
+		CallTimeout: syncer.DefaultCallTimeout,
+	}
+	if *publicKeys != "" {
+		data, err := ioutil.ReadFile(*publicKeys)
+		if err != nil {
+			return err
+		}
+		if opt.PublicKeys, err = syncer.ParsePublicKeys(data); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = syncer.WriteBundle(ctx, configSource, *clusterName, opt, f, logger); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	logger.Infof("Bundle of cluster %s written to %s", *clusterName, *output)
+
+	if *signingKey == "" {
+		return nil
+	}
+	keyData, err := ioutil.ReadFile(*signingKey)
+	if err != nil {
+		return err
+	}
+	key, err := syncer.ParsePrivateKey(keyData)
+	if err != nil {
+		return err
+	}
+	bundle, err := ioutil.ReadFile(*output)
+	if err != nil {
+		return err
+	}
+	signature, err := syncer.Sign(key, bundle)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*output+".sig", []byte(signature+"\n"), 0644)
+}
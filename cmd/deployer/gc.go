@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Azure/aks-deployer/pkg/syncer"
+)
+
+// runGC removes the aksapp versions of the storage account which are neither
+// referenced by a cluster folder nor among the most recent ones of their type,
+// the versions removed are printed to stdout
+func runGC(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	storageAccountName := fs.String("storage-account", os.Getenv("AZURE_STORAGE_ACCOUNT"), "name of the storage account")
+	retain := fs.Int("retain", syncer.DefaultGCRetainVersions, "number of the most recent versions of each aksapp type to keep, on top of the versions "+
+		"the cluster container references. Clusters running a version no longer referenced lose it "+
+		"once it falls outside of them")
+	dryRun := fs.Bool("dry-run", false, "only print the versions which would be removed")
+	softDelete := fs.Bool("soft-delete", false, "move the blobs to the aksapp-deleted container instead of deleting them")
+	toggles := fs.String("toggles", "", "toggle document of the syncers, the versions it sets are kept")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *storageAccountName == "" {
+		return fmt.Errorf("--storage-account or AZURE_STORAGE_ACCOUNT must be set")
+	}
+
+	options := syncer.VersionGCOptions{
+		RetainVersions: *retain,
+		DryRun:         *dryRun,
+		SoftDelete:     *softDelete,
+	}
+	if *toggles != "" {
+		data, err := ioutil.ReadFile(*toggles)
+		if err != nil {
+			return err
+		}
+		if options.Toggles, err = syncer.ParseToggleDocument(data); err != nil {
+			return err
+		}
+	}
+
+	publisher, err := newPublisher(*storageAccountName)
+	if err != nil {
+		return err
+	}
+	removed, err := publisher.CollectVersions(ctx, options)
+	if err != nil {
+		return err
+	}
+
+	action := "removed"
+	if *dryRun {
+		action = "would remove"
+	}
+	for _, version := range removed {
+		fmt.Printf("%s %s %s: %s\n", action, version.AppType, version.Version, strings.Join(version.Blobs, " "))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// deployer manages the configurations of the storage account the syncer reads
+// from. Each operation is a subcommand:
+//
+//	deployer bundle --cluster <name> --environment <env> --output <path>
+//	deployer publish --cluster-folder <folder> --dir <path>
+//	deployer publish --app-type <type> --app-version <version> --file <path>
+//	deployer gc --retain <count> [--dry-run] [--soft-delete]
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Azure/aks-deployer/pkg/log"
+	"github.com/Azure/aks-deployer/pkg/version"
+)
+
+// command is a subcommand of deployer
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var (
+	logger *logrus.Entry
+
+	commands = []command{
+		{
+			name:  "bundle",
+			usage: "build the offline bundle of a cluster",
+			run:   runBundle,
+		},
+		{
+			name:  "publish",
+			usage: "validate and upload cluster and aksapp configurations",
+			run:   runPublish,
+		},
+		{
+			name:  "gc",
+			usage: "remove the aksapp versions no longer referenced",
+			run:   runGC,
+		},
+	}
+)
+
+func init() {
+	logger = log.New("deployer", version.String()).WithField("source", "Deployer")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(ctx, os.Args[2:]); err != nil {
+			logger.Fatalf("%s failed: %s", c.name, err.Error())
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
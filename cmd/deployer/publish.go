@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+	"github.com/Azure/aks-deployer/pkg/syncer"
+)
+
+const (
+	identityResourceIDStr    = "IDENTITY_RESOURCE_ID"
+	storageEndpointSuffixStr = "STORAGE_ENDPOINT_SUFFIX"
+
+	defaultStorageEndpointSuffix = "core.windows.net"
+)
+
+// runPublish validates and uploads either the files of a cluster folder or
+// the configuration of an aksapp version to the storage account, with the
+// managed identity IDENTITY_RESOURCE_ID
+func runPublish(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	storageAccountName := fs.String("storage-account", os.Getenv("AZURE_STORAGE_ACCOUNT"), "name of the storage account")
+	clusterFolder := fs.String("cluster-folder", "",
+		"folder of the cluster container to publish --dir to, a cluster name, _global, _env/<env> or _region/<region>")
+	appType := fs.String("app-type", "", "type of the aksapp to publish")
+	appVersion := fs.String("app-version", "", "version of the aksapp to publish")
+	file := fs.String("file", "", "configuration file of the aksapp version")
+	dir := fs.String("dir", "", "directory of the configuration files to publish")
+	signingKey := fs.String("signing-key", "",
+		"PEM file of the ed25519 or ECDSA private key signing the blobs as <blob>.sig")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *storageAccountName == "" {
+		return fmt.Errorf("--storage-account or AZURE_STORAGE_ACCOUNT must be set")
+	}
+	if (*clusterFolder == "") == (*appType == "") {
+		return fmt.Errorf("exactly one of --cluster-folder and --app-type must be set")
+	}
+	if (*file == "") == (*dir == "") {
+		return fmt.Errorf("exactly one of --file and --dir must be set")
+	}
+
+	publisher, err := newPublisher(*storageAccountName)
+	if err != nil {
+		return err
+	}
+	if *signingKey != "" {
+		data, err := ioutil.ReadFile(*signingKey)
+		if err != nil {
+			return err
+		}
+		key, err := syncer.ParsePrivateKey(data)
+		if err != nil {
+			return err
+		}
+		publisher.SetSigningKey(key)
+	}
+
+	if *file != "" {
+		if *clusterFolder != "" {
+			return fmt.Errorf("--dir must be set to publish a cluster folder")
+		}
+		if *appVersion == "" {
+			return fmt.Errorf("--app-version must be set")
+		}
+		content, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		return publisher.PublishAksApp(ctx, *appType, *appVersion, string(content))
+	}
+
+	files, err := readFiles(*dir)
+	if err != nil {
+		return err
+	}
+	if *clusterFolder != "" {
+		return publisher.PublishClusterFolder(ctx, *clusterFolder, files)
+	}
+	if *appVersion == "" {
+		return fmt.Errorf("--app-version must be set")
+	}
+	return publisher.PublishAksAppFolder(ctx, *appType, *appVersion, files)
+}
+
+// newPublisher returns a Publisher of the storage account authenticating with
+// the managed identity IDENTITY_RESOURCE_ID
+func newPublisher(storageAccountName string) (*syncer.Publisher, error) {
+	blobClient, err := blobclient.NewMsiBlobProviderWithMiResourceID(os.Getenv(identityResourceIDStr))
+	if err != nil {
+		return nil, err
+	}
+	storageEndpointSuffix := defaultStorageEndpointSuffix
+	if os.Getenv(storageEndpointSuffixStr) != "" {
+		storageEndpointSuffix = os.Getenv(storageEndpointSuffixStr)
+	}
+	return syncer.NewPublisher(blobClient, storageAccountName, storageEndpointSuffix, logger), nil
+}
+
+// readFiles returns the content of the files under a directory by their slash
+// separated path relative to it
+func readFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	return files, err
+}
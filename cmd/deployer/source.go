@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+
+	"github.com/Azure/aks-deployer/pkg/syncer"
+)
+
+const (
+	sourceStorageClient = "storageclient"
+	sourceLocal         = "local"
+)
+
+// sourceFlags select the storage account or local directory a command works on
+type sourceFlags struct {
+	source string
+	path   string
+}
+
+func addSourceFlags(fs *flag.FlagSet) *sourceFlags {
+	f := &sourceFlags{}
+	fs.StringVar(&f.source, "source", sourceStorageClient,
+		"configuration source: storageclient (AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_ACCESS_KEY) or local")
+	fs.StringVar(&f.path, "source-path", "", "root directory of the local configuration source")
+	return f
+}
+
+// newStorageClient returns the client of the storage account set in the environment
+func newStorageClient() (storage.Client, error) {
+	storageAccountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	storageAccessKey := os.Getenv("AZURE_STORAGE_ACCESS_KEY")
+	if storageAccountName == "" || storageAccessKey == "" {
+		return storage.Client{}, fmt.Errorf("Azure storage credential environment variables not set")
+	}
+	return storage.NewBasicClient(storageAccountName, storageAccessKey)
+}
+
+func (f *sourceFlags) configSource() (syncer.ConfigSource, error) {
+	switch f.source {
+	case sourceLocal:
+		if f.path == "" {
+			return nil, fmt.Errorf("--source-path must be set for the local configuration source")
+		}
+		return syncer.NewLocalSource(f.path, logger), nil
+	case sourceStorageClient:
+		storageClient, err := newStorageClient()
+		if err != nil {
+			return nil, err
+		}
+		return syncer.NewStorageClientSource(storageClient, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown configuration source %q", f.source)
+	}
+}
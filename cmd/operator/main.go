@@ -42,12 +42,23 @@ var (
 	reconcileSyncPeriod = time.Hour
 
 	useOwnerReference = false
+
+	useServerSideApply = false
+	forceConflicts     = false
+
+	deletionPolicy = string(deployerv1.DeletionPolicyDelete)
 )
 
 func init() {
 	flag.StringVar(&namespace, "namespace", configmaps.DefaultDeployerNamespace, "namespace")
 	flag.StringVar(&metricsPort, "listen", ":8080", "metrics port")
 	flag.BoolVar(&useOwnerReference, "ownerreference", false, "use ownerreference")
+	flag.BoolVar(&useServerSideApply, "server-side-apply", false,
+		"apply objects with server-side apply under the aks-deployer field manager")
+	flag.BoolVar(&forceConflicts, "force-conflicts", false,
+		"take over the fields managed by others on server-side apply conflicts instead of failing")
+	flag.StringVar(&deletionPolicy, "deletion-policy", deletionPolicy,
+		"what happens to the objects of a deleted aksapp without ownerreference, Delete or Orphan")
 
 	// logger setup
 	// note: source field is used in fluentd to match rules and add tags
@@ -79,6 +90,18 @@ func main() {
 
 	aksAppReconciler := controllers.NewAksAppReconciler(mgr.GetClient(),
 	logger.WithField("controller", "AksApp"), mgr.GetScheme(), namespace, useOwnerReference)
+	switch deployerv1.DeletionPolicy(deletionPolicy) {
+	case deployerv1.DeletionPolicyDelete, deployerv1.DeletionPolicyOrphan:
+		aksAppReconciler.DeletionPolicy = deployerv1.DeletionPolicy(deletionPolicy)
+	default:
+		logger.Errorf("invalid deletion policy %q", deletionPolicy)
+		os.Exit(1)
+	}
+	if useServerSideApply {
+		logger.Infof("Use server-side apply to apply objects, force conflicts: %t", forceConflicts)
+		aksAppReconciler.UseServerSideApply = true
+		aksAppReconciler.ForceConflicts = forceConflicts
+	}
 
 	if err = aksAppReconciler.SetupWithManager(mgr); err != nil {
 		logger.Errorf("unable to create AksApp controller, %v", err.Error())
@@ -106,7 +129,8 @@ func main() {
 		// +kubebuilder:scaffold:builder
 
 		logger.Info("starting manager")
-		if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		// Stop the manager on SIGTERM or when the lease is lost
+		if err := mgr.Start(ctx.Done()); err != nil {
 			logger.Errorf("problem running manager, %s", err.Error())
 			os.Exit(1)
 		}
@@ -2,29 +2,51 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
-	"github.com/Azure/aks-deployer/pkg/version"
 	"github.com/Azure/aks-deployer/pkg/configmaps"
 	"github.com/Azure/aks-deployer/pkg/leader"
 	"github.com/Azure/aks-deployer/pkg/log"
-	"github.com/Azure/aks-deployer/pkg/signals"
+	"github.com/Azure/aks-deployer/pkg/panics"
 	"github.com/Azure/aks-deployer/pkg/syncer"
+	"github.com/Azure/aks-deployer/pkg/version"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
 var (
-	toggleURLFlag string
-	namespace     string
-	logger        *logrus.Entry
+	toggleURLFlag    string
+	region           string
+	environment      string
+	namespace        string
+	configSourceFlag string
+	configSourcePath string
+	configSourceURL  string
+	metricsPort      string
+	maxSyncFailures  int
+	gcGracePeriod    time.Duration
+	gcRetainVersions int
+	webhookPort      string
+	webhookDebounce  time.Duration
+	webhookTokenPath string
+	callTimeout      time.Duration
+	driftInterval    time.Duration
+	publicKeysPath   string
+	allowOverwrite   bool
+	logger           *logrus.Entry
 
 	useIdentityResourceID = false
 	storageEndpointSuffix = "core.windows.net"
@@ -34,24 +56,61 @@ const (
 	syncTimeInterval         = 5 * time.Minute
 	identityResourceIDStr    = "IDENTITY_RESOURCE_ID"
 	storageEndpointSuffixStr = "STORAGE_ENDPOINT_SUFFIX"
+	storageAccountsStr       = "AZURE_STORAGE_ACCOUNTS"
+	regionStr                = "REGION"
+
+	// configuration sources
+	configSourceAuto          = ""
+	configSourceBlobClient    = "blobclient"
+	configSourceStorageClient = "storageclient"
+	configSourceLocal         = "local"
+	configSourceHTTP          = "http"
+	configSourceBundle        = "bundle"
 )
 
 func init() {
 	flag.StringVar(&toggleURLFlag, "toggle-url", "", "toggle URL")
+	flag.StringVar(&region, "region", os.Getenv(regionStr),
+		"region of the cluster, selects the region layer and toggle rules, REGION by default")
+	flag.StringVar(&environment, "environment", "",
+		"environment of the cluster, selects the environment layer and toggle rules, DEPLOY_ENV when empty")
 	flag.StringVar(&namespace, "namespace", configmaps.DefaultDeployerNamespace, "namespace")
+	flag.StringVar(&configSourceFlag, "config-source", configSourceAuto,
+		"configuration source: blobclient, storageclient, local, http or bundle (default: blobclient with identity resource ID, storageclient otherwise)")
+	flag.StringVar(&configSourcePath, "config-source-path", "",
+		"root directory of the local configuration source or tarball of the bundle configuration source")
+	flag.StringVar(&configSourceURL, "config-source-url", "", "base URL of the http configuration source")
+	flag.StringVar(&metricsPort, "listen", ":8080", "metrics port")
+	flag.DurationVar(&gcGracePeriod, "gc-grace-period", syncer.DefaultGCGracePeriod,
+		"how long the ConfigMaps of an obsolete aksapp version are kept")
+	flag.IntVar(&gcRetainVersions, "gc-retain-versions", syncer.DefaultGCRetainVersions,
+		"number of obsolete versions of an aksapp type kept for rollbacks")
+	flag.StringVar(&webhookPort, "webhook-listen", "", "Event Grid webhook port, the webhook is disabled when empty")
+	flag.DurationVar(&webhookDebounce, "webhook-debounce", 10*time.Second,
+		"how long to wait after the first blob event of a burst before syncing")
+	flag.StringVar(&webhookTokenPath, "webhook-token-file", "",
+		"file of the shared secret Event Grid passes as the token query parameter, required with --webhook-listen")
+	flag.DurationVar(&callTimeout, "call-timeout", syncer.DefaultCallTimeout,
+		"timeout of each call to the configuration source and the API server")
+	flag.DurationVar(&driftInterval, "drift-check-interval", time.Hour,
+		"how often the blobs synced are compared with every storage account of AZURE_STORAGE_ACCOUNTS, disabled when 0")
+	flag.IntVar(&maxSyncFailures, "max-sync-failures", 3, "number of consecutive failed syncs after which /healthz reports unhealthy")
+	flag.BoolVar(&allowOverwrite, "allow-version-overwrite", false,
+		"allow the content of an aksapp version to change once written and reconcile the aksapps using it")
+	flag.StringVar(&publicKeysPath, "signature-public-keys", "",
+		"PEM file of the ed25519 or ECDSA public keys verifying the <blob>.sig signatures, signatures are not verified when empty")
 
 	// logger setup
 	// note: source field is used in fluentd to match rules and add tags
 	logger = log.New("syncer", version.String()).WithField("source", "Deployer")
+}
 
+// checkStorageEnv validates the environment variables of the Azure Storage sources
+func checkStorageEnv() {
 	if os.Getenv("AZURE_STORAGE_ACCOUNT") == "" {
 		logger.Fatal("Azure storage account environment variables not set, exiting...")
 	}
 
-	if os.Getenv("CLUSTER_NAME") == "" {
-		logger.Fatal("CLUSTER_NAME not set, exiting...")
-	}
-
 	if os.Getenv(identityResourceIDStr) != "" {
 		// Use identity resource ID if existed, otherwise fall back to use access key
 		useIdentityResourceID = true
@@ -69,8 +128,9 @@ func init() {
 func main() {
 	flag.Parse()
 
-	// set up signals so we handle the first shutdown signal gracefully
-	stopCh := signals.SetupSignalHandler()
+	if os.Getenv("CLUSTER_NAME") == "" {
+		logger.Fatal("CLUSTER_NAME not set, exiting...")
+	}
 
 	// get the inClusterConfig
 	cfg, err := clientcmd.BuildConfigFromFlags("", "")
@@ -85,48 +145,220 @@ func main() {
 
 	clusterName := os.Getenv("CLUSTER_NAME")
 
-	var s *syncer.Syncer
-	if useIdentityResourceID {
-		storageAccountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
-		logger.Infof("Use identity resource ID to access storage account %s", storageAccountName)
-
-		blobClient, err := blobclient.NewMsiBlobProviderWithMiResourceID(os.Getenv(identityResourceIDStr))
+	opt := syncer.Options{
+		ToggleURL:             toggleURLFlag,
+		Namespace:             namespace,
+		Region:                region,
+		Environment:           environment,
+		GCGracePeriod:         gcGracePeriod,
+		GCRetainVersions:      gcRetainVersions,
+		CallTimeout:           callTimeout,
+		AllowVersionOverwrite: allowOverwrite,
+	}
+	if publicKeysPath != "" {
+		data, err := ioutil.ReadFile(publicKeysPath)
 		if err != nil {
-			logger.Fatalf("Error creating blob client, %s", err.Error())
+			logger.Fatalf("Error reading public keys: %s", err.Error())
 		}
-		s = syncer.NewSyncerWithBlobClient(
-			kubeClient, blobClient, storageAccountName, storageEndpointSuffix, clusterName, logger)
-	} else {
-		storageAccountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
-		storageAccessKey := os.Getenv("AZURE_STORAGE_ACCESS_KEY")
-
-		storageClient, err := storage.NewBasicClient(storageAccountName, storageAccessKey)
+		opt.PublicKeys, err = syncer.ParsePublicKeys(data)
 		if err != nil {
-			logger.Fatalf("Error creating storage client: %s", err.Error())
+			logger.Fatalf("Error parsing public keys: %s", err.Error())
 		}
-
-		s = syncer.NewSyncer(kubeClient, storageClient, clusterName, logger)
+		logger.Infof("Verify blob signatures with %d public keys", len(opt.PublicKeys))
 	}
 
-	opt := syncer.Options{
-		ToggleURL: toggleURLFlag,
-		Namespace: namespace,
-	}
+	s := syncer.NewSyncerWithConfigSource(kubeClient, newConfigSource(opt), clusterName, logger)
 	s.SetOptions(opt)
 
+	go serveMetrics(s, logger)
+
+	// Blob events trigger syncs in between the polls when the webhook is enabled
+	var triggers <-chan struct{}
+	if webhookPort != "" {
+		if webhookTokenPath == "" {
+			logger.Fatal("--webhook-token-file must be set with --webhook-listen")
+		}
+		data, err := ioutil.ReadFile(webhookTokenPath)
+		if err != nil {
+			logger.Fatalf("Error reading webhook token: %s", err.Error())
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			logger.Fatalf("Webhook token file %s is empty", webhookTokenPath)
+		}
+		receiver := syncer.NewEventReceiver(s, webhookDebounce, token, logger)
+		triggers = receiver.Triggers()
+		go serveWebhook(receiver, logger)
+	}
+
 	run := func(ctx context.Context) {
-		s.Run()
+		sync := func() {
+			if err := s.Run(ctx); err != nil {
+				logger.Errorf("Failed to sync, retry in %s: %s", syncTimeInterval, err.Error())
+			}
+		}
+		sync()
+
+		// Comparing the replicas downloads every blob from each of them, it
+		// runs far less often than the syncs
+		var driftChecks <-chan time.Time
+		if driftInterval > 0 {
+			ticker := time.NewTicker(driftInterval)
+			defer ticker.Stop()
+			driftChecks = ticker.C
+		}
 
 		for {
 			select {
 			case <-time.After(syncTimeInterval):
-				s.Run()
-			case <-stopCh:
+				sync()
+			case <-triggers:
+				logger.Info("Sync triggered by blob events")
+				sync()
+			case <-driftChecks:
+				s.CheckDrift(ctx)
+			case <-ctx.Done():
+				// SIGTERM or the lease is lost, the current sync has finished or aborted
 				logger.Info("Shutting down...")
-				os.Exit(0)
+				return
 			}
 		}
 	}
 
 	leader.RunWithLeaderElection(run, logger, namespace, "syncer")
 }
+
+func newConfigSource(opt syncer.Options) syncer.ConfigSource {
+	switch configSourceFlag {
+	case configSourceLocal:
+		if configSourcePath == "" {
+			logger.Fatal("--config-source-path must be set for the local configuration source, exiting...")
+		}
+		return syncer.NewLocalSource(configSourcePath, logger)
+	case configSourceHTTP:
+		if configSourceURL == "" {
+			logger.Fatal("--config-source-url must be set for the http configuration source, exiting...")
+		}
+		return syncer.NewHTTPSource(configSourceURL, logger)
+	case configSourceBundle:
+		if configSourcePath == "" {
+			logger.Fatal("--config-source-path must be set for the bundle configuration source, exiting...")
+		}
+		// The bundle is signed as a whole with the keys verifying the blobs
+		return syncer.NewBundleSource(configSourcePath, opt.PublicKeys, logger)
+	case configSourceAuto, configSourceBlobClient, configSourceStorageClient:
+	default:
+		logger.Fatalf("Unknown configuration source %q, exiting...", configSourceFlag)
+	}
+
+	if os.Getenv(storageAccountsStr) != "" && configSourceFlag != configSourceStorageClient {
+		return newFailoverSource(os.Getenv(storageAccountsStr))
+	}
+
+	checkStorageEnv()
+	storageAccountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
+
+	if configSourceFlag == configSourceBlobClient && !useIdentityResourceID {
+		logger.Fatalf("%s must be set for the blob client configuration source, exiting...", identityResourceIDStr)
+	}
+	if configSourceFlag == configSourceStorageClient && os.Getenv("AZURE_STORAGE_ACCESS_KEY") == "" {
+		logger.Fatal("Azure storage credential environment variables not set, exiting...")
+	}
+
+	if configSourceFlag == configSourceBlobClient ||
+		(configSourceFlag == configSourceAuto && useIdentityResourceID) {
+		logger.Infof("Use identity resource ID to access storage account %s", storageAccountName)
+
+		blobClient, err := blobclient.NewMsiBlobProviderWithMiResourceID(os.Getenv(identityResourceIDStr))
+		if err != nil {
+			logger.Fatalf("Error creating blob client, %s", err.Error())
+		}
+		return syncer.NewBlobClientSource(blobClient, storageAccountName, storageEndpointSuffix, logger)
+	}
+
+	storageAccessKey := os.Getenv("AZURE_STORAGE_ACCESS_KEY")
+	storageClient, err := storage.NewBasicClient(storageAccountName, storageAccessKey)
+	if err != nil {
+		logger.Fatalf("Error creating storage client: %s", err.Error())
+	}
+	return syncer.NewStorageClientSource(storageClient, logger)
+}
+
+// storageAccount is a replica of the configurations in AZURE_STORAGE_ACCOUNTS,
+// the endpoint suffix and identity default to STORAGE_ENDPOINT_SUFFIX and
+// IDENTITY_RESOURCE_ID
+type storageAccount struct {
+	Name               string `json:"name"`
+	EndpointSuffix     string `json:"endpointSuffix,omitempty"`
+	IdentityResourceID string `json:"identityResourceID,omitempty"`
+}
+
+// newFailoverSource returns the blob client source failing over across the
+// storage accounts of the JSON list, in order
+func newFailoverSource(data string) syncer.ConfigSource {
+	var accounts []storageAccount
+	if err := json.Unmarshal([]byte(data), &accounts); err != nil {
+		logger.Fatalf("Error parsing %s: %s", storageAccountsStr, err.Error())
+	}
+	if len(accounts) == 0 {
+		logger.Fatalf("%s has no storage account, exiting...", storageAccountsStr)
+	}
+
+	var sources []syncer.ConfigSource
+	for _, account := range accounts {
+		if account.Name == "" {
+			logger.Fatalf("%s has a storage account without name, exiting...", storageAccountsStr)
+		}
+		endpointSuffix := account.EndpointSuffix
+		if endpointSuffix == "" {
+			endpointSuffix = storageEndpointSuffix
+			if os.Getenv(storageEndpointSuffixStr) != "" {
+				endpointSuffix = os.Getenv(storageEndpointSuffixStr)
+			}
+		}
+		identityResourceID := account.IdentityResourceID
+		if identityResourceID == "" {
+			identityResourceID = os.Getenv(identityResourceIDStr)
+		}
+
+		blobClient, err := blobclient.NewMsiBlobProviderWithMiResourceID(identityResourceID)
+		if err != nil {
+			logger.Fatalf("Error creating blob client of storage account %s, %s", account.Name, err.Error())
+		}
+		logger.Infof("Use storage account %s (%s) as replica %d", account.Name, endpointSuffix, len(sources))
+		sources = append(sources, syncer.NewBlobClientSource(blobClient, account.Name, endpointSuffix, logger))
+	}
+	return syncer.NewFailoverSource(sources, logger)
+}
+
+func serveMetrics(s *syncer.Syncer, logger *logrus.Entry) {
+	http.Handle("/healthz", panics.HttpHandler("healthz", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failures := s.ConsecutiveFailures(); failures >= maxSyncFailures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if _, err := w.Write([]byte(fmt.Sprintf("%d consecutive syncs failed", failures))); err != nil {
+				logger.Errorf("Failed to write healthz response, %s", err.Error())
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("OK")); err != nil {
+			logger.Errorf("Failed to write healthz response, %s", err.Error())
+		}
+	})))
+
+	http.Handle("/metrics", panics.HttpHandler("metrics", promhttp.Handler()))
+	if err := http.ListenAndServe(metricsPort, nil); err != nil {
+		logger.Errorf("problem running metrics server, %s", err.Error())
+		os.Exit(1)
+	}
+}
+
+func serveWebhook(receiver *syncer.EventReceiver, logger *logrus.Entry) {
+	mux := http.NewServeMux()
+	mux.Handle("/", panics.HttpHandler("webhook", receiver))
+	if err := http.ListenAndServe(webhookPort, mux); err != nil {
+		logger.Errorf("problem running webhook server, %s", err.Error())
+		os.Exit(1)
+	}
+}
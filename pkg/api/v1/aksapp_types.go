@@ -10,6 +10,21 @@ import (
 const (
 	// AksAppKindStr is AksApp Kind
 	AksAppKindStr = "AksApp"
+	// VersionConstraintAnnotationKey is the version constraint or channel the
+	// version of an AksApp was resolved from
+	VersionConstraintAnnotationKey = "deployer.aks.io/version-constraint"
+	// PruneAnnotationKey set to "false" on an object keeps it when it is removed
+	// from the configuration of its AksApp
+	PruneAnnotationKey = "deployer.aks.io/prune"
+	// DeletionPolicyAnnotationKey overrides the deletion policy of the objects
+	// of an AksApp when it is deleted, see DeletionPolicy
+	DeletionPolicyAnnotationKey = "deployer.aks.io/deletion-policy"
+	// RolloutTimeoutAnnotationKey is the duration, e.g. "15m", after which a
+	// rollout of an AksApp which is not complete is failed
+	RolloutTimeoutAnnotationKey = "deployer.aks.io/rollout-timeout"
+	// ConfigDigestAnnotationKey is the digest of the configuration of an AksApp
+	// whose version was overwritten, a new digest forces a reconcile
+	ConfigDigestAnnotationKey = "deployer.aks.io/config-sha256"
 )
 
 // AksAppSpec defines the desired state of AksApp
@@ -63,6 +78,9 @@ type Reconciliation struct {
 
 // Rollout is the type for rollout
 type Rollout struct {
+	// Kind of the workload
+	// +optional
+	Kind string `json:"kind,omitempty"`
 	// +optional
 	Name string `json:"name"`
 	// +optional
@@ -71,6 +89,75 @@ type Rollout struct {
 	UnavailableReplicas int32 `json:"unavailableReplicas,omitempty"`
 	// +optional
 	Rollout RolloutStatus `json:"rollout"`
+	// Reason of a failed rollout
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ApplyResult is the type for the result of applying an object
+type ApplyResult string
+
+// These are the valid apply results.
+const (
+	ApplySucceeded ApplyResult = "Succeeded"
+	ApplyConflict  ApplyResult = "Conflict"
+	ApplyFailed    ApplyResult = "Failed"
+)
+
+// ObjectReference is the type for a reference to an object applied by an AksApp
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ObjectStatus is the type for the apply result of an object of an AksApp
+type ObjectStatus struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// +optional
+	Result ApplyResult `json:"result,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DeletionPolicy is the type for what happens to the objects of a deleted AksApp
+type DeletionPolicy string
+
+// These are the valid deletion policies.
+const (
+	// DeletionPolicyDelete deletes the objects owned by the AksApp
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan leaves the objects owned by the AksApp in place
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// TeardownPhase is the type for the phase of the teardown of an AksApp
+type TeardownPhase string
+
+// These are the valid teardown phases, in the order they run.
+const (
+	TeardownWorkloads   TeardownPhase = "Workloads"
+	TeardownResources   TeardownPhase = "Resources"
+	TeardownCredentials TeardownPhase = "Credentials"
+)
+
+// Teardown is the type for the teardown of the objects of a deleted AksApp
+type Teardown struct {
+	// +optional
+	Policy DeletionPolicy `json:"policy,omitempty"`
+	// +optional
+	Phase TeardownPhase `json:"phase,omitempty"`
+	// Number of the objects left to delete
+	// +optional
+	Remaining int32 `json:"remaining,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // AksAppStatus defines the observed state of AksApp
@@ -87,12 +174,28 @@ type AksAppStatus struct {
 	// Rollout status of AksApp
 	// +optional
 	Rollout RolloutStatus `json:"rollout"`
+	// Start time of the rollout in progress of AksApp, a rollout not complete
+	// within the rollout timeout is failed
+	// +nullable
+	// +optional
+	RolloutStartTime *metav1.Time `json:"rolloutStartTime,omitempty"`
 	// Reconciliation result of AksApp
 	// +optional
 	Reconciliation Reconciliation `json:"reconciliation,omitempty"`
 	// The list of all rollouts per AksApp
 	// +optional
 	Rollouts []Rollout `json:"rollouts,omitempty"`
+	// The apply results of the objects of AksApp in the last reconciliation
+	// applying them
+	// +optional
+	Objects []ObjectStatus `json:"objects,omitempty"`
+	// The objects applied by the last successful reconciliation of AksApp, the
+	// ones removed from its configuration are pruned
+	// +optional
+	Inventory []ObjectReference `json:"inventory,omitempty"`
+	// Teardown progress of AksApp once deleted
+	// +optional
+	Teardown *Teardown `json:"teardown,omitempty"`
 }
 
 //+kubebuilder:object:root=true
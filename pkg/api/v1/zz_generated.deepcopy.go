@@ -114,12 +114,31 @@ func (in *AksAppSpec) DeepCopy() *AksAppSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AksAppStatus) DeepCopyInto(out *AksAppStatus) {
 	*out = *in
+	if in.RolloutStartTime != nil {
+		in, out := &in.RolloutStartTime, &out.RolloutStartTime
+		*out = (*in).DeepCopy()
+	}
 	in.Reconciliation.DeepCopyInto(&out.Reconciliation)
 	if in.Rollouts != nil {
 		in, out := &in.Rollouts, &out.Rollouts
 		*out = make([]Rollout, len(*in))
 		copy(*out, *in)
 	}
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]ObjectStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Inventory != nil {
+		in, out := &in.Inventory, &out.Inventory
+		*out = make([]ObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Teardown != nil {
+		in, out := &in.Teardown, &out.Teardown
+		*out = new(Teardown)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AksAppStatus.
@@ -132,6 +151,36 @@ func (in *AksAppStatus) DeepCopy() *AksAppStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectReference) DeepCopyInto(out *ObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectReference.
+func (in *ObjectReference) DeepCopy() *ObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectStatus) DeepCopyInto(out *ObjectStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectStatus.
+func (in *ObjectStatus) DeepCopy() *ObjectStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Reconciliation) DeepCopyInto(out *Reconciliation) {
 	*out = *in
@@ -162,3 +211,18 @@ func (in *Rollout) DeepCopy() *Rollout {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Teardown) DeepCopyInto(out *Teardown) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Teardown.
+func (in *Teardown) DeepCopy() *Teardown {
+	if in == nil {
+		return nil
+	}
+	out := new(Teardown)
+	in.DeepCopyInto(out)
+	return out
+}
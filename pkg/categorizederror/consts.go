@@ -310,6 +310,7 @@ const (
 	// blob storage client
 	UnexpectedStatusCodeCheckContainerExist ErrorSubCode = "UnexpectedStatusCodeCheckContainerExist"
 	UnexpectedStatusCodeDeleteContainer     ErrorSubCode = "UnexpectedStatusCodeDeleteContainer"
+	UnexpectedStatusCodeDeleteBlob          ErrorSubCode = "UnexpectedStatusCodeDeleteBlob"
 	UnexpectedStatusCodeCreateContainer     ErrorSubCode = "UnexpectedStatusCodeCreateContainer"
 	UnexpectedStatusCodePutBlob             ErrorSubCode = "UnexpectedStatusCodePutBlob"
 	UnexpectedStatusCodeCheckBlobExist      ErrorSubCode = "UnexpectedStatusCodeCheckBlobExist"
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
@@ -110,16 +113,56 @@ func (c *BlobClient) GetBlobData(ctx context.Context, url string) ([]byte, error
 
 	resp, err := c.sender(ctx, r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get response, err: %s", err)
+		return nil, fmt.Errorf("failed to get response, err: %w", err)
 	}
 
 	bytes, err := c.getBlobDataResponder(resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to handle response, err: %s", err)
+		return nil, fmt.Errorf("failed to handle response, err: %w", err)
 	}
 	return bytes, nil
 }
 
+// GetBlobDataIfNoneMatch gets data from blob with URL unless the blob still matches etag.
+// It returns nil when the blob does not exist, like GetBlobData.
+func (c *BlobClient) GetBlobDataIfNoneMatch(ctx context.Context, url, etag string) (*BlobData, error) {
+	decorators := []autorest.PrepareDecorator{autorest.AsGet()}
+	if etag != "" {
+		decorators = append(decorators, autorest.WithHeader("If-None-Match", etag))
+	}
+	r, err := c.preparer(ctx, url, decorators)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request, err: %s", err)
+	}
+
+	resp, err := c.sender(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response, err: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		_ = autorest.Respond(resp, autorest.ByClosing())
+		return &BlobData{
+			ETag:         etag,
+			LastModified: resp.Header.Get("Last-Modified"),
+			NotModified:  true,
+		}, nil
+	}
+
+	bytes, err := c.getBlobDataResponder(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to handle response, err: %w", err)
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+	return &BlobData{
+		Data:         bytes,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
 // PutBlobData put data to blob with URL
 func (c *BlobClient) PutBlobData(ctx context.Context, url string, data []byte) error {
 	r, err := c.putPreparer(ctx, url, data, nil)
@@ -201,6 +244,44 @@ func (c *BlobClient) BlobExists(ctx context.Context, storageAccountName, contain
 		fmt.Errorf("failed to get response, err: %s", err))
 }
 
+// DeleteBlob deletes a blob along with its snapshots, deleting a blob which
+// does not exist is not an error.
+// ref: https://docs.microsoft.com/en-us/rest/api/storageservices/delete-blob
+func (c *BlobClient) DeleteBlob(ctx context.Context, storageAccountName, containerName, blobName string) error {
+	url := fmt.Sprintf("https://%s.blob.%s/%s/%s", storageAccountName, c.storageEndpointSuffix, containerName, blobName)
+	r, err := c.preparer(ctx, url, []autorest.PrepareDecorator{
+		autorest.AsDelete(),
+		autorest.WithHeader("x-ms-delete-snapshots", "include"),
+	})
+	if err != nil {
+		return cgerror.NewCategorizedError(
+			ctx,
+			apierror.InternalError,
+			cgerror.FailedPrepareRequest,
+			cgerror.BlobStorage,
+			fmt.Errorf("failed to prepare request, err: %s", err))
+	}
+
+	resp, err := c.sender(ctx, r)
+	if resp != nil {
+		if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return cgerror.NewCategorizedError(
+			ctx,
+			apierror.InternalError,
+			cgerror.UnexpectedStatusCodeDeleteBlob,
+			cgerror.BlobStorage,
+			fmt.Errorf("Unexpected status code happened: %d when delete blob: %s", resp.StatusCode, url))
+	}
+	return cgerror.NewCategorizedError(
+		ctx,
+		apierror.InternalError,
+		cgerror.FailedGetResponse,
+		cgerror.BlobStorage,
+		fmt.Errorf("failed to get response, err: %s", err))
+}
+
 // PutBlobDataV1 gets data from blob with URL
 func (c *BlobClient) PutBlobDataV1(ctx context.Context, storageAccountName, containerName, blobName string, data []byte, extraHeaders map[string]interface{}) error {
 	url := fmt.Sprintf("https://%s.blob.%s/%s/%s", storageAccountName, c.storageEndpointSuffix, containerName, blobName)
@@ -301,7 +382,7 @@ func (c *BlobClient) getBlobDataResponder(resp *http.Response) ([]byte, error) {
 
 	err := autorest.Respond(resp, azure.WithErrorUnlessStatusCode(http.StatusOK))
 	if err != nil {
-		return nil, err
+		return nil, &StatusError{StatusCode: resp.StatusCode, Err: err}
 	}
 
 	result, err := ioutil.ReadAll(resp.Body)
@@ -312,24 +393,97 @@ func (c *BlobClient) getBlobDataResponder(resp *http.Response) ([]byte, error) {
 	return result, nil
 }
 
-// ListBlobsWithPrefix lists blobs with URL and prefix
+// ListBlobsWithPrefix lists all the blobs with URL and prefix, following the
+// continuation markers until the listing is complete
 func (c *BlobClient) ListBlobsWithPrefix(ctx context.Context, url, prefix string) (storage.BlobListResponse, error) {
-	r, err := c.preparer(ctx, fmt.Sprintf("%s?restype=container&comp=list&prefix=%s",
-		url, prefix), []autorest.PrepareDecorator{autorest.AsGet()})
+	var out storage.BlobListResponse
+	err := c.ListBlobsPages(ctx, url, storage.ListBlobsParameters{Prefix: prefix},
+		func(page storage.BlobListResponse) bool {
+			out.XMLName = page.XMLName
+			out.Xmlns = page.Xmlns
+			out.Prefix = page.Prefix
+			out.Delimiter = page.Delimiter
+			out.Blobs = append(out.Blobs, page.Blobs...)
+			out.BlobPrefixes = append(out.BlobPrefixes, page.BlobPrefixes...)
+			return true
+		})
 	if err != nil {
-		return storage.BlobListResponse{}, fmt.Errorf("failed to prepare request, err: %s", err)
+		return storage.BlobListResponse{}, err
 	}
+	return out, nil
+}
 
-	resp, err := c.sender(ctx, r)
-	if err != nil {
-		return storage.BlobListResponse{}, fmt.Errorf("failed to get response, err: %s", err)
+// ListBlobsPages lists blobs of the container with URL page by page, calling fn
+// with each page until the listing is complete or fn returns false. Prefix,
+// Delimiter, Marker, MaxResults, Include and Timeout of params are honored.
+// ref: https://docs.microsoft.com/en-us/rest/api/storageservices/list-blobs
+func (c *BlobClient) ListBlobsPages(ctx context.Context, containerURL string,
+	params storage.ListBlobsParameters, fn func(page storage.BlobListResponse) bool) error {
+	marker := params.Marker
+	for {
+		params.Marker = marker
+		r, err := c.preparer(ctx, fmt.Sprintf("%s?%s", containerURL, listBlobsQuery(params).Encode()),
+			[]autorest.PrepareDecorator{autorest.AsGet()})
+		if err != nil {
+			return fmt.Errorf("failed to prepare request, err: %s", err)
+		}
+
+		resp, err := c.sender(ctx, r)
+		if err != nil {
+			return fmt.Errorf("failed to get response, err: %w", err)
+		}
+
+		page, err := c.listBlobsWithPrefixResponder(resp)
+		if err != nil {
+			return fmt.Errorf("failed to handle response, err: %w", err)
+		}
+
+		if !fn(page) || page.NextMarker == "" {
+			return nil
+		}
+		marker = page.NextMarker
 	}
+}
 
-	blobs, err := c.listBlobsWithPrefixResponder(resp)
-	if err != nil {
-		return storage.BlobListResponse{}, fmt.Errorf("failed to handle response, err: %s", err)
+// listBlobsQuery returns the escaped query parameters of a List Blobs request
+func listBlobsQuery(params storage.ListBlobsParameters) neturl.Values {
+	query := neturl.Values{}
+	query.Set("restype", "container")
+	query.Set("comp", "list")
+	if params.Prefix != "" {
+		query.Set("prefix", params.Prefix)
+	}
+	if params.Delimiter != "" {
+		query.Set("delimiter", params.Delimiter)
+	}
+	if params.Marker != "" {
+		query.Set("marker", params.Marker)
+	}
+	if params.MaxResults != 0 {
+		query.Set("maxresults", strconv.FormatUint(uint64(params.MaxResults), 10))
+	}
+	if params.Timeout != 0 {
+		query.Set("timeout", strconv.FormatUint(uint64(params.Timeout), 10))
+	}
+	if params.Include != nil {
+		var include []string
+		if params.Include.Snapshots {
+			include = append(include, "snapshots")
+		}
+		if params.Include.Metadata {
+			include = append(include, "metadata")
+		}
+		if params.Include.UncommittedBlobs {
+			include = append(include, "uncommittedblobs")
+		}
+		if params.Include.Copy {
+			include = append(include, "copy")
+		}
+		if len(include) > 0 {
+			query.Set("include", strings.Join(include, ","))
+		}
 	}
-	return blobs, nil
+	return query
 }
 
 func (c *BlobClient) listBlobsWithPrefixResponder(resp *http.Response) (storage.BlobListResponse, error) {
@@ -339,7 +493,7 @@ func (c *BlobClient) listBlobsWithPrefixResponder(resp *http.Response) (storage.
 
 	err := autorest.Respond(resp, azure.WithErrorUnlessStatusCode(http.StatusOK))
 	if err != nil {
-		return storage.BlobListResponse{}, err
+		return storage.BlobListResponse{}, &StatusError{StatusCode: resp.StatusCode, Err: err}
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
@@ -529,6 +683,27 @@ func (c *BlobClient) ReleaseLease(ctx context.Context, storageAccountName, conta
 	return fmt.Errorf("failed to get response, err: %s", err)
 }
 
+func (c *BlobClient) RenewLease(ctx context.Context, storageAccountName, containerName, blobName, leaseID string) error {
+	url := fmt.Sprintf("https://%s.blob.%s/%s/%s?comp=lease", storageAccountName, c.storageEndpointSuffix, containerName, blobName)
+
+	r, err := c.preparer(ctx, url, []autorest.PrepareDecorator{
+		autorest.AsPut(),
+		autorest.WithHeader("x-ms-lease-action", "renew"),
+		autorest.WithHeader(HeaderLeaseID, leaseID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prepare request, err: %s", err)
+	}
+	resp, err := c.sender(ctx, r)
+	if resp != nil {
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+		return fmt.Errorf("Unexpected status code happened: %d when renew lease for: %s", resp.StatusCode, url)
+	}
+	return fmt.Errorf("failed to get response, err: %s", err)
+}
+
 func (c *BlobClient) BreakLease(ctx context.Context, storageAccountName, containerName, blobName, leaseID string) error {
 	url := fmt.Sprintf("https://%s.blob.%s/%s/%s?comp=lease", storageAccountName, c.storageEndpointSuffix, containerName, blobName)
 
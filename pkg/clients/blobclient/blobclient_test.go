@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/stretchr/testify/require"
 	cgerror "github.com/Azure/aks-deployer/pkg/categorizederror"
@@ -28,6 +29,113 @@ func TestBlobClient_GetBlobData(t *testing.T) {
 	})
 }
 
+func TestBlobClient_GetBlobDataIfNoneMatch(t *testing.T) {
+	t.Run("returns data and etag when modified", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			require.Equal(t, req.Method, http.MethodGet)
+			require.Equal(t, req.Header.Get("If-None-Match"), "\"etag-1\"")
+
+			rw.Header().Set("ETag", "\"etag-2\"")
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("aaa"))
+		}))
+		defer server.Close()
+
+		client := &BlobClient{}
+		blob, err := client.GetBlobDataIfNoneMatch(context.Background(), server.URL, "\"etag-1\"")
+		require.NoError(t, err)
+		require.False(t, blob.NotModified)
+		require.Equal(t, blob.Data, []byte("aaa"))
+		require.Equal(t, blob.ETag, "\"etag-2\"")
+	})
+
+	t.Run("returns not modified", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			require.Equal(t, req.Header.Get("If-None-Match"), "\"etag-1\"")
+			rw.WriteHeader(http.StatusNotModified)
+		}))
+		defer server.Close()
+
+		client := &BlobClient{}
+		blob, err := client.GetBlobDataIfNoneMatch(context.Background(), server.URL, "\"etag-1\"")
+		require.NoError(t, err)
+		require.True(t, blob.NotModified)
+		require.Empty(t, blob.Data)
+		require.Equal(t, blob.ETag, "\"etag-1\"")
+	})
+
+	t.Run("returns nil for not found", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			require.Empty(t, req.Header.Get("If-None-Match"))
+			rw.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		client := &BlobClient{}
+		blob, err := client.GetBlobDataIfNoneMatch(context.Background(), server.URL, "")
+		require.NoError(t, err)
+		require.Nil(t, blob)
+	})
+}
+
+func TestBlobClient_ListBlobsWithPrefix(t *testing.T) {
+	t.Run("follows continuation markers", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			require.Equal(t, req.Method, http.MethodGet)
+			require.Equal(t, req.URL.Query().Get("comp"), "list")
+			require.Equal(t, req.URL.Query().Get("prefix"), "cluster a&b/")
+
+			rw.WriteHeader(http.StatusOK)
+			switch req.URL.Query().Get("marker") {
+			case "":
+				rw.Write([]byte(`<EnumerationResults><Blobs><Blob><Name>blob-1</Name></Blob></Blobs><NextMarker>marker-1</NextMarker></EnumerationResults>`))
+			case "marker-1":
+				rw.Write([]byte(`<EnumerationResults><Blobs><Blob><Name>blob-2</Name></Blob></Blobs><NextMarker /></EnumerationResults>`))
+			default:
+				t.Errorf("unexpected marker %s", req.URL.Query().Get("marker"))
+			}
+		}))
+		defer server.Close()
+
+		client := &BlobClient{}
+		blobs, err := client.ListBlobsWithPrefix(context.Background(), server.URL, "cluster a&b/")
+		require.NoError(t, err)
+		require.Len(t, blobs.Blobs, 2)
+		require.Equal(t, blobs.Blobs[0].Name, "blob-1")
+		require.Equal(t, blobs.Blobs[1].Name, "blob-2")
+	})
+}
+
+func TestBlobClient_ListBlobsPages(t *testing.T) {
+	t.Run("sends the list parameters", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			require.Equal(t, req.URL.Query().Get("delimiter"), "/")
+			require.Equal(t, req.URL.Query().Get("maxresults"), "1")
+			require.Equal(t, req.URL.Query().Get("marker"), "marker-0")
+
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte(`<EnumerationResults><Blobs><BlobPrefix><Name>folder/</Name></BlobPrefix></Blobs><NextMarker>marker-1</NextMarker></EnumerationResults>`))
+		}))
+		defer server.Close()
+
+		client := &BlobClient{}
+		pages := 0
+		err := client.ListBlobsPages(context.Background(), server.URL, storage.ListBlobsParameters{
+			Delimiter:  "/",
+			MaxResults: 1,
+			Marker:     "marker-0",
+		}, func(page storage.BlobListResponse) bool {
+			pages++
+			require.Len(t, page.BlobPrefixes, 1)
+			require.Equal(t, page.BlobPrefixes[0], "folder/")
+			// stop after the first page
+			return false
+		})
+		require.NoError(t, err)
+		require.Equal(t, pages, 1)
+	})
+}
+
 func TestBlobClient_ContainerExists(t *testing.T) {
 	t.Run("return error for unexpected status code", func(t *testing.T) {
 		ctx := context.Background()
@@ -100,6 +208,50 @@ func TestBlobClient_DeleteContainer(t *testing.T) {
 	})
 }
 
+func TestBlobClient_DeleteBlob(t *testing.T) {
+	t.Run("delete blob with its snapshots", func(t *testing.T) {
+		ctx := context.Background()
+		client := &BlobClient{
+			restClient: newMockAutoRestClient(autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+				require.Equal(t, req.Method, http.MethodDelete)
+				require.Equal(t, req.Header.Get("x-ms-delete-snapshots"), "include")
+				resp := &http.Response{StatusCode: http.StatusAccepted}
+				return resp, nil
+			})),
+		}
+		err := client.DeleteBlob(ctx, "test-sa", "test-container", "test-blob")
+		require.NoError(t, err)
+	})
+
+	t.Run("return no error for not found status code", func(t *testing.T) {
+		ctx := context.Background()
+		client := &BlobClient{
+			restClient: newMockAutoRestClient(autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+				resp := &http.Response{StatusCode: http.StatusNotFound}
+				return resp, nil
+			})),
+		}
+		err := client.DeleteBlob(ctx, "test-sa", "test-container", "test-blob")
+		require.NoError(t, err)
+	})
+
+	t.Run("return error for unexpected status", func(t *testing.T) {
+		ctx := context.Background()
+		client := &BlobClient{
+			restClient: newMockAutoRestClient(autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+				resp := &http.Response{StatusCode: http.StatusConflict}
+				return resp, nil
+			})),
+		}
+		err := client.DeleteBlob(ctx, "test-sa", "test-container", "test-blob")
+		require.Error(t, err)
+		cerr, ok := err.(*cgerror.CategorizedError)
+		require.True(t, ok)
+		require.Equal(t, cerr.SubCode, cgerror.UnexpectedStatusCodeDeleteBlob)
+		require.Equal(t, cerr.Dependency, cgerror.BlobStorage)
+	})
+}
+
 func TestBlobClient_BlobExists(t *testing.T) {
 	t.Run("return not exists for not found status code", func(t *testing.T) {
 		ctx := context.Background()
@@ -316,6 +468,36 @@ func TestBlobClient_ReleaseLease(t *testing.T) {
 	})
 }
 
+func TestBlobClient_RenewLease(t *testing.T) {
+	t.Run("set expected header", func(t *testing.T) {
+		ctx := context.Background()
+		testLeaseID := "test-lease-id"
+		client := &BlobClient{
+			restClient: newMockAutoRestClient(autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+				require.Equal(t, req.Method, http.MethodPut)
+				require.Equal(t, req.Header.Get("x-ms-lease-action"), "renew")
+				require.Equal(t, req.Header.Get(HeaderLeaseID), testLeaseID)
+				resp := &http.Response{StatusCode: http.StatusOK}
+				return resp, nil
+			})),
+		}
+		err := client.RenewLease(ctx, "test-sa", "test-container", "test-blob", testLeaseID)
+		require.NoError(t, err)
+	})
+
+	t.Run("lease lost", func(t *testing.T) {
+		ctx := context.Background()
+		client := &BlobClient{
+			restClient: newMockAutoRestClient(autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+				resp := &http.Response{StatusCode: http.StatusConflict}
+				return resp, nil
+			})),
+		}
+		err := client.RenewLease(ctx, "test-sa", "test-container", "test-blob", "test-lease-id")
+		require.Error(t, err)
+	})
+}
+
 func TestBlobClient_BreakLease(t *testing.T) {
 	t.Run("set expected header", func(t *testing.T) {
 		ctx := context.Background()
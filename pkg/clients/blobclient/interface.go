@@ -24,19 +24,47 @@ const (
 // HeaderLeaseID - specify the header name for operation lease id.
 const HeaderLeaseID = "x-ms-lease-id"
 
+// BlobData is the data of a blob returned by a conditional read along with its properties.
+type BlobData struct {
+	Data         []byte
+	ETag         string
+	LastModified string
+	// NotModified is true when the blob still matches the ETag of the request, Data is empty then.
+	NotModified bool
+}
+
+// StatusError is returned by the reads when the service responds with an
+// unexpected status code, the status code tells if the read can be retried.
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
 // Interface blob client APIs
 type Interface interface {
 	GetBlobData(ctx context.Context, url string) ([]byte, error)
+	GetBlobDataIfNoneMatch(ctx context.Context, url, etag string) (*BlobData, error)
 	GetBlobDataV1(ctx context.Context, storageAccountName, containerName, blobName string) ([]byte, int, error)
 	BlobExists(ctx context.Context, storageAccountName, containerName, blobName string) (bool, error)
 	PutBlobData(ctx context.Context, url string, data []byte) error
 	PutBlobDataV1(ctx context.Context, storageAccountName, containerName, blobName string, data []byte, extraHeaders map[string]interface{}) error
+	DeleteBlob(ctx context.Context, storageAccountName, containerName, blobName string) error
 	ListBlobsWithPrefix(ctx context.Context, url, prefix string) (storage.BlobListResponse, error)
+	ListBlobsPages(ctx context.Context, containerURL string, params storage.ListBlobsParameters, fn func(page storage.BlobListResponse) bool) error
 	ContainerExists(ctx context.Context, storageAccountName, containerName string) (bool, error)
 	DeleteContainer(ctx context.Context, storageAccountName, containerName string) error
 	CreateContainer(ctx context.Context, storageAccountName, containerName string) error
 	CreateContainerWithACL(ctx context.Context, storageAccountName, containerName string, acl BlobPublicAccessLevel) error
 	AcquireLease(ctx context.Context, storageAccountName, containerName, blobName string, durationInSeconds uint) (string, error)
 	ReleaseLease(ctx context.Context, storageAccountName, containerName, blobName, leaseID string) error
+	RenewLease(ctx context.Context, storageAccountName, containerName, blobName, leaseID string) error
 	BreakLease(ctx context.Context, storageAccountName, containerName, blobName, leaseID string) error
 }
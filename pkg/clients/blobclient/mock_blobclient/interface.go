@@ -137,6 +137,20 @@ func (mr *MockInterfaceMockRecorder) DeleteContainer(arg0, arg1, arg2 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteContainer", reflect.TypeOf((*MockInterface)(nil).DeleteContainer), arg0, arg1, arg2)
 }
 
+// DeleteBlob mocks base method.
+func (m *MockInterface) DeleteBlob(arg0 context.Context, arg1, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteBlob", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteBlob indicates an expected call of DeleteBlob.
+func (mr *MockInterfaceMockRecorder) DeleteBlob(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBlob", reflect.TypeOf((*MockInterface)(nil).DeleteBlob), arg0, arg1, arg2, arg3)
+}
+
 // GetBlobData mocks base method.
 func (m *MockInterface) GetBlobData(arg0 context.Context, arg1 string) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -152,6 +166,21 @@ func (mr *MockInterfaceMockRecorder) GetBlobData(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlobData", reflect.TypeOf((*MockInterface)(nil).GetBlobData), arg0, arg1)
 }
 
+// GetBlobDataIfNoneMatch mocks base method.
+func (m *MockInterface) GetBlobDataIfNoneMatch(arg0 context.Context, arg1, arg2 string) (*blobclient.BlobData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlobDataIfNoneMatch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*blobclient.BlobData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlobDataIfNoneMatch indicates an expected call of GetBlobDataIfNoneMatch.
+func (mr *MockInterfaceMockRecorder) GetBlobDataIfNoneMatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlobDataIfNoneMatch", reflect.TypeOf((*MockInterface)(nil).GetBlobDataIfNoneMatch), arg0, arg1, arg2)
+}
+
 // GetBlobDataV1 mocks base method.
 func (m *MockInterface) GetBlobDataV1(arg0 context.Context, arg1, arg2, arg3 string) ([]byte, int, error) {
 	m.ctrl.T.Helper()
@@ -168,6 +197,20 @@ func (mr *MockInterfaceMockRecorder) GetBlobDataV1(arg0, arg1, arg2, arg3 interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlobDataV1", reflect.TypeOf((*MockInterface)(nil).GetBlobDataV1), arg0, arg1, arg2, arg3)
 }
 
+// ListBlobsPages mocks base method.
+func (m *MockInterface) ListBlobsPages(arg0 context.Context, arg1 string, arg2 storage.ListBlobsParameters, arg3 func(storage.BlobListResponse) bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListBlobsPages", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ListBlobsPages indicates an expected call of ListBlobsPages.
+func (mr *MockInterfaceMockRecorder) ListBlobsPages(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListBlobsPages", reflect.TypeOf((*MockInterface)(nil).ListBlobsPages), arg0, arg1, arg2, arg3)
+}
+
 // ListBlobsWithPrefix mocks base method.
 func (m *MockInterface) ListBlobsWithPrefix(arg0 context.Context, arg1, arg2 string) (storage.BlobListResponse, error) {
 	m.ctrl.T.Helper()
@@ -224,3 +267,17 @@ func (mr *MockInterfaceMockRecorder) ReleaseLease(arg0, arg1, arg2, arg3, arg4 i
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseLease", reflect.TypeOf((*MockInterface)(nil).ReleaseLease), arg0, arg1, arg2, arg3, arg4)
 }
+
+// RenewLease mocks base method.
+func (m *MockInterface) RenewLease(arg0 context.Context, arg1, arg2, arg3, arg4 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewLease", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenewLease indicates an expected call of RenewLease.
+func (mr *MockInterfaceMockRecorder) RenewLease(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewLease", reflect.TypeOf((*MockInterface)(nil).RenewLease), arg0, arg1, arg2, arg3, arg4)
+}
@@ -12,8 +12,41 @@ const (
 	ConfigDataKey = "config"
 	// ConfigAnnotationKey is configuration blob URL key
 	ConfigAnnotationKey = "blob-url"
+	// ConfigHashAnnotationKey is configuration content hash key
+	ConfigHashAnnotationKey = "config-sha256"
+	// ConfigBinaryDataKey is compressed configuration ConfigMap key
+	ConfigBinaryDataKey = "config.gz"
+	// ConfigEncodingAnnotationKey is configuration encoding key, unset for plain data
+	ConfigEncodingAnnotationKey = "config-encoding"
+	// ConfigChunksAnnotationKey is the number of ConfigMaps a configuration is split across
+	ConfigChunksAnnotationKey = "config-chunks"
+	// ConfigEncodingGzip is the encoding of gzip-compressed configurations
+	ConfigEncodingGzip = "gzip"
+	// ConfigSourcesAnnotationKey is the JSON list of blobs a configuration is assembled from
+	ConfigSourcesAnnotationKey = "config-sources"
+	// ConfigSignatureAnnotationKey records if the signatures of the blobs of a
+	// configuration were verified
+	ConfigSignatureAnnotationKey = "config-signature"
+	// ConfigProvenanceAnnotationKey is the JSON record of the layer setting each
+	// field of the AksApps of the cluster configuration
+	ConfigProvenanceAnnotationKey = "config-provenance"
+	// ConfigOverwrittenAnnotationKey is the last time the content of an aksapp
+	// configuration changed under the same version
+	ConfigOverwrittenAnnotationKey = "config-overwritten"
+	// ObsoleteSinceAnnotationKey is the time an aksapp configuration stopped being referenced
+	ObsoleteSinceAnnotationKey = "obsolete-since"
+	// ManagedByLabelKey is the label key of the component managing a ConfigMap
+	ManagedByLabelKey = "app.kubernetes.io/managed-by"
+	// ManagedBySyncer is the ManagedByLabelKey value of the ConfigMaps written by the syncer
+	ManagedBySyncer = "aks-deployer-syncer"
+	// AppTypeLabelKey is the label key of the aksapp type of a configuration
+	AppTypeLabelKey = "deployer.aks.io/app-type"
+	// AppVersionLabelKey is the label key of the aksapp version of a configuration
+	AppVersionLabelKey = "deployer.aks.io/app-version"
 	// DefaultDeployerNamespace is deployer's default namespace
 	DefaultDeployerNamespace = "deployer"
 
 	configDataDelimiter = "---\n"
+
+	configChunkNameFormat = "%s-chunk-%d"
 )
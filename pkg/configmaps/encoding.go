@@ -0,0 +1,172 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package configmaps
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// compressionThreshold is the size above which configuration data is
+	// stored gzip-compressed in BinaryData
+	compressionThreshold = 256 * 1024
+	// chunkSize is the maximum size of compressed data stored in one ConfigMap,
+	// which leaves room for the metadata under the 1 MiB object limit
+	chunkSize = 768 * 1024
+)
+
+// NewConfigMaps returns the ConfigMaps storing configuration data. The first
+// ConfigMap is named name and carries the annotations, the others are the
+// numbered chunks of a configuration too large to fit in one ConfigMap. All
+// of them get the labels.
+func NewConfigMaps(name, namespace, data string, labels, annotations map[string]string) ([]*corev1.ConfigMap, error) {
+	primary := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: map[string]string{},
+		},
+	}
+	for k, v := range annotations {
+		primary.Annotations[k] = v
+	}
+	primary.Annotations[ConfigHashAnnotationKey] = checksum([]byte(data))
+
+	if len(data) <= compressionThreshold {
+		primary.Data = map[string]string{
+			ConfigDataKey: data,
+		}
+		return []*corev1.ConfigMap{primary}, nil
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	compressed := buf.Bytes()
+
+	var chunks [][]byte
+	for len(compressed) > chunkSize {
+		chunks = append(chunks, compressed[:chunkSize])
+		compressed = compressed[chunkSize:]
+	}
+	chunks = append(chunks, compressed)
+
+	primary.Annotations[ConfigEncodingAnnotationKey] = ConfigEncodingGzip
+	primary.Annotations[ConfigChunksAnnotationKey] = strconv.Itoa(len(chunks))
+	primary.BinaryData = map[string][]byte{
+		ConfigBinaryDataKey: chunks[0],
+	}
+
+	cms := []*corev1.ConfigMap{primary}
+	for i := 1; i < len(chunks); i++ {
+		cms = append(cms, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetConfigChunkName(name, i),
+				Namespace: namespace,
+				Labels:    labels,
+				Annotations: map[string]string{
+					ConfigHashAnnotationKey: checksum(chunks[i]),
+				},
+			},
+			BinaryData: map[string][]byte{
+				ConfigBinaryDataKey: chunks[i],
+			},
+		})
+	}
+
+	return cms, nil
+}
+
+// GetConfigData returns the configuration data stored by NewConfigMaps.
+// getChunk reads the numbered chunks of the configuration by name.
+func GetConfigData(cm *corev1.ConfigMap, getChunk func(name string) (*corev1.ConfigMap, error)) (string, error) {
+	encoding := cm.Annotations[ConfigEncodingAnnotationKey]
+	if encoding == "" {
+		return cm.Data[ConfigDataKey], nil
+	}
+	if encoding != ConfigEncodingGzip {
+		return "", fmt.Errorf("unsupported encoding %q of ConfigMap %s", encoding, cm.Name)
+	}
+
+	chunks := 1
+	if value, ok := cm.Annotations[ConfigChunksAnnotationKey]; ok {
+		var err error
+		chunks, err = strconv.Atoi(value)
+		if err != nil || chunks < 1 {
+			return "", fmt.Errorf("invalid chunk count %q of ConfigMap %s", value, cm.Name)
+		}
+	}
+
+	compressed := append([]byte{}, cm.BinaryData[ConfigBinaryDataKey]...)
+	for i := 1; i < chunks; i++ {
+		chunk, err := getChunk(GetConfigChunkName(cm.Name, i))
+		if err != nil {
+			return "", err
+		}
+		compressed = append(compressed, chunk.BinaryData[ConfigBinaryDataKey]...)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress ConfigMap %s: %s", cm.Name, err.Error())
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress ConfigMap %s: %s", cm.Name, err.Error())
+	}
+
+	// The chunks are written one by one, make sure they belong to the same configuration
+	if hash, ok := cm.Annotations[ConfigHashAnnotationKey]; ok && hash != checksum(data) {
+		return "", fmt.Errorf("checksum mismatch of ConfigMap %s", cm.Name)
+	}
+
+	return string(data), nil
+}
+
+// SourceBlob is a blob a configuration is assembled from
+type SourceBlob struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	// Verified is true when the detached signature of the blob was verified
+	Verified bool `json:"verified,omitempty"`
+}
+
+// NewSourceBlob returns the SourceBlob of a blob with its content digest
+func NewSourceBlob(name, content string) SourceBlob {
+	return SourceBlob{
+		Name:   name,
+		SHA256: checksum([]byte(content)),
+	}
+}
+
+// GetConfigChunkName returns the name of the index-th chunk of a configuration
+func GetConfigChunkName(configMapName string, index int) string {
+	return fmt.Sprintf(configChunkNameFormat, configMapName, index)
+}
+
+// Checksum returns the digest of configuration data recorded by NewConfigMaps
+func Checksum(data string) string {
+	return checksum([]byte(data))
+}
+
+func checksum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
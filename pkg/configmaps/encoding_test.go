@@ -0,0 +1,92 @@
+package configmaps
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Test Encoding", func() {
+	// randomData returns incompressible enough data of about size bytes
+	randomData := func(size int) string {
+		buf := make([]byte, size*3/4)
+		_, err := rand.Read(buf)
+		Expect(err).To(BeNil())
+		return base64.StdEncoding.EncodeToString(buf)
+	}
+
+	getChunk := func(cms []*corev1.ConfigMap) func(name string) (*corev1.ConfigMap, error) {
+		return func(name string) (*corev1.ConfigMap, error) {
+			for _, cm := range cms {
+				if cm.Name == name {
+					return cm, nil
+				}
+			}
+			return nil, fmt.Errorf("ConfigMap %s not found", name)
+		}
+	}
+
+	It("Store small configurations as plain data", func() {
+		cms, err := NewConfigMaps("test", "deployer", "data", nil, map[string]string{ConfigAnnotationKey: "url"})
+		Expect(err).To(BeNil())
+		Expect(cms).To(HaveLen(1))
+		Expect(cms[0].Data[ConfigDataKey]).To(Equal("data"))
+		Expect(cms[0].Annotations).To(HaveKeyWithValue(ConfigAnnotationKey, "url"))
+		Expect(cms[0].Annotations).To(HaveKey(ConfigHashAnnotationKey))
+		Expect(cms[0].Annotations).NotTo(HaveKey(ConfigEncodingAnnotationKey))
+
+		data, err := GetConfigData(cms[0], getChunk(cms))
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal("data"))
+	})
+
+	It("Compress large configurations", func() {
+		configData := strings.Repeat("apiVersion: v1\nkind: ConfigMap\n---\n", 20000)
+		cms, err := NewConfigMaps("test", "deployer", configData, nil, nil)
+		Expect(err).To(BeNil())
+		Expect(cms).To(HaveLen(1))
+		Expect(cms[0].Data).To(BeEmpty())
+		Expect(cms[0].Annotations).To(HaveKeyWithValue(ConfigEncodingAnnotationKey, ConfigEncodingGzip))
+		Expect(len(cms[0].BinaryData[ConfigBinaryDataKey])).To(BeNumerically("<", len(configData)))
+
+		data, err := GetConfigData(cms[0], getChunk(cms))
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(configData))
+	})
+
+	It("Split very large configurations across numbered ConfigMaps", func() {
+		configData := randomData(2 * 1024 * 1024)
+		cms, err := NewConfigMaps("test", "deployer", configData, nil, nil)
+		Expect(err).To(BeNil())
+		Expect(len(cms)).To(BeNumerically(">", 1))
+		Expect(cms[0].Annotations).To(HaveKeyWithValue(ConfigChunksAnnotationKey, fmt.Sprint(len(cms))))
+		for i, cm := range cms[1:] {
+			Expect(cm.Name).To(Equal(GetConfigChunkName("test", i+1)))
+			Expect(len(cm.BinaryData[ConfigBinaryDataKey])).To(BeNumerically("<=", chunkSize))
+		}
+
+		data, err := GetConfigData(cms[0], getChunk(cms))
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(configData))
+	})
+
+	It("Fail on missing or mismatching chunks", func() {
+		configData := randomData(2 * 1024 * 1024)
+		cms, err := NewConfigMaps("test", "deployer", configData, nil, nil)
+		Expect(err).To(BeNil())
+
+		_, err = GetConfigData(cms[0], getChunk(cms[:1]))
+		Expect(err).NotTo(BeNil())
+
+		others, err := NewConfigMaps("test", "deployer", randomData(2*1024*1024), nil, nil)
+		Expect(err).To(BeNil())
+		_, err = GetConfigData(cms[0], getChunk(append(cms[:1], others[1:]...)))
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -4,6 +4,8 @@
 package configmaps
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -61,6 +63,30 @@ func ParseConfigToUnstructured(logger *logrus.Entry, configData string) ([]*unst
 	return objs, nil
 }
 
+// SerializeConfig serializes a list of runtime.Object as configuration data
+// which can be parsed back by ParseConfig. Objects are written as JSON
+// documents, which are valid YAML.
+func SerializeConfig(scheme *runtime.Scheme, objs []runtime.Object) (string, error) {
+	var buf bytes.Buffer
+	for _, obj := range objs {
+		gvks, _, err := scheme.ObjectKinds(obj)
+		if err != nil {
+			return "", err
+		}
+		obj = obj.DeepCopyObject()
+		obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		buf.Write(data)
+		buf.WriteString("\n")
+		buf.WriteString(configDataDelimiter)
+	}
+	return buf.String(), nil
+}
+
 // GetNamespacedClusterConfigMapName returns namespaced cluster ConfigMap name
 func GetNamespacedClusterConfigMapName(namespace string) string {
 	return fmt.Sprintf(clusterConfigNameFormat, namespace, ClusterConfigMapName)
@@ -5,6 +5,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/sirupsen/logrus"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
@@ -116,3 +117,49 @@ spec:
 		Expect(app2.Name).To(Equal("overlay-manager"))
 	})
 })
+
+var _ = Describe("Test Serialize", func() {
+	var (
+		logger *logrus.Entry
+		scheme *runtime.Scheme
+	)
+
+	BeforeEach(func() {
+		logger = logrus.NewEntry(logrus.New())
+		scheme = runtime.NewScheme()
+		_ = deployerv1.AddToScheme(scheme)
+	})
+
+	It("Serialize configurations which can be parsed back", func() {
+		objs := []runtime.Object{
+			&deployerv1.AksApp{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: deployerv1.GroupVersion.String(),
+					Kind:       deployerv1.AksAppKindStr,
+				},
+				ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: "deployer"},
+				Spec:       deployerv1.AksAppSpec{Type: "type-1", Version: "1.0.0"},
+			},
+			&deployerv1.AksApp{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: deployerv1.GroupVersion.String(),
+					Kind:       deployerv1.AksAppKindStr,
+				},
+				ObjectMeta: metav1.ObjectMeta{Name: "app-2", Namespace: "deployer"},
+				Spec: deployerv1.AksAppSpec{Type: "type-2", Version: "2.0.0",
+					Variables: map[string]string{"REPLICAS": "3"}},
+			},
+		}
+
+		configData, err := SerializeConfig(scheme, objs)
+		Expect(err).To(BeNil())
+
+		parsed, err := ParseConfig(logger, scheme, configData)
+		Expect(err).To(BeNil())
+		Expect(parsed).To(HaveLen(2))
+		app2 := parsed[1].(*deployerv1.AksApp)
+		Expect(app2.Name).To(Equal("app-2"))
+		Expect(app2.Spec.Version).To(Equal("2.0.0"))
+		Expect(app2.Spec.Variables).To(HaveKeyWithValue("REPLICAS", "3"))
+	})
+})
@@ -53,12 +53,13 @@ const (
 	identityResourceIDStr = "IDENTITY_RESOURCE_ID"
 	keyVaultResourceStr   = "KEY_VAULT_RESOURCE"
 
-	defaultReconcileBaseDelay     = 10 * time.Second
-	reconcileMaxDelay             = 300 * time.Second
-	defaultRolloutRecheckInterval = 30 * time.Second
-	monitorInterval               = 120 * time.Second
-	metricResetInterval           = 30 * time.Minute
-	reconcileSyncPeriod           = time.Hour
+	defaultReconcileBaseDelay           = 10 * time.Second
+	reconcileMaxDelay                   = 300 * time.Second
+	defaultRolloutRecheckInterval       = 30 * time.Second
+	defaultFailedRolloutRecheckInterval = 10 * time.Minute
+	monitorInterval                     = 120 * time.Second
+	metricResetInterval                 = 30 * time.Minute
+	reconcileSyncPeriod                 = time.Hour
 
 	// release result
 	resultSucceeded = "Succeeded"
@@ -76,6 +77,7 @@ const (
 	placeholderNotAllReplacedErr = "PlaceholderNotAllReplacedErr"
 	updateAnnotationsErr         = "UpdateAnnotationsErr"
 	processUnmanagedSecretsErr   = "processUnmanagedSecretsErr"
+	readConfigurationErr         = "ReadConfigurationErr"
 
 	noRestartOnSecretUpdateStr = "noRestartOnSecretUpdate" // #nosec only filed name with secret text
 
@@ -83,6 +85,9 @@ const (
 	ownerAnnotation                 = annotationPrefix + "/owner"
 	secretAnnotationPrefix          = annotationPrefix + "/secret-"
 	unmanagedSecretAnnotationPrefix = annotationPrefix + "/unmanaged-secret-"
+
+	// fieldManager is the field manager of the objects applied with server-side apply
+	fieldManager = "aks-deployer"
 )
 
 var (
@@ -114,21 +119,38 @@ type AksAppReconciler struct {
 	Namespace string
 
 	UseOwnerReference bool
-
-	rolloutRecheckInterval time.Duration
-	reconcileBaseDelay     time.Duration
+	// UseServerSideApply applies the objects with server-side apply under the
+	// aks-deployer field manager instead of JSON merge patches
+	UseServerSideApply bool
+	// ForceConflicts takes over the fields managed by others on server-side
+	// apply conflicts, the conflicts fail the objects otherwise
+	ForceConflicts bool
+	// LegacyFieldManagers are the field managers the deployer wrote the objects
+	// under before server-side apply, their fields are migrated to the
+	// aks-deployer field manager before the first apply of each object
+	LegacyFieldManagers []string
+	// DeletionPolicy is what happens to the objects of a deleted AksApp in the
+	// annotation ownership mode, the objects are deleted by default
+	DeletionPolicy deployerv1.DeletionPolicy
+
+	rolloutRecheckInterval       time.Duration
+	failedRolloutRecheckInterval time.Duration
+	reconcileBaseDelay           time.Duration
 }
 
 func NewAksAppReconciler(client client.Client, logger *logrus.Entry,
 	scheme *runtime.Scheme, namespace string, useOwnerReference bool) *AksAppReconciler {
 	return &AksAppReconciler{
-		Client:                 client,
-		Logger:                 logger,
-		Scheme:                 scheme,
-		Namespace:              namespace,
-		UseOwnerReference:      useOwnerReference,
-		rolloutRecheckInterval: defaultRolloutRecheckInterval,
-		reconcileBaseDelay:     defaultReconcileBaseDelay,
+		Client:                       client,
+		Logger:                       logger,
+		Scheme:                       scheme,
+		Namespace:                    namespace,
+		UseOwnerReference:            useOwnerReference,
+		DeletionPolicy:               deployerv1.DeletionPolicyDelete,
+		LegacyFieldManagers:          []string{defaultUpdateFieldManager()},
+		rolloutRecheckInterval:       defaultRolloutRecheckInterval,
+		failedRolloutRecheckInterval: defaultFailedRolloutRecheckInterval,
+		reconcileBaseDelay:           defaultReconcileBaseDelay,
 	}
 }
 
@@ -175,6 +197,16 @@ func (r *AksAppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	logger = logger.WithFields(fields)
 
+	// 1.1 Tear down the objects of a deleted AksApp
+	if !app.DeletionTimestamp.IsZero() {
+		return r.teardown(ctx, &app, logger)
+	}
+	if err = r.ensureFinalizer(ctx, &app, logger); err != nil {
+		logger.Errorf("unable to update finalizers, %s", err.Error())
+		r.updateFailedReconciliation(app, apiServerErr, operationID, logger)
+		return ctrl.Result{}, err
+	}
+
 	// 2. Retrieve the AksApp configuration
 	var cm corev1.ConfigMap
 	nn := types.NamespacedName{
@@ -191,7 +223,22 @@ func (r *AksAppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		r.updateFailedReconciliation(app, apiServerErr, operationID, logger)
 		return ctrl.Result{}, err
 	}
-	data := cm.Data["config"]
+	// Large configurations are compressed and split across numbered ConfigMaps
+	data, err := configmaps.GetConfigData(&cm, func(name string) (*corev1.ConfigMap, error) {
+		var chunk corev1.ConfigMap
+		err := r.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: name}, &chunk)
+		return &chunk, err
+	})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Errorf("aksapp configuration %s/%s is incomplete, %s", nn.Namespace, nn.Name, err.Error())
+			r.updateFailedReconciliation(app, configurationMissingErr, operationID, logger)
+			return ctrl.Result{}, err
+		}
+		logger.Errorf("unable to read aksapp configuration %s/%s, %s", nn.Namespace, nn.Name, err.Error())
+		r.updateFailedReconciliation(app, readConfigurationErr, operationID, logger)
+		return ctrl.Result{}, err
+	}
 
 	// 3. Replace variables
 	// Note: variable placeholders e.g. (V_XXX) will be replaced with real data
@@ -320,12 +367,16 @@ func (r *AksAppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	// 8.2 Deploy Secrets before processing other resources
 	podAnnotations := map[string]string{}
+	applyErrs := make(map[*unstructured.Unstructured]error)
 	for _, obj := range objs {
 		// Check if the resource is Secret
 		if isV1Secret(obj) {
-			if err := r.processUnstructuredObject(ctx, &app, obj, logger); err != nil {
+			err := r.processUnstructuredObject(ctx, &app, obj, logger)
+			applyErrs[obj] = err
+			if err != nil {
 				logger.Errorf("unable to process secrets for aksapp %s/%s, %s",
 					app.Namespace, app.Name, err.Error())
+				app.Status.Objects = objectStatuses(objs, applyErrs)
 				r.updateFailedReconciliation(app, applyComponentErr, operationID, logger)
 				return ctrl.Result{}, err
 			}
@@ -368,7 +419,9 @@ func (r *AksAppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				continue
 			}
 
-			if err := r.processUnstructuredObject(ctx, &app, obj, logger); err != nil {
+			err := r.processUnstructuredObject(ctx, &app, obj, logger)
+			applyErrs[obj] = err
+			if err != nil {
 				errObjs = append(errObjs, obj)
 			}
 		}
@@ -377,6 +430,7 @@ func (r *AksAppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			logger.Errorf("No more components can be processed for aksapp %s/%s, %d components with errors",
 				app.Namespace, app.Name, len(errObjs))
 			err = errors.New("unable to process more components in aksapp")
+			app.Status.Objects = objectStatuses(objs, applyErrs)
 			r.updateFailedReconciliation(app, applyComponentErr, operationID, logger)
 			return ctrl.Result{}, err
 		}
@@ -386,12 +440,25 @@ func (r *AksAppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 
 	logger.Infof("successfully processed aksapp component %s/%s", app.Namespace, app.Name)
+	app.Status.Objects = objectStatuses(objs, applyErrs)
+
+	// 10. Prune the objects removed from the configuration
+	inventory := objectReferences(objs)
+	app.Status.Inventory = append(inventory, r.pruneObjects(ctx, &app, inventory, logger)...)
+
 	if err = r.updateSucceededReconciliation(&app, objs, operationID, logger); err != nil {
 		logger.Errorf("unable to update status, %s", err.Error())
 		return ctrl.Result{}, err
 	}
 
-	if app.Status.Rollout != deployerv1.RolloutCompleted {
+	switch app.Status.Rollout {
+	case deployerv1.RolloutFailed:
+		// a failed rollout is unlikely to recover by itself, recheck it slowly
+		logger.Warnf("rollout failed, %s", rolloutFailureReason(app.Status.Rollouts))
+		return ctrl.Result{
+			RequeueAfter: r.failedRolloutRecheckInterval,
+		}, nil
+	case deployerv1.RolloutInProgress:
 		logger.Infof("rollout is in progress...")
 		return ctrl.Result{
 			RequeueAfter: r.rolloutRecheckInterval,
@@ -406,11 +473,6 @@ func isV1Secret(obj *unstructured.Unstructured) bool {
 	return obj.GroupVersionKind() == secretGVK
 }
 
-func isAppsV1Deployment(obj *unstructured.Unstructured) bool {
-	deploymentGVK := schema.GroupVersionKind{Kind: "Deployment", Version: "v1", Group: "apps"}
-	return obj.GroupVersionKind() == deploymentGVK
-}
-
 func (r *AksAppReconciler) processUnmanagedSecrets(ctx context.Context,
 	secretAnnotations map[string]string,
 	app *deployerv1.AksApp, logger *logrus.Entry) error {
@@ -640,6 +702,27 @@ func (r *AksAppReconciler) processUnstructuredObject(ctx context.Context, app *d
 		}
 	}
 
+	if r.UseServerSideApply {
+		err = r.applyUnstructuredObject(ctx, app, obj, logger)
+	} else {
+		err = r.patchUnstructuredObject(ctx, app, obj, logger)
+	}
+	if err != nil {
+		logger.Errorf("unable to process %s object %s/%s for aksapp component %s/%s, will retry later...",
+			obj.GetKind(), obj.GetNamespace(), obj.GetName(), app.Namespace, app.Name)
+		return err
+	}
+
+	logger.Infof("successfully processed %s object %s/%s for aksapp component %s/%s",
+		obj.GetKind(), obj.GetNamespace(), obj.GetName(), app.Namespace, app.Name)
+
+	return nil
+}
+
+// patchUnstructuredObject creates the object or patches it with a JSON merge patch
+func (r *AksAppReconciler) patchUnstructuredObject(ctx context.Context, app *deployerv1.AksApp,
+	obj *unstructured.Unstructured, logger *logrus.Entry) error {
+	var err error
 	tmp := obj.DeepCopyObject()
 	objKey := types.NamespacedName{
 		Name:      obj.GetName(),
@@ -678,17 +761,108 @@ func (r *AksAppReconciler) processUnstructuredObject(ctx context.Context, app *d
 			err = r.Patch(ctx, obj, client.Merge)
 		}
 	}
+	return err
+}
 
-	if err != nil {
-		logger.Errorf("unable to process %s object %s/%s for aksapp component %s/%s, will retry later...",
-			obj.GetKind(), obj.GetNamespace(), obj.GetName(), app.Namespace, app.Name)
-		return err
+// applyUnstructuredObject applies the object with server-side apply. The
+// fields dropped from the manifest are removed from the object, the fields
+// managed by others, e.g. the replicas set by an HPA, are left untouched
+// unless the manifest sets them too. Such conflicts are reported as
+// errors unless ForceConflicts is set.
+func (r *AksAppReconciler) applyUnstructuredObject(ctx context.Context, app *deployerv1.AksApp,
+	obj *unstructured.Unstructured, logger *logrus.Entry) error {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(obj.GroupVersionKind())
+	objKey := types.NamespacedName{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
 	}
+	if err := r.Get(ctx, objKey, live); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+	} else {
+		// Remove the AksApp owner references not applied, like the merge
+		// patches do, as they may be managed by another field manager
+		if hasStaleAksAppOwnerReferences(live, obj) {
+			logger.Info("remove existing AksApp owner references")
+			if err := r.removeAksAppOwnerReferences(ctx, live, logger); err != nil {
+				logger.Errorf("unable to remove AksApp owner reference from %s object %s/%s for aksapp component %s/%s, %s",
+					obj.GetKind(), obj.GetNamespace(), obj.GetName(), app.Namespace, app.Name, err.Error())
+				return err
+			}
+		}
 
-	logger.Infof("successfully processed %s object %s/%s for aksapp component %s/%s",
+		if err := r.migrateLegacyFieldManagers(ctx, live, obj.GetAPIVersion(), logger); err != nil {
+			return err
+		}
+
+		if isV1Secret(obj) && reflect.DeepEqual(obj.GetAnnotations(), live.GetAnnotations()) {
+			logger.Info("secret annotations remain the same; do not update secret resource version")
+			obj.SetResourceVersion(live.GetResourceVersion())
+			return nil
+		}
+	}
+
+	// An applied configuration must not carry a resource version or managed fields
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+	opts := []client.PatchOption{client.FieldOwner(fieldManager)}
+	if r.ForceConflicts {
+		opts = append(opts, client.ForceOwnership)
+	}
+	logger.Infof("apply %s object %s/%s for aksapp component %s/%s",
 		obj.GetKind(), obj.GetNamespace(), obj.GetName(), app.Namespace, app.Name)
+	err := r.Patch(ctx, obj, client.Apply, opts...)
+	if isApplyConflict(err) {
+		logger.Errorf("conflicts applying %s object %s/%s, set --force-conflicts to take over the fields, %s",
+			obj.GetKind(), obj.GetNamespace(), obj.GetName(), err.Error())
+	}
+	return err
+}
 
-	return nil
+// isApplyConflict checks if a server-side apply failed because fields of the
+// object are managed by others
+func isApplyConflict(err error) bool {
+	var statusErr *apierrors.StatusError
+	if !errors.As(err, &statusErr) || !apierrors.IsConflict(err) || statusErr.ErrStatus.Details == nil {
+		return false
+	}
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			return true
+		}
+	}
+	return false
+}
+
+// objectStatuses returns the apply results of the objects in the manifest
+// order, the objects which were not applied are left out
+func objectStatuses(objs []*unstructured.Unstructured,
+	applyErrs map[*unstructured.Unstructured]error) []deployerv1.ObjectStatus {
+	var statuses []deployerv1.ObjectStatus
+	for _, obj := range objs {
+		err, ok := applyErrs[obj]
+		if !ok {
+			continue
+		}
+		status := deployerv1.ObjectStatus{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			Result:     deployerv1.ApplySucceeded,
+		}
+		if err != nil {
+			status.Result = deployerv1.ApplyFailed
+			if isApplyConflict(err) {
+				status.Result = deployerv1.ApplyConflict
+			}
+			status.Message = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
 }
 
 func (r *AksAppReconciler) generationChangedPeriodicPredicate(e event.UpdateEvent) bool {
@@ -710,6 +884,18 @@ func (r *AksAppReconciler) generationChangedPeriodicPredicate(e event.UpdateEven
 		return true
 	}
 
+	if e.MetaNew.GetDeletionTimestamp() != nil {
+		r.Logger.Infof("Object is being deleted")
+		return true
+	}
+
+	// The content of the version was overwritten, the spec is the same
+	if e.MetaNew.GetAnnotations()[deployerv1.ConfigDigestAnnotationKey] !=
+		e.MetaOld.GetAnnotations()[deployerv1.ConfigDigestAnnotationKey] {
+		r.Logger.Infof("Object configuration digest gets updated")
+		return true
+	}
+
 	aksApp := &deployerv1.AksApp{}
 	if utmp, err := runtime.DefaultUnstructuredConverter.ToUnstructured(e.ObjectOld); err != nil {
 		r.Logger.Infof("unable to convert object %s/%s to unstructured, %s",
@@ -907,41 +1093,47 @@ func (r *AksAppReconciler) updateRolloutStatus(app *deployerv1.AksApp,
 	var replicas int32
 	var unavailableReplicas int32
 
-	// Collect rollout status from all Deployments
-	// TODO: collect rollout status from DaemonSets
+	// Collect rollout status from all workloads, a failed workload fails the
+	// rollout and an incomplete one keeps it in progress
 	for _, obj := range objs {
-		// Check if the resource is Deployment
-		if isAppsV1Deployment(obj) {
-			var deployment appsv1.Deployment
-			namespacedName := types.NamespacedName{
-				Name:      obj.GetName(),
-				Namespace: obj.GetNamespace(),
-			}
+		rollout, err := r.workloadRollout(ctx, obj)
+		if err != nil {
+			logger.Errorf("unable to get %s %s/%s, %s",
+				strings.ToLower(obj.GetKind()), obj.GetNamespace(), obj.GetName(), err.Error())
+			return err
+		}
+		if rollout == nil {
+			continue
+		}
 
-			// Get the Deployment
-			if err := r.Get(ctx, namespacedName, &deployment); err != nil {
-				logger.Errorf("unable to get deployment %s, %s",
-					namespacedName, err.Error())
-				return err
+		switch rollout.Rollout {
+		case deployerv1.RolloutFailed:
+			rolloutStatus = deployerv1.RolloutFailed
+			logger.Warnf("%s %s/%s failed", strings.ToLower(rollout.Kind), obj.GetNamespace(), rollout.Name)
+		case deployerv1.RolloutInProgress:
+			if rolloutStatus != deployerv1.RolloutFailed {
+				rolloutStatus = deployerv1.RolloutInProgress
 			}
+			logger.Warnf("%s %s/%s is not complete", strings.ToLower(rollout.Kind), obj.GetNamespace(), rollout.Name)
+		}
+		replicas += rollout.Replicas
+		unavailableReplicas += rollout.UnavailableReplicas
 
-			// Check the rollout status and collect replica numbers
-			singleRolloutstatus := deployerv1.RolloutCompleted
-			if !DeploymentComplete(&deployment) {
-				singleRolloutstatus = deployerv1.RolloutInProgress
-				rolloutStatus = deployerv1.RolloutInProgress
-				logger.Warnf("deployment %s is not complete", namespacedName)
+		// Append the information
+		rollouts = append(rollouts, *rollout)
+	}
+
+	// Fail the rollout not complete within the rollout timeout
+	updateRolloutStartTime(app, rolloutStatus)
+	rolloutStatus = timeoutRollouts(app, rollouts, rolloutStatus, logger)
+
+	// Count the failed workloads once when the rollout fails
+	if rolloutStatus == deployerv1.RolloutFailed && app.Status.Rollout != deployerv1.RolloutFailed {
+		for _, rollout := range rollouts {
+			if rollout.Rollout == deployerv1.RolloutFailed {
+				rolloutFailuresVec.WithLabelValues(app.Namespace, app.Name, app.Spec.Type,
+					rollout.Kind, rollout.Name).Inc()
 			}
-			replicas += deployment.Status.Replicas
-			unavailableReplicas += deployment.Status.UnavailableReplicas
-
-			// Append the information
-			rollouts = append(rollouts, deployerv1.Rollout{
-				Name:                deployment.Name,
-				Replicas:            deployment.Status.Replicas,
-				Rollout:             singleRolloutstatus,
-				UnavailableReplicas: deployment.Status.UnavailableReplicas,
-			})
 		}
 	}
 
@@ -965,7 +1157,8 @@ func (r *AksAppReconciler) updateFailedReconciliation(app deployerv1.AksApp,
 	// log release result
 	r.logReleaseResult(app, resultFailed, reason, logger)
 
-	// update askapp reconciliation status
+	// update askapp reconciliation status, keep the apply results of the objects,
+	// the inventory to prune and the start time of the rollout in progress
 	app.Status = deployerv1.AksAppStatus{
 		Reconciliation: deployerv1.Reconciliation{
 			LastReconcileTime: metav1.Now(),
@@ -973,6 +1166,9 @@ func (r *AksAppReconciler) updateFailedReconciliation(app deployerv1.AksApp,
 			OperationID:       operationID,
 			Result:            deployerv1.ReconciliationFailed,
 		},
+		Objects:          app.Status.Objects,
+		Inventory:        app.Status.Inventory,
+		RolloutStartTime: app.Status.RolloutStartTime,
 	}
 
 	ctx := context.TODO()
@@ -987,9 +1183,6 @@ func (r *AksAppReconciler) updateFailedReconciliation(app deployerv1.AksApp,
 func (r *AksAppReconciler) updateSucceededReconciliation(app *deployerv1.AksApp,
 	objs []*unstructured.Unstructured,
 	operationID string, logger *logrus.Entry) error {
-	// log release result
-	r.logReleaseResult(*app, resultSucceeded, "", logger)
-
 	// update aksapp reconciliation status
 	app.Status.Reconciliation = deployerv1.Reconciliation{
 		LastReconcileTime: metav1.Now(),
@@ -1004,6 +1197,13 @@ func (r *AksAppReconciler) updateSucceededReconciliation(app *deployerv1.AksApp,
 		return err
 	}
 
+	// log release result, a failed rollout fails the release
+	if app.Status.Rollout == deployerv1.RolloutFailed {
+		r.logReleaseResult(*app, resultFailed, rolloutFailureReason(app.Status.Rollouts), logger)
+	} else {
+		r.logReleaseResult(*app, resultSucceeded, "", logger)
+	}
+
 	ctx := context.TODO()
 	if err := r.Status().Update(ctx, app); err != nil {
 		logger.Errorf("unable to update aksapp status, %s", err.Error())
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+var _ = Describe("Test objectStatuses", func() {
+	newObject := func(apiVersion, kind, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace("test-namespace")
+		obj.SetName(name)
+		return obj
+	}
+
+	It("Test apply results in the manifest order", func() {
+		deployment := newObject("apps/v1", "Deployment", "test-deployment")
+		secret := newObject("v1", "Secret", "test-secret")
+		service := newObject("v1", "Service", "test-service")
+		conflict := apierrors.NewApplyConflict([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "kube-controller-manager"`,
+			Field:   ".spec.replicas",
+		}}, "Apply failed with 1 conflict")
+
+		statuses := objectStatuses([]*unstructured.Unstructured{deployment, secret, service},
+			map[*unstructured.Unstructured]error{
+				secret:     nil,
+				deployment: conflict,
+			})
+		Expect(statuses).To(Equal([]deployerv1.ObjectStatus{
+			{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Namespace:  "test-namespace",
+				Name:       "test-deployment",
+				Result:     deployerv1.ApplyConflict,
+				Message:    conflict.Error(),
+			},
+			{
+				APIVersion: "v1",
+				Kind:       "Secret",
+				Namespace:  "test-namespace",
+				Name:       "test-secret",
+				Result:     deployerv1.ApplySucceeded,
+			},
+		}))
+	})
+
+	It("Test only field manager conflicts are apply conflicts", func() {
+		Expect(isApplyConflict(apierrors.NewConflict(schema.GroupResource{Resource: "deployments"},
+			"test-deployment", errors.New("the object has been modified")))).To(BeFalse())
+		Expect(isApplyConflict(errors.New("conflict"))).To(BeFalse())
+		Expect(isApplyConflict(nil)).To(BeFalse())
+	})
+})
@@ -70,7 +70,16 @@ func (r *ConfigMapReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	log.Info("Parse the configuration data")
 	// 2. Parse the configuration data
-	objs, err := configmaps.ParseConfig(log, r.Scheme, cm.Data["config"])
+	data, err := configmaps.GetConfigData(&cm, func(name string) (*corev1.ConfigMap, error) {
+		var chunk corev1.ConfigMap
+		err := r.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: name}, &chunk)
+		return &chunk, err
+	})
+	if err != nil {
+		log.Errorf("unable to read cluster configuration, %s", err.Error())
+		return ctrl.Result{}, err
+	}
+	objs, err := configmaps.ParseConfig(log, r.Scheme, data)
 	if err != nil {
 		log.Errorf("unable to parse cluster configuration, %s", err.Error())
 		return ctrl.Result{}, err
@@ -119,8 +128,10 @@ func (r *ConfigMapReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				continue
 			}
 		} else {
-			// 3.2 Update CRD if version does not match
-			if !reflect.DeepEqual(tmpApp.Spec, app.Spec) {
+			// 3.2 Update CRD if version does not match or the content of the
+			// version was overwritten
+			if !reflect.DeepEqual(tmpApp.Spec, app.Spec) ||
+				tmpApp.Annotations[deployerv1.ConfigDigestAnnotationKey] != app.Annotations[deployerv1.ConfigDigestAnnotationKey] {
 				app.ObjectMeta.ResourceVersion = tmpApp.ObjectMeta.ResourceVersion // metadata.resourceVersion must be specified for an update
 				if err = r.Update(ctx, app); err != nil {
 					log.Errorf("unable to update aksapp component, %s", err.Error())
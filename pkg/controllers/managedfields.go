@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+
+	"github.com/sirupsen/logrus"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+// defaultUpdateFieldManager returns the field manager the API server records
+// for the creates, updates and merge patches of the deployer, the prefix of
+// its user agent
+func defaultUpdateFieldManager() string {
+	return strings.SplitN(rest.DefaultKubernetesUserAgent(), "/", 2)[0]
+}
+
+// migrateManagedFields hands the fields the deployer set with creates, updates
+// and merge patches under one of the legacy field managers over to the
+// aks-deployer field manager, as if they had been applied. Otherwise the first
+// server-side apply of an object written before conflicts with the deployer's
+// own fields. Objects already applied once are left untouched. It returns
+// whether the managed fields of the object changed.
+func migrateManagedFields(obj *unstructured.Unstructured, apiVersion string, legacyManagers []string) (bool, error) {
+	entries := obj.GetManagedFields()
+	for _, entry := range entries {
+		if entry.Manager == fieldManager && entry.Operation == metav1.ManagedFieldsOperationApply {
+			return false, nil
+		}
+	}
+
+	var fields map[string]interface{}
+	var migrated []metav1.ManagedFieldsEntry
+	for _, entry := range entries {
+		// Field sets are only comparable within an API version, the fields of
+		// other versions are left to --force-conflicts
+		if entry.Operation != metav1.ManagedFieldsOperationUpdate || entry.APIVersion != apiVersion ||
+			!containsString(legacyManagers, entry.Manager) {
+			migrated = append(migrated, entry)
+			continue
+		}
+		set := make(map[string]interface{})
+		if entry.FieldsV1 != nil && len(entry.FieldsV1.Raw) > 0 {
+			if err := json.Unmarshal(entry.FieldsV1.Raw, &set); err != nil {
+				return false, err
+			}
+		}
+		fields = mergeFieldSets(fields, set)
+	}
+	if fields == nil {
+		return false, nil
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return false, err
+	}
+	now := metav1.Now()
+	migrated = append(migrated, metav1.ManagedFieldsEntry{
+		Manager:    fieldManager,
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: apiVersion,
+		Time:       &now,
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: raw},
+	})
+	obj.SetManagedFields(migrated)
+	return true, nil
+}
+
+// mergeFieldSets returns the union of two FieldsV1 field sets
+func mergeFieldSets(a, b map[string]interface{}) map[string]interface{} {
+	if a == nil {
+		a = make(map[string]interface{})
+	}
+	for key, value := range b {
+		child, ok := value.(map[string]interface{})
+		if !ok {
+			a[key] = value
+			continue
+		}
+		existing, _ := a[key].(map[string]interface{})
+		a[key] = mergeFieldSets(existing, child)
+	}
+	return a
+}
+
+// migrateLegacyFieldManagers migrates the fields of an object written before
+// server-side apply to the aks-deployer field manager
+func (r *AksAppReconciler) migrateLegacyFieldManagers(ctx context.Context, live *unstructured.Unstructured,
+	apiVersion string, logger *logrus.Entry) error {
+	migrated, err := migrateManagedFields(live, apiVersion, r.LegacyFieldManagers)
+	if err != nil {
+		logger.Errorf("unable to read the managed fields of %s object %s/%s, %s",
+			live.GetKind(), live.GetNamespace(), live.GetName(), err.Error())
+		return err
+	}
+	if !migrated {
+		return nil
+	}
+
+	if err = r.Update(ctx, live); err != nil {
+		logger.Errorf("unable to migrate the managed fields of %s object %s/%s to field manager %s, %s",
+			live.GetKind(), live.GetNamespace(), live.GetName(), fieldManager, err.Error())
+		return err
+	}
+	logger.Infof("migrated the managed fields of %s object %s/%s to field manager %s",
+		live.GetKind(), live.GetNamespace(), live.GetName(), fieldManager)
+	return nil
+}
+
+// hasStaleAksAppOwnerReferences checks if the live object has AksApp owner
+// references the object applied does not set
+func hasStaleAksAppOwnerReferences(live, obj *unstructured.Unstructured) bool {
+	applied := make(map[string]bool)
+	for _, ref := range obj.GetOwnerReferences() {
+		applied[string(ref.UID)] = true
+	}
+	for _, ref := range live.GetOwnerReferences() {
+		if ref.Kind == deployerv1.AksAppKindStr && !applied[string(ref.UID)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test migrateManagedFields", func() {
+	var (
+		obj *unstructured.Unstructured
+	)
+
+	entry := func(manager string, operation metav1.ManagedFieldsOperationType, apiVersion, fields string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{
+			Manager:    manager,
+			Operation:  operation,
+			APIVersion: apiVersion,
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(fields)},
+		}
+	}
+
+	fieldSet := func(e metav1.ManagedFieldsEntry) map[string]interface{} {
+		set := make(map[string]interface{})
+		Expect(json.Unmarshal(e.FieldsV1.Raw, &set)).To(Succeed())
+		return set
+	}
+
+	BeforeEach(func() {
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion("apps/v1")
+		obj.SetKind("Deployment")
+		obj.SetNamespace("test-namespace")
+		obj.SetName("test-deployment")
+	})
+
+	It("Test fields of the legacy field managers are migrated on the upgrade", func() {
+		obj.SetManagedFields([]metav1.ManagedFieldsEntry{
+			entry("operator", metav1.ManagedFieldsOperationUpdate, "apps/v1",
+				`{"f:metadata":{"f:annotations":{".":{},"f:deployer.aks.io/owner":{}}},"f:spec":{"f:replicas":{}}}`),
+			entry("operator", metav1.ManagedFieldsOperationUpdate, "apps/v1",
+				`{"f:spec":{"f:template":{"f:spec":{"f:containers":{}}}}}`),
+			entry("kube-controller-manager", metav1.ManagedFieldsOperationUpdate, "apps/v1",
+				`{"f:status":{"f:replicas":{}}}`),
+			entry("operator", metav1.ManagedFieldsOperationUpdate, "extensions/v1beta1",
+				`{"f:spec":{"f:paused":{}}}`),
+		})
+
+		migrated, err := migrateManagedFields(obj, "apps/v1", []string{"operator"})
+		Expect(err).To(BeNil())
+		Expect(migrated).To(BeTrue())
+
+		entries := obj.GetManagedFields()
+		Expect(entries).To(HaveLen(3))
+		Expect(entries[0].Manager).To(Equal("kube-controller-manager"))
+		Expect(entries[1].APIVersion).To(Equal("extensions/v1beta1"))
+		Expect(entries[2].Manager).To(Equal(fieldManager))
+		Expect(entries[2].Operation).To(Equal(metav1.ManagedFieldsOperationApply))
+		Expect(entries[2].APIVersion).To(Equal("apps/v1"))
+		Expect(fieldSet(entries[2])).To(Equal(map[string]interface{}{
+			"f:metadata": map[string]interface{}{
+				"f:annotations": map[string]interface{}{".": map[string]interface{}{}, "f:deployer.aks.io/owner": map[string]interface{}{}},
+			},
+			"f:spec": map[string]interface{}{
+				"f:replicas": map[string]interface{}{},
+				"f:template": map[string]interface{}{
+					"f:spec": map[string]interface{}{"f:containers": map[string]interface{}{}},
+				},
+			},
+		}))
+	})
+
+	It("Test objects already applied are not migrated again", func() {
+		entries := []metav1.ManagedFieldsEntry{
+			entry(fieldManager, metav1.ManagedFieldsOperationApply, "apps/v1", `{"f:spec":{"f:replicas":{}}}`),
+			entry("operator", metav1.ManagedFieldsOperationUpdate, "apps/v1", `{"f:metadata":{"f:labels":{}}}`),
+		}
+		obj.SetManagedFields(entries)
+
+		migrated, err := migrateManagedFields(obj, "apps/v1", []string{"operator"})
+		Expect(err).To(BeNil())
+		Expect(migrated).To(BeFalse())
+		Expect(obj.GetManagedFields()).To(Equal(entries))
+	})
+
+	It("Test objects without fields of the legacy field managers are not migrated", func() {
+		obj.SetManagedFields([]metav1.ManagedFieldsEntry{
+			entry("kubectl", metav1.ManagedFieldsOperationUpdate, "apps/v1", `{"f:spec":{"f:replicas":{}}}`),
+		})
+
+		migrated, err := migrateManagedFields(obj, "apps/v1", []string{"operator"})
+		Expect(err).To(BeNil())
+		Expect(migrated).To(BeFalse())
+	})
+
+	It("Test migrateLegacyFieldManagers updates objects written before server-side apply", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		obj.SetManagedFields([]metav1.ManagedFieldsEntry{
+			entry(defaultUpdateFieldManager(), metav1.ManagedFieldsOperationUpdate, "apps/v1",
+				`{"f:spec":{"f:replicas":{}}}`),
+		})
+		logger := log.New("test-service", "test-version")
+		reconciler := NewAksAppReconciler(fake.NewFakeClientWithScheme(scheme, obj.DeepCopy()),
+			logger, scheme, "deployer", false)
+		reconciler.UseServerSideApply = true
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+		key := types.NamespacedName{Namespace: "test-namespace", Name: "test-deployment"}
+		Expect(reconciler.Get(context.Background(), key, live)).To(Succeed())
+		Expect(reconciler.migrateLegacyFieldManagers(context.Background(), live, "apps/v1", logger)).To(Succeed())
+
+		Expect(reconciler.Get(context.Background(), key, live)).To(Succeed())
+		entries := live.GetManagedFields()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Manager).To(Equal(fieldManager))
+		Expect(entries[0].Operation).To(Equal(metav1.ManagedFieldsOperationApply))
+	})
+
+	It("Test hasStaleAksAppOwnerReferences", func() {
+		live := obj.DeepCopy()
+		live.SetOwnerReferences([]metav1.OwnerReference{
+			{Kind: deployerv1.AksAppKindStr, Name: "test-app", UID: "uid-1"},
+			{Kind: "ReplicaSet", Name: "test-rs", UID: "uid-2"},
+		})
+		Expect(hasStaleAksAppOwnerReferences(live, obj)).To(BeTrue())
+
+		obj.SetOwnerReferences([]metav1.OwnerReference{
+			{Kind: deployerv1.AksAppKindStr, Name: "test-app", UID: "uid-1"},
+		})
+		Expect(hasStaleAksAppOwnerReferences(live, obj)).To(BeFalse())
+	})
+})
@@ -59,6 +59,22 @@ var (
 		},
 	)
 
+	rolloutFailuresVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of failed rollouts of AksApp workloads",
+			Name:      "rollout_failures",
+			Namespace: "deployer",
+			Subsystem: "deployer",
+		},
+		[]string{
+			"namespace",
+			"name",
+			"type",
+			"kind",
+			"workload",
+		},
+	)
+
 	releaseResultVec = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Help:      "The result of aksapp release",
@@ -81,4 +97,5 @@ func init() {
 	prometheus.MustRegister(unavailableReplicasVec)
 	prometheus.MustRegister(allReplicasVec)
 	prometheus.MustRegister(releaseResultVec)
+	prometheus.MustRegister(rolloutFailuresVec)
 }
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+// objectReferences returns the inventory of the objects of an AksApp
+func objectReferences(objs []*unstructured.Unstructured) []deployerv1.ObjectReference {
+	refs := make([]deployerv1.ObjectReference, 0, len(objs))
+	for _, obj := range objs {
+		refs = append(refs, deployerv1.ObjectReference{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+	return refs
+}
+
+// inventoryKey identifies an object of an inventory regardless of its API
+// version, an object moved to another version of its group is the same object
+func inventoryKey(ref deployerv1.ObjectReference) string {
+	gk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind).GroupKind()
+	return gk.String() + "/" + ref.Namespace + "/" + ref.Name
+}
+
+// isOwnedBy checks if the object belongs to the AksApp, by its owner
+// annotation or else by an owner reference to the AksApp
+func isOwnedBy(obj *unstructured.Unstructured, app *deployerv1.AksApp) bool {
+	nn := types.NamespacedName{
+		Namespace: app.Namespace,
+		Name:      app.Name,
+	}
+	if val, ok := obj.GetAnnotations()[ownerAnnotation]; ok {
+		return val == nn.String() || val == nn.Name
+	}
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == deployerv1.AksAppKindStr && ref.UID == app.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneObjects deletes the objects of the previous inventory of the AksApp
+// which are not in the new one. It returns the objects which could not be
+// pruned, they are kept in the inventory to be pruned by the next reconciliation.
+func (r *AksAppReconciler) pruneObjects(ctx context.Context, app *deployerv1.AksApp,
+	inventory []deployerv1.ObjectReference, logger *logrus.Entry) []deployerv1.ObjectReference {
+	current := make(map[string]bool)
+	for _, ref := range inventory {
+		current[inventoryKey(ref)] = true
+	}
+
+	var failed []deployerv1.ObjectReference
+	for _, ref := range app.Status.Inventory {
+		if current[inventoryKey(ref)] {
+			continue
+		}
+		if err := r.pruneObject(ctx, app, ref, logger); err != nil {
+			logger.Errorf("unable to prune %s object %s/%s for aksapp component %s/%s, will retry later, %s",
+				ref.Kind, ref.Namespace, ref.Name, app.Namespace, app.Name, err.Error())
+			failed = append(failed, ref)
+		}
+	}
+	return failed
+}
+
+// pruneObject deletes an object removed from the configuration of the AksApp.
+// Objects owned by another AksApp or annotated with deployer.aks.io/prune:
+// "false" are left untouched.
+func (r *AksAppReconciler) pruneObject(ctx context.Context, app *deployerv1.AksApp,
+	ref deployerv1.ObjectReference, logger *logrus.Entry) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+	objKey := types.NamespacedName{
+		Name:      ref.Name,
+		Namespace: ref.Namespace,
+	}
+	if err := r.Get(ctx, objKey, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if meta.IsNoMatchError(err) {
+			logger.Warnf("%s %s is no longer served, skip pruning object %s", ref.APIVersion, ref.Kind, objKey)
+			return nil
+		}
+		return err
+	}
+
+	if !isOwnedBy(obj, app) {
+		logger.Infof("skip pruning %s object %s not owned by aksapp %s/%s",
+			ref.Kind, objKey, app.Namespace, app.Name)
+		return nil
+	}
+	if strings.EqualFold(obj.GetAnnotations()[deployerv1.PruneAnnotationKey], "false") {
+		logger.Infof("skip pruning %s object %s as %s annotation is set as 'false'",
+			ref.Kind, objKey, deployerv1.PruneAnnotationKey)
+		return nil
+	}
+
+	logger.Infof("prune %s object %s removed from aksapp component %s/%s",
+		ref.Kind, objKey, app.Namespace, app.Name)
+	if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil &&
+		!apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test pruneObjects", func() {
+	var (
+		app        *deployerv1.AksApp
+		reconciler *AksAppReconciler
+	)
+
+	newConfigMap := func(name string, annotations map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "test-namespace",
+				Annotations: annotations,
+			},
+		}
+	}
+	configMapRef := func(name string) deployerv1.ObjectReference {
+		return deployerv1.ObjectReference{APIVersion: "v1", Kind: "ConfigMap", Namespace: "test-namespace", Name: name}
+	}
+	exists := func(name string) bool {
+		err := reconciler.Get(context.Background(),
+			types.NamespacedName{Namespace: "test-namespace", Name: name}, &corev1.ConfigMap{})
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).To(BeNil())
+		return true
+	}
+
+	BeforeEach(func() {
+		app = &deployerv1.AksApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-a", Namespace: "deployer", UID: "app-a-uid"},
+		}
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		owned := map[string]string{ownerAnnotation: "deployer/app-a"}
+		referenced := newConfigMap("referenced", nil)
+		referenced.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: deployerv1.GroupVersion.String(),
+			Kind:       deployerv1.AksAppKindStr,
+			Name:       "app-a",
+			UID:        "app-a-uid",
+		}}
+		reconciler = NewAksAppReconciler(fake.NewFakeClientWithScheme(scheme,
+			newConfigMap("current", owned),
+			newConfigMap("removed", owned),
+			referenced,
+			newConfigMap("other", map[string]string{ownerAnnotation: "deployer/app-b"}),
+			newConfigMap("kept", map[string]string{
+				ownerAnnotation:               "deployer/app-a",
+				deployerv1.PruneAnnotationKey: "false",
+			}),
+		), log.New("test-service", "test-version"), scheme, "deployer", false)
+	})
+
+	It("Test objects removed from the configuration are pruned", func() {
+		app.Status.Inventory = []deployerv1.ObjectReference{
+			configMapRef("current"), configMapRef("removed"), configMapRef("referenced"),
+			configMapRef("other"), configMapRef("kept"), configMapRef("missing"),
+		}
+
+		failed := reconciler.pruneObjects(context.Background(), app,
+			[]deployerv1.ObjectReference{configMapRef("current")}, reconciler.Logger)
+		Expect(failed).To(BeEmpty())
+		Expect(exists("current")).To(BeTrue())
+		Expect(exists("removed")).To(BeFalse())
+		Expect(exists("referenced")).To(BeFalse())
+		Expect(exists("other")).To(BeTrue())
+		Expect(exists("kept")).To(BeTrue())
+	})
+
+	It("Test objects moved to another API version are not pruned", func() {
+		app.Status.Inventory = []deployerv1.ObjectReference{
+			{APIVersion: "extensions/v1beta1", Kind: "Deployment", Namespace: "test-namespace", Name: "test-deployment"},
+		}
+
+		failed := reconciler.pruneObjects(context.Background(), app, []deployerv1.ObjectReference{
+			{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "test-namespace", Name: "test-deployment"},
+		}, reconciler.Logger)
+		Expect(failed).To(BeEmpty())
+	})
+})
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/sirupsen/logrus"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+var (
+	deploymentGVK  = schema.GroupVersionKind{Kind: "Deployment", Version: "v1", Group: "apps"}
+	daemonSetGVK   = schema.GroupVersionKind{Kind: "DaemonSet", Version: "v1", Group: "apps"}
+	statefulSetGVK = schema.GroupVersionKind{Kind: "StatefulSet", Version: "v1", Group: "apps"}
+	jobGVK         = schema.GroupVersionKind{Kind: "Job", Version: "v1", Group: "batch"}
+)
+
+// workloadRollout returns the rollout of the workload, or nil if the object is
+// not a workload
+func (r *AksAppReconciler) workloadRollout(ctx context.Context,
+	obj *unstructured.Unstructured) (*deployerv1.Rollout, error) {
+	namespacedName := types.NamespacedName{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+	rollout := &deployerv1.Rollout{
+		Kind:    obj.GetKind(),
+		Name:    obj.GetName(),
+		Rollout: deployerv1.RolloutCompleted,
+	}
+
+	switch obj.GroupVersionKind() {
+	case deploymentGVK:
+		var deployment appsv1.Deployment
+		if err := r.Get(ctx, namespacedName, &deployment); err != nil {
+			return nil, err
+		}
+		if DeploymentFailed(&deployment) {
+			condition := GetDeploymentCondition(&deployment, appsv1.DeploymentProgressing)
+			rollout.Rollout = deployerv1.RolloutFailed
+			rollout.Message = fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		} else if !DeploymentComplete(&deployment) {
+			rollout.Rollout = deployerv1.RolloutInProgress
+		}
+		rollout.Replicas = deployment.Status.Replicas
+		rollout.UnavailableReplicas = deployment.Status.UnavailableReplicas
+	case daemonSetGVK:
+		var daemonSet appsv1.DaemonSet
+		if err := r.Get(ctx, namespacedName, &daemonSet); err != nil {
+			return nil, err
+		}
+		if !DaemonSetComplete(&daemonSet) {
+			rollout.Rollout = deployerv1.RolloutInProgress
+		}
+		rollout.Replicas = daemonSet.Status.DesiredNumberScheduled
+		rollout.UnavailableReplicas = daemonSet.Status.NumberUnavailable
+	case statefulSetGVK:
+		var statefulSet appsv1.StatefulSet
+		if err := r.Get(ctx, namespacedName, &statefulSet); err != nil {
+			return nil, err
+		}
+		if !StatefulSetComplete(&statefulSet) {
+			rollout.Rollout = deployerv1.RolloutInProgress
+		}
+		rollout.Replicas = statefulSet.Status.Replicas
+		if statefulSet.Status.Replicas > statefulSet.Status.ReadyReplicas {
+			rollout.UnavailableReplicas = statefulSet.Status.Replicas - statefulSet.Status.ReadyReplicas
+		}
+	case jobGVK:
+		var job batchv1.Job
+		if err := r.Get(ctx, namespacedName, &job); err != nil {
+			return nil, err
+		}
+		if JobFailed(&job) {
+			condition := GetJobCondition(&job, batchv1.JobFailed)
+			rollout.Rollout = deployerv1.RolloutFailed
+			rollout.Message = fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		} else if !JobComplete(&job) {
+			rollout.Rollout = deployerv1.RolloutInProgress
+		}
+		rollout.Replicas = job.Status.Active
+	default:
+		return nil, nil
+	}
+	return rollout, nil
+}
+
+// rolloutTimeout returns the rollout timeout of the AksApp set by the
+// deployer.aks.io/rollout-timeout annotation, or 0 without timeout
+func rolloutTimeout(app *deployerv1.AksApp, logger *logrus.Entry) time.Duration {
+	value, ok := app.Annotations[deployerv1.RolloutTimeoutAnnotationKey]
+	if !ok {
+		return 0
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		logger.Warnf("invalid %s annotation %q on aksapp %s/%s, ignore it",
+			deployerv1.RolloutTimeoutAnnotationKey, value, app.Namespace, app.Name)
+		return 0
+	}
+	return timeout
+}
+
+// timeoutRollouts fails the rollouts in progress of the AksApp once its
+// rollout timeout is exceeded, it returns the new rollout status
+func timeoutRollouts(app *deployerv1.AksApp, rollouts []deployerv1.Rollout,
+	rolloutStatus deployerv1.RolloutStatus, logger *logrus.Entry) deployerv1.RolloutStatus {
+	timeout := rolloutTimeout(app, logger)
+	if timeout == 0 || app.Status.RolloutStartTime == nil ||
+		time.Since(app.Status.RolloutStartTime.Time) < timeout {
+		return rolloutStatus
+	}
+
+	for i := range rollouts {
+		if rollouts[i].Rollout == deployerv1.RolloutInProgress {
+			rollouts[i].Rollout = deployerv1.RolloutFailed
+			rollouts[i].Message = fmt.Sprintf("RolloutTimeout: not complete within %s", timeout)
+			rolloutStatus = deployerv1.RolloutFailed
+		}
+	}
+	return rolloutStatus
+}
+
+// updateRolloutStartTime records the start of a new rollout of the AksApp, i.e.
+// of a new version or after the previous rollout completed
+func updateRolloutStartTime(app *deployerv1.AksApp, rolloutStatus deployerv1.RolloutStatus) {
+	switch {
+	case rolloutStatus == deployerv1.RolloutCompleted:
+		app.Status.RolloutStartTime = nil
+	case app.Status.RolloutStartTime == nil,
+		app.Status.Rollout == deployerv1.RolloutCompleted,
+		app.Status.RolloutVersion != "" && app.Status.RolloutVersion != app.Spec.Version:
+		now := metav1.Now()
+		app.Status.RolloutStartTime = &now
+	}
+}
+
+// rolloutFailureReason returns the failed workloads of the rollout and why
+// they failed
+func rolloutFailureReason(rollouts []deployerv1.Rollout) string {
+	var reasons []string
+	for _, rollout := range rollouts {
+		if rollout.Rollout == deployerv1.RolloutFailed {
+			reasons = append(reasons, fmt.Sprintf("%s %s failed, %s", rollout.Kind, rollout.Name, rollout.Message))
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
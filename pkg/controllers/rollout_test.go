@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test updateRolloutStatus", func() {
+	var (
+		app         *deployerv1.AksApp
+		deployment  *appsv1.Deployment
+		daemonSet   *appsv1.DaemonSet
+		statefulSet *appsv1.StatefulSet
+		job         *batchv1.Job
+	)
+
+	objectMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "test-namespace"}
+	}
+	newObject := func(apiVersion, kind, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace("test-namespace")
+		obj.SetName(name)
+		return obj
+	}
+	objs := []*unstructured.Unstructured{
+		newObject("apps/v1", "Deployment", "test-deployment"),
+		newObject("apps/v1", "DaemonSet", "test-daemonset"),
+		newObject("apps/v1", "StatefulSet", "test-statefulset"),
+		newObject("batch/v1", "Job", "test-job"),
+		newObject("v1", "ConfigMap", "test-configmap"),
+	}
+	newReconciler := func() *AksAppReconciler {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(deployerv1.AddToScheme(scheme)).To(Succeed())
+		return NewAksAppReconciler(fake.NewFakeClientWithScheme(scheme, app, deployment, daemonSet, statefulSet, job),
+			log.New("test-service", "test-version"), scheme, "deployer", false)
+	}
+	updateRolloutStatus := func() {
+		reconciler := newReconciler()
+		Expect(reconciler.updateRolloutStatus(app, objs, reconciler.Logger)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		app = &deployerv1.AksApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-a", Namespace: "deployer"},
+			Spec:       deployerv1.AksAppSpec{Type: "test-type", Version: "1.0.0"},
+		}
+		replicas := int32(2)
+		deployment = &appsv1.Deployment{
+			ObjectMeta: objectMeta("test-deployment"),
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status: appsv1.DeploymentStatus{
+				Replicas:          2,
+				UpdatedReplicas:   2,
+				AvailableReplicas: 2,
+			},
+		}
+		daemonSet = &appsv1.DaemonSet{
+			ObjectMeta: objectMeta("test-daemonset"),
+			Status: appsv1.DaemonSetStatus{
+				DesiredNumberScheduled: 3,
+				UpdatedNumberScheduled: 3,
+				NumberAvailable:        2,
+				NumberUnavailable:      1,
+			},
+		}
+		statefulSet = &appsv1.StatefulSet{
+			ObjectMeta: objectMeta("test-statefulset"),
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+			Status: appsv1.StatefulSetStatus{
+				Replicas:        2,
+				ReadyReplicas:   2,
+				CurrentRevision: "test-statefulset-1",
+				UpdateRevision:  "test-statefulset-1",
+			},
+		}
+		job = &batchv1.Job{
+			ObjectMeta: objectMeta("test-job"),
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+			},
+		}
+	})
+
+	It("Test rollouts of all workload kinds are collected", func() {
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutInProgress))
+		Expect(app.Status.RolloutStartTime).NotTo(BeNil())
+		Expect(app.Status.Replicas).To(Equal(int32(7)))
+		Expect(app.Status.UnavailableReplicas).To(Equal(int32(1)))
+		Expect(app.Status.Rollouts).To(Equal([]deployerv1.Rollout{
+			{
+				Kind:     "Deployment",
+				Name:     "test-deployment",
+				Replicas: 2,
+				Rollout:  deployerv1.RolloutCompleted,
+			},
+			{
+				Kind:                "DaemonSet",
+				Name:                "test-daemonset",
+				Replicas:            3,
+				UnavailableReplicas: 1,
+				Rollout:             deployerv1.RolloutInProgress,
+			},
+			{
+				Kind:     "StatefulSet",
+				Name:     "test-statefulset",
+				Replicas: 2,
+				Rollout:  deployerv1.RolloutCompleted,
+			},
+			{
+				Kind:    "Job",
+				Name:    "test-job",
+				Rollout: deployerv1.RolloutCompleted,
+			},
+		}))
+
+		daemonSet.Status.NumberAvailable = 3
+		daemonSet.Status.NumberUnavailable = 0
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutCompleted))
+		Expect(app.Status.RolloutStartTime).To(BeNil())
+	})
+
+	It("Test a failed job fails the rollout", func() {
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:    batchv1.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "BackoffLimitExceeded",
+			Message: "Job has reached the specified backoff limit",
+		}}
+
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutFailed))
+		Expect(app.Status.Rollouts[3].Rollout).To(Equal(deployerv1.RolloutFailed))
+		Expect(app.Status.Rollouts[3].Message).To(Equal("BackoffLimitExceeded: Job has reached the specified backoff limit"))
+	})
+
+	It("Test a deployment exceeding its progress deadline fails the rollout once", func() {
+		deployment.Status.AvailableReplicas = 0
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: `ReplicaSet "test-deployment-1" has timed out progressing.`,
+		}}
+		failures := rolloutFailuresVec.WithLabelValues("deployer", "app-a", "test-type", "Deployment", "test-deployment")
+		count := testutil.ToFloat64(failures)
+
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutFailed))
+		Expect(rolloutFailureReason(app.Status.Rollouts)).To(Equal(
+			`Deployment test-deployment failed, ProgressDeadlineExceeded: ReplicaSet "test-deployment-1" has timed out progressing.`))
+		Expect(testutil.ToFloat64(failures)).To(Equal(count + 1))
+
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutFailed))
+		Expect(testutil.ToFloat64(failures)).To(Equal(count + 1))
+	})
+
+	It("Test a rollout not complete within the rollout timeout fails", func() {
+		app.Annotations = map[string]string{deployerv1.RolloutTimeoutAnnotationKey: "10m"}
+		startTime := metav1.NewTime(time.Now().Add(-5 * time.Minute))
+		app.Status.Rollout = deployerv1.RolloutInProgress
+		app.Status.RolloutVersion = "1.0.0"
+		app.Status.RolloutStartTime = &startTime
+
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutInProgress))
+
+		startTime = metav1.NewTime(time.Now().Add(-15 * time.Minute))
+		app.Status.RolloutStartTime = &startTime
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutFailed))
+		Expect(app.Status.RolloutStartTime).To(Equal(&startTime))
+		Expect(app.Status.Rollouts[1].Rollout).To(Equal(deployerv1.RolloutFailed))
+		Expect(app.Status.Rollouts[1].Message).To(Equal("RolloutTimeout: not complete within 10m0s"))
+
+		app.Spec.Version = "1.0.1"
+		updateRolloutStatus()
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutInProgress))
+		Expect(app.Status.RolloutStartTime.After(startTime.Time)).To(BeTrue())
+	})
+
+	It("Test a failed rollout fails the release result", func() {
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:   appsv1.DeploymentProgressing,
+			Status: corev1.ConditionFalse,
+			Reason: "ProgressDeadlineExceeded",
+		}}
+		reconciler := newReconciler()
+
+		Expect(reconciler.updateSucceededReconciliation(app, objs, "test-operation", reconciler.Logger)).To(Succeed())
+		Expect(app.Status.Reconciliation.Result).To(Equal(deployerv1.ReconciliationSucceeded))
+		Expect(app.Status.Rollout).To(Equal(deployerv1.RolloutFailed))
+		Expect(testutil.ToFloat64(releaseResultVec.WithLabelValues("deployer", "app-a", "test-type", resultFailed))).To(Equal(float64(1)))
+		Expect(testutil.ToFloat64(releaseResultVec.WithLabelValues("deployer", "app-a", "test-type", resultSucceeded))).To(Equal(float64(0)))
+	})
+})
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+const (
+	// aksAppFinalizer holds a deleted AksApp until the objects it owns are torn down
+	aksAppFinalizer = annotationPrefix + "/teardown"
+
+	teardownRecheckInterval = 10 * time.Second
+)
+
+var (
+	// teardownPhases are the phases of a teardown in order, the workloads are
+	// deleted first so that their pods never run without their Secrets and
+	// ServiceAccounts
+	teardownPhases = []deployerv1.TeardownPhase{
+		deployerv1.TeardownWorkloads,
+		deployerv1.TeardownResources,
+		deployerv1.TeardownCredentials,
+	}
+
+	// teardownKinds are the kinds searched for objects owned by an AksApp which
+	// has no inventory, i.e. last reconciled before inventories were recorded
+	teardownKinds = []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+		{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+		{Group: "batch", Version: "v1", Kind: "Job"},
+		{Version: "v1", Kind: "Service"},
+		{Version: "v1", Kind: "ConfigMap"},
+		{Version: "v1", Kind: "Secret"},
+		{Version: "v1", Kind: "ServiceAccount"},
+	}
+)
+
+// teardownPhase returns the phase the object is deleted in
+func teardownPhase(obj *unstructured.Unstructured) deployerv1.TeardownPhase {
+	switch obj.GetKind() {
+	case "Deployment", "DaemonSet", "StatefulSet", "ReplicaSet", "Job", "CronJob", "Pod":
+		return deployerv1.TeardownWorkloads
+	case "Secret", "ServiceAccount":
+		return deployerv1.TeardownCredentials
+	default:
+		return deployerv1.TeardownResources
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// deletionPolicy returns the deletion policy of the AksApp, the annotation
+// deployer.aks.io/deletion-policy overrides the policy of the reconciler
+func (r *AksAppReconciler) deletionPolicy(app *deployerv1.AksApp) deployerv1.DeletionPolicy {
+	if value, ok := app.Annotations[deployerv1.DeletionPolicyAnnotationKey]; ok {
+		for _, policy := range []deployerv1.DeletionPolicy{deployerv1.DeletionPolicyDelete, deployerv1.DeletionPolicyOrphan} {
+			if strings.EqualFold(value, string(policy)) {
+				return policy
+			}
+		}
+		r.Logger.Warnf("invalid %s annotation %q on aksapp %s/%s, use %s",
+			deployerv1.DeletionPolicyAnnotationKey, value, app.Namespace, app.Name, r.DeletionPolicy)
+	}
+	return r.DeletionPolicy
+}
+
+// ensureFinalizer adds the teardown finalizer to the AksApp in the annotation
+// ownership mode, and removes it in the owner reference mode where the garbage
+// collector deletes the objects of the AksApp
+func (r *AksAppReconciler) ensureFinalizer(ctx context.Context, app *deployerv1.AksApp,
+	logger *logrus.Entry) error {
+	hasFinalizer := containsString(app.Finalizers, aksAppFinalizer)
+	if r.UseOwnerReference == !hasFinalizer {
+		return nil
+	}
+
+	if r.UseOwnerReference {
+		logger.Infof("remove finalizer %s, objects are deleted with their owner", aksAppFinalizer)
+		app.Finalizers = removeString(app.Finalizers, aksAppFinalizer)
+	} else {
+		logger.Infof("add finalizer %s", aksAppFinalizer)
+		app.Finalizers = append(app.Finalizers, aksAppFinalizer)
+	}
+	return r.Update(ctx, app)
+}
+
+//+kubebuilder:rbac:groups=apps,resources=deployments;daemonsets;statefulsets,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=core,resources=services;configmaps;secrets;serviceaccounts,verbs=get;list;watch;delete
+
+// teardown deletes the objects owned by a deleted AksApp phase by phase
+// following its deletion policy, then releases the AksApp. A phase starts
+// once the objects of the previous one are gone, the progress is recorded in
+// the status of the AksApp.
+func (r *AksAppReconciler) teardown(ctx context.Context, app *deployerv1.AksApp,
+	logger *logrus.Entry) (ctrl.Result, error) {
+	if !containsString(app.Finalizers, aksAppFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	policy := r.deletionPolicy(app)
+	if policy == deployerv1.DeletionPolicyDelete {
+		if len(app.Status.Inventory) == 0 {
+			if err := r.recordTeardownInventory(ctx, app, logger); err != nil {
+				logger.Errorf("unable to search the objects of aksapp %s/%s, %s", app.Namespace, app.Name, err.Error())
+				return ctrl.Result{}, err
+			}
+		}
+		objs, err := r.ownedObjects(ctx, app, logger)
+		if err != nil {
+			logger.Errorf("unable to get the objects of aksapp %s/%s, %s", app.Namespace, app.Name, err.Error())
+			return ctrl.Result{}, err
+		}
+
+		for _, phase := range teardownPhases {
+			var phaseObjs []*unstructured.Unstructured
+			for _, obj := range objs {
+				if teardownPhase(obj) == phase {
+					phaseObjs = append(phaseObjs, obj)
+				}
+			}
+			if len(phaseObjs) == 0 {
+				continue
+			}
+
+			for _, obj := range phaseObjs {
+				if obj.GetDeletionTimestamp() != nil {
+					continue
+				}
+				logger.Infof("delete %s object %s/%s of deleted aksapp %s/%s",
+					obj.GetKind(), obj.GetNamespace(), obj.GetName(), app.Namespace, app.Name)
+				// Foreground deletion keeps the object until its dependents, e.g.
+				// the pods of a workload, are gone
+				if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationForeground)); err != nil &&
+					!apierrors.IsNotFound(err) {
+					logger.Errorf("unable to delete %s object %s/%s, %s",
+						obj.GetKind(), obj.GetNamespace(), obj.GetName(), err.Error())
+					return ctrl.Result{}, err
+				}
+			}
+
+			app.Status.Teardown = &deployerv1.Teardown{
+				Policy:    policy,
+				Phase:     phase,
+				Remaining: int32(len(objs)),
+				Message:   fmt.Sprintf("deleting %d objects in phase %s", len(phaseObjs), phase),
+			}
+			if err := r.Status().Update(ctx, app); err != nil {
+				logger.Errorf("unable to update teardown status, %s", err.Error())
+				return ctrl.Result{}, err
+			}
+			logger.Infof("teardown of aksapp %s/%s: %s", app.Namespace, app.Name, app.Status.Teardown.Message)
+			return ctrl.Result{RequeueAfter: teardownRecheckInterval}, nil
+		}
+	}
+
+	logger.Infof("teardown of aksapp %s/%s with deletion policy %s completed, remove finalizer %s",
+		app.Namespace, app.Name, policy, aksAppFinalizer)
+	app.Finalizers = removeString(app.Finalizers, aksAppFinalizer)
+	if err := r.Update(ctx, app); err != nil {
+		logger.Errorf("unable to remove finalizer, %s", err.Error())
+		return ctrl.Result{}, err
+	}
+	releaseResultVec.DeleteLabelValues(app.Namespace, app.Name, app.Spec.Type, resultSucceeded)
+	releaseResultVec.DeleteLabelValues(app.Namespace, app.Name, app.Spec.Type, resultFailed)
+	return ctrl.Result{}, nil
+}
+
+// recordTeardownInventory searches the objects owned by an AksApp without an
+// inventory, i.e. last reconciled before inventories were recorded, among the
+// objects of teardownKinds. The objects found are recorded as its inventory so
+// the search runs once rather than on every pass of the teardown.
+func (r *AksAppReconciler) recordTeardownInventory(ctx context.Context, app *deployerv1.AksApp,
+	logger *logrus.Entry) error {
+	var objs []*unstructured.Unstructured
+	for _, gvk := range teardownKinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.List(ctx, list); err != nil {
+			return err
+		}
+		for i := range list.Items {
+			if isOwnedBy(&list.Items[i], app) {
+				objs = append(objs, &list.Items[i])
+			}
+		}
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+
+	app.Status.Inventory = objectReferences(objs)
+	if err := r.Status().Update(ctx, app); err != nil {
+		logger.Errorf("unable to record the inventory of aksapp %s/%s, %s", app.Namespace, app.Name, err.Error())
+		return err
+	}
+	logger.Infof("recorded %d objects found for aksapp %s/%s without inventory",
+		len(objs), app.Namespace, app.Name)
+	return nil
+}
+
+// ownedObjects returns the existing objects of the inventory of the AksApp
+// which it owns
+func (r *AksAppReconciler) ownedObjects(ctx context.Context, app *deployerv1.AksApp,
+	logger *logrus.Entry) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	for _, ref := range app.Status.Inventory {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(ref.APIVersion)
+		obj.SetKind(ref.Kind)
+		objKey := types.NamespacedName{
+			Name:      ref.Name,
+			Namespace: ref.Namespace,
+		}
+		if err := r.Get(ctx, objKey, obj); err != nil {
+			if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !isOwnedBy(obj, app) {
+			logger.Infof("skip %s object %s not owned by aksapp %s/%s", ref.Kind, objKey, app.Namespace, app.Name)
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
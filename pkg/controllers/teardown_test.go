@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test teardown", func() {
+	var (
+		ctx        context.Context
+		app        *deployerv1.AksApp
+		reconciler *AksAppReconciler
+	)
+
+	owned := map[string]string{ownerAnnotation: "deployer/app-a"}
+	objectMeta := func(name string, annotations map[string]string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "test-namespace", Annotations: annotations}
+	}
+	exists := func(name string, obj runtime.Object) bool {
+		err := reconciler.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: name}, obj)
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).To(BeNil())
+		return true
+	}
+	getApp := func() *deployerv1.AksApp {
+		Expect(reconciler.Get(ctx, types.NamespacedName{Namespace: "deployer", Name: "app-a"}, app)).To(Succeed())
+		return app
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		now := metav1.Now()
+		app = &deployerv1.AksApp{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "app-a",
+				Namespace:         "deployer",
+				Finalizers:        []string{aksAppFinalizer},
+				DeletionTimestamp: &now,
+			},
+			Status: deployerv1.AksAppStatus{
+				Inventory: []deployerv1.ObjectReference{
+					{APIVersion: "v1", Kind: "Secret", Namespace: "test-namespace", Name: "test-secret"},
+					{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "test-namespace", Name: "test-deployment"},
+					{APIVersion: "v1", Kind: "ConfigMap", Namespace: "test-namespace", Name: "other"},
+				},
+			},
+		}
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(deployerv1.AddToScheme(scheme)).To(Succeed())
+		reconciler = NewAksAppReconciler(fake.NewFakeClientWithScheme(scheme,
+			app,
+			&appsv1.Deployment{ObjectMeta: objectMeta("test-deployment", owned)},
+			&corev1.Secret{ObjectMeta: objectMeta("test-secret", owned)},
+			&corev1.ConfigMap{ObjectMeta: objectMeta("other", map[string]string{ownerAnnotation: "deployer/app-b"})},
+		), log.New("test-service", "test-version"), scheme, "deployer", false)
+	})
+
+	It("Test workloads are deleted before credentials", func() {
+		result, err := reconciler.teardown(ctx, getApp(), reconciler.Logger)
+		Expect(err).To(BeNil())
+		Expect(result.RequeueAfter).To(Equal(teardownRecheckInterval))
+		Expect(exists("test-deployment", &appsv1.Deployment{})).To(BeFalse())
+		Expect(exists("test-secret", &corev1.Secret{})).To(BeTrue())
+		Expect(getApp().Status.Teardown).To(Equal(&deployerv1.Teardown{
+			Policy:    deployerv1.DeletionPolicyDelete,
+			Phase:     deployerv1.TeardownWorkloads,
+			Remaining: 2,
+			Message:   "deleting 1 objects in phase Workloads",
+		}))
+
+		_, err = reconciler.teardown(ctx, getApp(), reconciler.Logger)
+		Expect(err).To(BeNil())
+		Expect(exists("test-secret", &corev1.Secret{})).To(BeFalse())
+		Expect(getApp().Status.Teardown.Phase).To(Equal(deployerv1.TeardownCredentials))
+
+		result, err = reconciler.teardown(ctx, getApp(), reconciler.Logger)
+		Expect(err).To(BeNil())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(getApp().Finalizers).To(BeEmpty())
+		Expect(exists("other", &corev1.ConfigMap{})).To(BeTrue())
+	})
+
+	It("Test objects are left in place with the orphan policy", func() {
+		getApp().Annotations = map[string]string{deployerv1.DeletionPolicyAnnotationKey: "orphan"}
+		Expect(reconciler.Update(ctx, app)).To(Succeed())
+
+		result, err := reconciler.teardown(ctx, getApp(), reconciler.Logger)
+		Expect(err).To(BeNil())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(getApp().Finalizers).To(BeEmpty())
+		Expect(exists("test-deployment", &appsv1.Deployment{})).To(BeTrue())
+	})
+
+	It("Test objects of AksApps without inventory are found by their owner annotation", func() {
+		app := getApp()
+		objs, err := reconciler.ownedObjects(ctx, app, reconciler.Logger)
+		Expect(err).To(BeNil())
+		Expect(objs).To(HaveLen(2))
+
+		app.Status.Inventory = nil
+		Expect(reconciler.Status().Update(ctx, app)).To(Succeed())
+		Expect(reconciler.recordTeardownInventory(ctx, getApp(), reconciler.Logger)).To(Succeed())
+		Expect(getApp().Status.Inventory).To(ConsistOf(
+			deployerv1.ObjectReference{APIVersion: "v1", Kind: "Secret", Namespace: "test-namespace", Name: "test-secret"},
+			deployerv1.ObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "test-namespace", Name: "test-deployment"},
+		))
+		objs, err = reconciler.ownedObjects(ctx, app, reconciler.Logger)
+		Expect(err).To(BeNil())
+		Expect(objs).To(HaveLen(2))
+	})
+
+	It("Test teardown of AksApps without inventory records the objects found", func() {
+		app := getApp()
+		app.Status.Inventory = nil
+		Expect(reconciler.Status().Update(ctx, app)).To(Succeed())
+
+		_, err := reconciler.teardown(ctx, getApp(), reconciler.Logger)
+		Expect(err).To(BeNil())
+		Expect(exists("test-deployment", &appsv1.Deployment{})).To(BeFalse())
+		Expect(getApp().Status.Inventory).To(HaveLen(2))
+		Expect(getApp().Status.Teardown.Phase).To(Equal(deployerv1.TeardownWorkloads))
+	})
+
+	It("Test the finalizer is only used in the annotation ownership mode", func() {
+		app := &deployerv1.AksApp{ObjectMeta: metav1.ObjectMeta{Name: "app-b", Namespace: "deployer"}}
+		Expect(reconciler.Create(ctx, app)).To(Succeed())
+
+		Expect(reconciler.ensureFinalizer(ctx, app, reconciler.Logger)).To(Succeed())
+		Expect(app.Finalizers).To(ConsistOf(aksAppFinalizer))
+
+		reconciler.UseOwnerReference = true
+		Expect(reconciler.ensureFinalizer(ctx, app, reconciler.Logger)).To(Succeed())
+		Expect(app.Finalizers).To(BeEmpty())
+		Expect(reconciler.Get(ctx, client.ObjectKey{Namespace: "deployer", Name: "app-b"}, app)).To(Succeed())
+		Expect(app.Finalizers).To(BeEmpty())
+	})
+})
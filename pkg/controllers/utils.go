@@ -2,8 +2,14 @@ package controllers
 
 import (
 	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
 )
 
+// deploymentProgressDeadlineExceededReason is the reason of the Progressing condition of a
+// deployment which has not progressed within its progress deadline
+const deploymentProgressDeadlineExceededReason = "ProgressDeadlineExceeded"
+
 // DeploymentComplete considers a deployment to be complete once all of its desired replicas
 // are updated and available, and no old pods are running.
 func DeploymentComplete(deployment *apps.Deployment) bool {
@@ -12,3 +18,68 @@ func DeploymentComplete(deployment *apps.Deployment) bool {
 		deployment.Status.Replicas == *(deployment.Spec.Replicas) &&
 		deployment.Status.AvailableReplicas == *(deployment.Spec.Replicas)
 }
+
+// DeploymentFailed considers a deployment to be failed once it has not progressed within
+// its progress deadline, e.g. as its pods are crash looping. The condition of a generation
+// not yet observed by the controller is left out, it is about the previous rollout.
+func DeploymentFailed(deployment *apps.Deployment) bool {
+	condition := GetDeploymentCondition(deployment, apps.DeploymentProgressing)
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		condition != nil && condition.Status == core.ConditionFalse &&
+		condition.Reason == deploymentProgressDeadlineExceededReason
+}
+
+// GetDeploymentCondition returns the condition of the deployment with the given type, or nil.
+func GetDeploymentCondition(deployment *apps.Deployment,
+	conditionType apps.DeploymentConditionType) *apps.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// DaemonSetComplete considers a daemonset to be complete once its pods are updated and
+// available on all the nodes they are scheduled to.
+func DaemonSetComplete(daemonSet *apps.DaemonSet) bool {
+	return daemonSet.Status.ObservedGeneration >= daemonSet.Generation &&
+		daemonSet.Status.UpdatedNumberScheduled == daemonSet.Status.DesiredNumberScheduled &&
+		daemonSet.Status.NumberAvailable == daemonSet.Status.DesiredNumberScheduled
+}
+
+// StatefulSetComplete considers a statefulset to be complete once all of its replicas run
+// the update revision and are ready. The pods of an OnDelete statefulset are only updated
+// once deleted, it is complete once its replicas are ready.
+func StatefulSetComplete(statefulSet *apps.StatefulSet) bool {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *(statefulSet.Spec.Replicas)
+	}
+	onDelete := statefulSet.Spec.UpdateStrategy.Type == apps.OnDeleteStatefulSetStrategyType
+	return statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+		(onDelete || statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision) &&
+		statefulSet.Status.Replicas == replicas &&
+		statefulSet.Status.ReadyReplicas == replicas
+}
+
+// JobComplete considers a job to be complete once it has succeeded.
+func JobComplete(job *batch.Job) bool {
+	return GetJobCondition(job, batch.JobComplete) != nil
+}
+
+// JobFailed considers a job to be failed once it has exceeded its backoff limit or
+// active deadline.
+func JobFailed(job *batch.Job) bool {
+	return GetJobCondition(job, batch.JobFailed) != nil
+}
+
+// GetJobCondition returns the true condition of the job with the given type, or nil.
+func GetJobCondition(job *batch.Job, conditionType batch.JobConditionType) *batch.JobCondition {
+	for i := range job.Status.Conditions {
+		if job.Status.Conditions[i].Type == conditionType && job.Status.Conditions[i].Status == core.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
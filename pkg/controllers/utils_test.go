@@ -5,6 +5,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -61,4 +62,180 @@ var _ = Describe("Test DeploymentComplete", func() {
 		complete := DeploymentComplete(&deployment)
 		Expect(complete).To(BeFalse())
 	})
+
+	It("Test deployment exceeded its progress deadline", func() {
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:   appsv1.DeploymentProgressing,
+			Status: corev1.ConditionFalse,
+			Reason: "ProgressDeadlineExceeded",
+		}}
+
+		Expect(DeploymentFailed(&deployment)).To(BeTrue())
+	})
+
+	It("Test deployment progress deadline of a previous generation", func() {
+		deployment.Generation = 2
+		deployment.Status.ObservedGeneration = 1
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:   appsv1.DeploymentProgressing,
+			Status: corev1.ConditionFalse,
+			Reason: "ProgressDeadlineExceeded",
+		}}
+
+		Expect(DeploymentFailed(&deployment)).To(BeFalse())
+		Expect(DeploymentComplete(&deployment)).To(BeFalse())
+	})
+
+	It("Test deployment progressing", func() {
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:   appsv1.DeploymentProgressing,
+			Status: corev1.ConditionTrue,
+			Reason: "ReplicaSetUpdated",
+		}}
+
+		Expect(DeploymentFailed(&deployment)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Test DaemonSetComplete", func() {
+	var (
+		daemonSet appsv1.DaemonSet
+	)
+
+	BeforeEach(func() {
+		daemonSet = appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test-daemonset",
+				Namespace:  "test-namespace",
+				Generation: 2,
+			},
+			Status: appsv1.DaemonSetStatus{
+				ObservedGeneration:     2,
+				DesiredNumberScheduled: 3,
+			},
+		}
+	})
+
+	It("Test daemonset completed", func() {
+		daemonSet.Status.UpdatedNumberScheduled = 3
+		daemonSet.Status.NumberAvailable = 3
+
+		Expect(DaemonSetComplete(&daemonSet)).To(BeTrue())
+	})
+
+	It("Test daemonset not all updated", func() {
+		daemonSet.Status.UpdatedNumberScheduled = 2
+		daemonSet.Status.NumberAvailable = 3
+
+		Expect(DaemonSetComplete(&daemonSet)).To(BeFalse())
+	})
+
+	It("Test daemonset not all available", func() {
+		daemonSet.Status.UpdatedNumberScheduled = 3
+		daemonSet.Status.NumberAvailable = 2
+
+		Expect(DaemonSetComplete(&daemonSet)).To(BeFalse())
+	})
+
+	It("Test daemonset not observed", func() {
+		daemonSet.Status.ObservedGeneration = 1
+		daemonSet.Status.UpdatedNumberScheduled = 3
+		daemonSet.Status.NumberAvailable = 3
+
+		Expect(DaemonSetComplete(&daemonSet)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Test StatefulSetComplete", func() {
+	var (
+		statefulSet appsv1.StatefulSet
+	)
+
+	BeforeEach(func() {
+		replicas := int32(3)
+		statefulSet = appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-statefulset",
+				Namespace: "test-namespace",
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+			},
+			Status: appsv1.StatefulSetStatus{
+				Replicas:        3,
+				CurrentRevision: "test-statefulset-1",
+				UpdateRevision:  "test-statefulset-1",
+			},
+		}
+	})
+
+	It("Test statefulset completed", func() {
+		statefulSet.Status.ReadyReplicas = 3
+
+		Expect(StatefulSetComplete(&statefulSet)).To(BeTrue())
+	})
+
+	It("Test statefulset not all updated", func() {
+		statefulSet.Status.ReadyReplicas = 3
+		statefulSet.Status.UpdateRevision = "test-statefulset-2"
+
+		Expect(StatefulSetComplete(&statefulSet)).To(BeFalse())
+	})
+
+	It("Test statefulset not all ready", func() {
+		statefulSet.Status.ReadyReplicas = 2
+
+		Expect(StatefulSetComplete(&statefulSet)).To(BeFalse())
+	})
+
+	It("Test OnDelete statefulset completed with pods of the previous revision", func() {
+		statefulSet.Spec.UpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+		statefulSet.Status.ReadyReplicas = 3
+		statefulSet.Status.UpdateRevision = "test-statefulset-2"
+
+		Expect(StatefulSetComplete(&statefulSet)).To(BeTrue())
+
+		statefulSet.Status.ReadyReplicas = 2
+		Expect(StatefulSetComplete(&statefulSet)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Test JobComplete", func() {
+	var (
+		job batchv1.Job
+	)
+
+	BeforeEach(func() {
+		job = batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-job",
+				Namespace: "test-namespace",
+			},
+		}
+	})
+
+	It("Test job succeeded", func() {
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+		}
+
+		Expect(JobComplete(&job)).To(BeTrue())
+		Expect(JobFailed(&job)).To(BeFalse())
+	})
+
+	It("Test job failed", func() {
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+		}
+
+		Expect(JobComplete(&job)).To(BeFalse())
+		Expect(JobFailed(&job)).To(BeTrue())
+	})
+
+	It("Test job running", func() {
+		job.Status.Active = 1
+
+		Expect(JobComplete(&job)).To(BeFalse())
+		Expect(JobFailed(&job)).To(BeFalse())
+	})
 })
@@ -16,7 +16,12 @@ import (
 
 type RunFunc func(context.Context)
 
-// RunWithLeaderElection comments
+// shutdownTimeout is how long fn is given to return once its context is cancelled
+const shutdownTimeout = 20 * time.Second
+
+// RunWithLeaderElection runs fn while holding the leader lease. The context of
+// fn is cancelled on SIGTERM or when the lease is lost, the process exits once
+// fn returned or after shutdownTimeout.
 func RunWithLeaderElection(fn RunFunc, logger *logrus.Entry, ns, name string) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -60,15 +65,24 @@ func RunWithLeaderElection(fn RunFunc, logger *logrus.Entry, ns, name string) {
 		cancel()
 	}()
 
+	// started is closed when leading starts, done when fn returns
+	started := make(chan struct{})
+	done := make(chan struct{})
+
 	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
 		Lock:          rl,
 		LeaseDuration: 30 * time.Second,
 		RenewDeadline: 15 * time.Second,
 		RetryPeriod:   5 * time.Second,
 		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: fn,
+			OnStartedLeading: func(ctx context.Context) {
+				close(started)
+				defer close(done)
+				fn(ctx)
+			},
 			OnStoppedLeading: func() {
 				logger.Warnf("leader lost: %s", id)
+				waitForRunFunc(started, done, logger)
 				os.Exit(0)
 			},
 			OnNewLeader: func(identity string) {
@@ -77,3 +91,19 @@ func RunWithLeaderElection(fn RunFunc, logger *logrus.Entry, ns, name string) {
 		},
 	})
 }
+
+// waitForRunFunc waits for the RunFunc to finish or abort its work
+func waitForRunFunc(started, done <-chan struct{}, logger *logrus.Entry) {
+	select {
+	case <-started:
+	default:
+		return
+	}
+
+	logger.Info("waiting for the current work to stop")
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		logger.Warnf("the current work did not stop in %s", shutdownTimeout)
+	}
+}
@@ -0,0 +1,51 @@
+package syncer
+
+// blobCacheEntry is the content of a blob with the version it was read at
+type blobCacheEntry struct {
+	content string
+	version BlobVersion
+}
+
+// blobCache keeps the blobs read by the syncer so that unchanged blobs can be
+// read with conditional requests instead of being downloaded again.
+// It is not safe for concurrent use.
+type blobCache struct {
+	entries map[string]blobCacheEntry
+	// used records the keys read since the last prune
+	used map[string]bool
+}
+
+func newBlobCache() *blobCache {
+	return &blobCache{
+		entries: make(map[string]blobCacheEntry),
+		used:    make(map[string]bool),
+	}
+}
+
+func blobCacheKey(containerName, blobName string) string {
+	return containerName + "/" + blobName
+}
+
+func (c *blobCache) get(containerName, blobName string) (blobCacheEntry, bool) {
+	key := blobCacheKey(containerName, blobName)
+	c.used[key] = true
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *blobCache) set(containerName, blobName string, entry blobCacheEntry) {
+	key := blobCacheKey(containerName, blobName)
+	c.used[key] = true
+	c.entries[key] = entry
+}
+
+// prune drops the entries which have not been read since the last prune, e.g.
+// blobs of app versions which are no longer referenced by the cluster
+func (c *blobCache) prune() {
+	for key := range c.entries {
+		if !c.used[key] {
+			delete(c.entries, key)
+		}
+	}
+	c.used = make(map[string]bool)
+}
@@ -0,0 +1,298 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+// deletedAksAppContainerName is the container the blobs of the aksapp versions
+// soft-deleted are moved to, under the same names so they can be restored
+const deletedAksAppContainerName = "aksapp-deleted"
+
+// VersionGCOptions configures the removal of the aksapp versions of the storage account
+type VersionGCOptions struct {
+	// RetainVersions is how many of the most recent versions of each aksapp type are kept
+	RetainVersions int
+	// DryRun only reports the versions which would be removed
+	DryRun bool
+	// SoftDelete moves the blobs of the versions to the aksapp-deleted container
+	// instead of deleting them
+	SoftDelete bool
+	// Toggles is the toggle document of the syncers when set, the versions it
+	// sets are referenced too
+	Toggles *ToggleDocument
+}
+
+// RemovedVersion is an aksapp version removed, or which would be in a dry run
+type RemovedVersion struct {
+	AppType string
+	Version string
+	// Blobs are the blobs of the version, including the signatures
+	Blobs []string
+}
+
+// CollectVersions removes the aksapp versions which are neither referenced by
+// a folder of the cluster container nor among the most recent versions of
+// their type. Constraints and channels are resolved the way the syncer
+// resolves them. Every published version matching a referenced constraint is
+// kept, not only the highest one, as a cluster may not have synced the highest
+// match yet. Every version a channel points to is kept too. Blobs which are
+// not semantic versions, e.g. the channel index, are never removed.
+//
+// Only the current content of the cluster container counts as references, a
+// cluster still running a version no longer referenced, e.g. as it has not
+// synced for a while, may lose it once it falls outside RetainVersions.
+//
+// References which cannot be determined, e.g. a folder which cannot be parsed,
+// fail the collection rather than risk removing a version in use.
+func (p *Publisher) CollectVersions(ctx context.Context, options VersionGCOptions) ([]RemovedVersion, error) {
+	if options.RetainVersions < 0 {
+		return nil, fmt.Errorf("invalid number of versions to retain %d", options.RetainVersions)
+	}
+
+	references, err := p.referencedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	blobList, err := p.blobClient.ListBlobsWithPrefix(ctx, p.containerURL(aksAppContainerName), "")
+	if err != nil {
+		return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: "", Err: err}
+	}
+	// Group the blobs by type and version
+	appBlobs := make(map[string]map[string][]string)
+	exists := make(map[string]bool)
+	for _, blob := range blobList.Blobs {
+		exists[blob.Name] = true
+		i := strings.Index(blob.Name, "/")
+		if i < 0 {
+			continue
+		}
+		appType := blob.Name[:i]
+		version := appVersionName(appType+"/", blob.Name)
+		if appBlobs[appType] == nil {
+			appBlobs[appType] = make(map[string][]string)
+		}
+		appBlobs[appType][version] = append(appBlobs[appType][version], blob.Name)
+	}
+
+	if options.Toggles != nil {
+		for _, rule := range options.Toggles.Rules {
+			for _, toggle := range rule.Apps {
+				if toggle.Version == "" {
+					continue
+				}
+				for appType := range appBlobs {
+					if matchAny([]string{toggle.Type}, appType) {
+						references[appType] = append(references[appType], toggle.Version)
+					}
+				}
+			}
+		}
+	}
+
+	var removed []RemovedVersion
+	for _, appType := range sortedTypes(appBlobs) {
+		versions := appBlobs[appType]
+		var channels map[string]string
+		channelsBlobName := fmt.Sprintf(aksAppChannelsBlobNameFormat, appType)
+		if exists[channelsBlobName] {
+			data, _, err := p.blobClient.GetBlobDataV1(ctx, p.storageAccountName, aksAppContainerName, channelsBlobName)
+			if err != nil {
+				return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: channelsBlobName, Err: err}
+			}
+			if channels, err = parseChannels(string(data)); err != nil {
+				return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: channelsBlobName, Err: err}
+			}
+		}
+
+		var published []*utilversion.Version
+		names := make(map[*utilversion.Version]string)
+		for version := range versions {
+			if v, err := utilversion.ParseSemantic(version); err == nil {
+				published = append(published, v)
+				names[v] = version
+			}
+		}
+		// Most recent versions first
+		sort.Slice(published, func(i, j int) bool {
+			return published[j].LessThan(published[i])
+		})
+
+		kept := resolveReferences(references[appType], channels, published, names)
+		for i, v := range published {
+			if i < options.RetainVersions || kept[names[v]] {
+				continue
+			}
+			blobs := versions[names[v]]
+			sort.Strings(blobs)
+			removed = append(removed, RemovedVersion{AppType: appType, Version: names[v], Blobs: blobs})
+		}
+	}
+
+	if options.DryRun {
+		for _, version := range removed {
+			p.logger.Infof("Would remove version %s of aksapp %s", version.Version, version.AppType)
+		}
+		return removed, nil
+	}
+	if options.SoftDelete && len(removed) > 0 {
+		if err := p.ensureContainer(ctx, deletedAksAppContainerName); err != nil {
+			return nil, err
+		}
+	}
+	for _, version := range removed {
+		for _, blobName := range version.Blobs {
+			if err := p.removeBlob(ctx, blobName, options.SoftDelete); err != nil {
+				return nil, err
+			}
+		}
+		p.logger.Infof("Removed version %s of aksapp %s", version.Version, version.AppType)
+	}
+	return removed, nil
+}
+
+// referencedVersions returns the versions of the AksApps of every folder of
+// the cluster container by type, as written: exact versions, constraints or
+// channels. Versions set by placeholders get the values of every values file
+// defining them.
+func (p *Publisher) referencedVersions(ctx context.Context) (map[string][]string, error) {
+	blobList, err := p.blobClient.ListBlobsWithPrefix(ctx, p.containerURL(clusterContainerName), "")
+	if err != nil {
+		return nil, &BlobError{ContainerName: clusterContainerName, BlobName: "", Err: err}
+	}
+
+	valuesPrefix := path.Dir(valuesBlobNameFormat) + "/"
+	var values []map[string]string
+	folders := make(map[string][]string)
+	for _, blob := range blobList.Blobs {
+		if isSignatureBlob(blob.Name) || strings.HasSuffix(blob.Name, lockBlobSuffix) {
+			continue
+		}
+		data, _, err := p.blobClient.GetBlobDataV1(ctx, p.storageAccountName, clusterContainerName, blob.Name)
+		if err != nil {
+			return nil, &BlobError{ContainerName: clusterContainerName, BlobName: blob.Name, Err: err}
+		}
+		if strings.HasPrefix(blob.Name, valuesPrefix) {
+			clusterValues := make(map[string]string)
+			decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data))
+			if err := decoder.Decode(&clusterValues); err != nil && strings.TrimSpace(string(data)) != "" {
+				return nil, &BlobError{ContainerName: clusterContainerName, BlobName: blob.Name, Err: err}
+			}
+			values = append(values, clusterValues)
+			continue
+		}
+		folder := path.Dir(blob.Name) + "/"
+		folders[folder] = append(folders[folder], string(data))
+	}
+
+	scheme := runtime.NewScheme()
+	_ = deployerv1.AddToScheme(scheme)
+	references := make(map[string][]string)
+	for folder, contents := range folders {
+		layer, err := parseClusterLayer(p.logger, scheme, folder, strings.Join(contents, "---\n")+"---\n")
+		if err != nil {
+			return nil, err
+		}
+		for _, app := range layer.apps {
+			versions, err := expandVersion(app.Spec.Version, values)
+			if err != nil {
+				return nil, &BlobError{ContainerName: clusterContainerName, BlobName: folder,
+					Err: fmt.Errorf("aksapp %s/%s: %s", app.Namespace, app.Name, err.Error())}
+			}
+			references[app.Spec.Type] = append(references[app.Spec.Type], versions...)
+		}
+	}
+	return references, nil
+}
+
+// expandVersion returns the versions a version with placeholders takes with
+// the values files defining them
+func expandVersion(version string, values []map[string]string) ([]string, error) {
+	if !placeholderRegexp.MatchString(version) {
+		return []string{version}, nil
+	}
+	var versions []string
+	for _, clusterValues := range values {
+		if expanded, err := substitutePlaceholders(version, clusterValues); err == nil {
+			versions = append(versions, expanded)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("version %s is not defined by any values file", version)
+	}
+	return versions, nil
+}
+
+// resolveReferences returns the names of the published versions which are
+// referenced, directly, by a constraint or by a channel. Every published
+// version matching a constraint is referenced, pre-releases aside as the
+// syncer never resolves a constraint to them. Every version a channel points
+// to is referenced.
+func resolveReferences(references []string, channels map[string]string,
+	published []*utilversion.Version, names map[*utilversion.Version]string) map[string]bool {
+	for _, channelVersion := range channels {
+		references = append(references, channelVersion)
+	}
+
+	kept := make(map[string]bool)
+	for _, reference := range references {
+		if channelVersion, ok := channels[reference]; ok {
+			reference = channelVersion
+		}
+		if !isVersionConstraint(reference) {
+			// The name of a version, or of a blob which is never removed
+			kept[reference] = true
+			continue
+		}
+		constraint, err := parseVersionConstraint(reference)
+		if err != nil {
+			continue
+		}
+		for _, v := range published {
+			if v.PreRelease() == "" && constraint.matches(v) {
+				kept[names[v]] = true
+			}
+		}
+	}
+	return kept
+}
+
+// removeBlob deletes a blob of the aksapp container, which is first copied to
+// the aksapp-deleted container when soft-deleting
+func (p *Publisher) removeBlob(ctx context.Context, blobName string, softDelete bool) error {
+	if softDelete {
+		data, _, err := p.blobClient.GetBlobDataV1(ctx, p.storageAccountName, aksAppContainerName, blobName)
+		if err != nil {
+			return &BlobError{ContainerName: aksAppContainerName, BlobName: blobName, Err: err}
+		}
+		if err := p.blobClient.PutBlobDataV1(ctx, p.storageAccountName, deletedAksAppContainerName, blobName,
+			data, nil); err != nil {
+			return &BlobError{ContainerName: deletedAksAppContainerName, BlobName: blobName, Err: err}
+		}
+	}
+	p.logger.Infof("Delete blob %s/%s", aksAppContainerName, blobName)
+	if err := p.blobClient.DeleteBlob(ctx, p.storageAccountName, aksAppContainerName, blobName); err != nil {
+		return &BlobError{ContainerName: aksAppContainerName, BlobName: blobName, Err: err}
+	}
+	return nil
+}
+
+func sortedTypes(m map[string]map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
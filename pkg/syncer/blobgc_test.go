@@ -0,0 +1,133 @@
+package syncer
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient/mock_blobclient"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test CollectVersions", func() {
+	var (
+		blobClient *mock_blobclient.MockInterface
+		publisher  *Publisher
+		ctx        context.Context
+		blobs      map[string]map[string]string
+	)
+
+	BeforeEach(func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		blobClient = mock_blobclient.NewMockInterface(mockCtrl)
+		publisher = NewPublisher(blobClient, "account", "core.windows.net", log.New("test-service", "test-version"))
+		ctx = context.Background()
+
+		blobs = map[string]map[string]string{
+			clusterContainerName: {
+				"_global/a.yaml":            testClusterConfig("app-a", "type-a", "1.0.0"),
+				"test-cluster/b.yaml":       testClusterConfig("app-b", "type-b", "~1.1"),
+				"test-cluster/c.yaml":       testClusterConfig("app-c", "type-c", "${TYPE_C_VERSION}"),
+				"test-cluster.lock":         "",
+				"_values/test-cluster.yaml": "TYPE_C_VERSION: 1.0.0\n",
+			},
+			aksAppContainerName: {
+				"type-a/1.0.0.yaml":      testAppConfig,
+				"type-a/1.1.0.yaml":      testAppConfig,
+				"type-a/1.1.0.yaml.sig":  "signature",
+				"type-a/2.0.0.yaml":      testAppConfig,
+				"type-a/3.0.0/a.yaml":    testAppConfig,
+				"type-a/3.0.0/index.txt": "a.yaml\n",
+				"type-b/1.0.0.yaml":      testAppConfig,
+				"type-b/1.1.0.yaml":      testAppConfig,
+				"type-b/1.1.1.yaml":      testAppConfig,
+				"type-b/1.2.0.yaml":      testAppConfig,
+				"type-b/latest.yaml":     testAppConfig,
+				"type-b/channels.yaml":   "stable: 1.0.0\n",
+				"type-c/1.0.0.yaml":      testAppConfig,
+				"type-c/2.0.0-rc.1.yaml": testAppConfig,
+			},
+		}
+
+		for _, containerName := range []string{clusterContainerName, aksAppContainerName} {
+			var names []string
+			for name := range blobs[containerName] {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			blobList := storage.BlobListResponse{}
+			for _, name := range names {
+				blobList.Blobs = append(blobList.Blobs, storage.Blob{Name: name})
+			}
+			blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(),
+				"https://account.blob.core.windows.net/"+containerName, "").Return(blobList, nil).AnyTimes()
+		}
+		blobClient.EXPECT().GetBlobDataV1(gomock.Any(), "account", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, containerName, blobName string) ([]byte, int, error) {
+				Expect(blobs[containerName]).To(HaveKey(blobName))
+				return []byte(blobs[containerName][blobName]), 200, nil
+			}).AnyTimes()
+	})
+
+	It("Test CollectVersions reports the versions which are not referenced in a dry run", func() {
+		removed, err := publisher.CollectVersions(ctx, VersionGCOptions{RetainVersions: 1, DryRun: true})
+		Expect(err).To(BeNil())
+		Expect(removed).To(Equal([]RemovedVersion{
+			{AppType: "type-a", Version: "2.0.0", Blobs: []string{"type-a/2.0.0.yaml"}},
+			{AppType: "type-a", Version: "1.1.0", Blobs: []string{"type-a/1.1.0.yaml", "type-a/1.1.0.yaml.sig"}},
+		}))
+	})
+
+	It("Test CollectVersions keeps every version matching a constraint", func() {
+		removed, err := publisher.CollectVersions(ctx, VersionGCOptions{RetainVersions: 0, DryRun: true})
+		Expect(err).To(BeNil())
+		var typeB []string
+		for _, version := range removed {
+			if version.AppType == "type-b" {
+				typeB = append(typeB, version.Version)
+			}
+		}
+		// ~1.1 matches 1.1.0 and 1.1.1, the channel stable is 1.0.0
+		Expect(typeB).To(ConsistOf("1.2.0"))
+	})
+
+	It("Test CollectVersions keeps the versions set by toggles", func() {
+		removed, err := publisher.CollectVersions(ctx, VersionGCOptions{
+			RetainVersions: 1,
+			DryRun:         true,
+			Toggles: &ToggleDocument{Rules: []ToggleRule{
+				{Apps: []AppToggle{{Type: "type-*", Version: "2.0.0"}}},
+			}},
+		})
+		Expect(err).To(BeNil())
+		Expect(removed).To(HaveLen(1))
+		Expect(removed[0].Version).To(Equal("1.1.0"))
+	})
+
+	It("Test CollectVersions soft-deletes the blobs", func() {
+		blobClient.EXPECT().ContainerExists(gomock.Any(), "account", deletedAksAppContainerName).Return(false, nil)
+		blobClient.EXPECT().CreateContainerWithACL(gomock.Any(), "account", deletedAksAppContainerName,
+			blobclient.BlobPublicAccessLevelNotSet).Return(nil)
+		for _, blobName := range []string{"type-a/2.0.0.yaml", "type-a/1.1.0.yaml", "type-a/1.1.0.yaml.sig"} {
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", deletedAksAppContainerName, blobName,
+				[]byte(blobs[aksAppContainerName][blobName]), nil).Return(nil)
+			blobClient.EXPECT().DeleteBlob(gomock.Any(), "account", aksAppContainerName, blobName).Return(nil)
+		}
+
+		removed, err := publisher.CollectVersions(ctx, VersionGCOptions{RetainVersions: 1, SoftDelete: true})
+		Expect(err).To(BeNil())
+		Expect(removed).To(HaveLen(2))
+	})
+
+	It("Test CollectVersions fails when a version cannot be resolved", func() {
+		blobs[clusterContainerName]["_values/test-cluster.yaml"] = "OTHER: value\n"
+		_, err := publisher.CollectVersions(ctx, VersionGCOptions{RetainVersions: 1})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("TYPE_C_VERSION"))
+	})
+})
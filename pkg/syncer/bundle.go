@@ -0,0 +1,285 @@
+package syncer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// bundleBlobs holds the blobs of a bundle by container and blob name
+type bundleBlobs map[string]map[string]string
+
+// bundleSource reads configurations from a gzipped tarball laid out like the
+// storage account, i.e. <containerName>/<blobName>. The bundle is read again
+// when the file changes, e.g. when a new bundle is copied to the volume.
+type bundleSource struct {
+	path string
+	// publicKeys verify the detached signature <path>.sig of the bundle when not empty
+	publicKeys []crypto.PublicKey
+	logger     *logrus.Entry
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+	blobs   bundleBlobs
+}
+
+// NewBundleSource returns a ConfigSource reading from a tarball bundle for
+// clusters which cannot reach the storage account
+func NewBundleSource(path string, publicKeys []crypto.PublicKey, logger *logrus.Entry) ConfigSource {
+	return &bundleSource{
+		path:       path,
+		publicKeys: publicKeys,
+		logger:     logger,
+	}
+}
+
+func (b *bundleSource) String() string {
+	return fmt.Sprintf("bundle (%s)", b.path)
+}
+
+// load returns the blobs of the bundle, reading it again if the file changed
+func (b *bundleSource) load() (bundleBlobs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return nil, err
+	}
+	if b.blobs != nil && info.ModTime().Equal(b.modTime) && info.Size() == b.size {
+		return b.blobs, nil
+	}
+
+	data, err := ioutil.ReadFile(b.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.publicKeys) > 0 {
+		signature, err := ioutil.ReadFile(b.path + signatureSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrSignatureMissing, err.Error())
+		}
+		if !verifySignature(b.publicKeys, data, decodeSignature(string(signature))) {
+			return nil, ErrSignatureInvalid
+		}
+	}
+
+	blobs, err := readBundle(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle %s: %s", b.path, err.Error())
+	}
+
+	b.logger.Infof("Loaded bundle %s", b.path)
+	b.blobs, b.modTime, b.size = blobs, info.ModTime(), info.Size()
+	return blobs, nil
+}
+
+func (b *bundleSource) ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	blobs, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range blobs[containerName] {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	// Keep the same order as the storage service which lists blobs lexicographically
+	sort.Strings(names)
+	return names, nil
+}
+
+func (b *bundleSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	blobs, err := b.load()
+	if err != nil {
+		return "", err
+	}
+
+	content, ok := blobs[containerName][blobName]
+	if !ok {
+		return "", fmt.Errorf("blob %s/%s not found in bundle %s", containerName, blobName, b.path)
+	}
+	return content, nil
+}
+
+// readBundle reads the blobs of a gzipped tarball bundle
+func readBundle(r io.Reader) (bundleBlobs, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	blobs := make(bundleBlobs)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) != 2 || parts[0] == ".." {
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if blobs[parts[0]] == nil {
+			blobs[parts[0]] = make(map[string]string)
+		}
+		blobs[parts[0]][parts[1]] = string(content)
+	}
+	return blobs, nil
+}
+
+// writeBundle writes the blobs as a gzipped tarball bundle, entries are sorted
+// and timestamps left out so that the same blobs always give the same bundle
+func writeBundle(w io.Writer, blobs bundleBlobs) error {
+	var names []string
+	for containerName, containerBlobs := range blobs {
+		for blobName := range containerBlobs {
+			names = append(names, containerName+"/"+blobName)
+		}
+	}
+	sort.Strings(names)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		parts := strings.SplitN(name, "/", 2)
+		content := blobs[parts[0]][parts[1]]
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  time.Unix(0, 0),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// recordingSource records the blobs read from a ConfigSource
+type recordingSource struct {
+	ConfigSource
+
+	lock  sync.Mutex
+	blobs bundleBlobs
+}
+
+func (r *recordingSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	content, err := r.ConfigSource.GetBlob(ctx, containerName, blobName)
+	if err != nil {
+		return "", err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.blobs[containerName] == nil {
+		r.blobs[containerName] = make(map[string]string)
+	}
+	r.blobs[containerName][blobName] = content
+	return content, nil
+}
+
+// WriteBundle fetches and validates the configuration of a cluster the same
+// way Syncer.Run does and writes every blob it reads, along with their
+// signatures, as a bundle for NewBundleSource. The environment of the cluster
+// must be set, and its region once the cluster container has region layers,
+// the bundle is not built where the cluster runs.
+func WriteBundle(ctx context.Context, source ConfigSource, clusterName string, opt Options,
+	w io.Writer, logger *logrus.Entry) error {
+	if opt.Environment == "" {
+		return fmt.Errorf("the environment of cluster %s must be set to select its environment layer", clusterName)
+	}
+	if opt.Region == "" {
+		regionBlobs, err := source.ListBlobs(ctx, clusterContainerName, strings.TrimSuffix(regionLayerPrefix, "%s/"))
+		if err != nil {
+			return err
+		}
+		if len(regionBlobs) > 0 {
+			return fmt.Errorf("the region of cluster %s must be set to select its region layer", clusterName)
+		}
+	}
+	recorder := &recordingSource{
+		ConfigSource: source,
+		blobs:        make(bundleBlobs),
+	}
+	s := NewSyncerWithConfigSource(nil, recorder, clusterName, logger)
+	s.SetOptions(opt)
+
+	snap, err := s.fetchSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	if err = s.validateSnapshot(snap); err != nil {
+		return err
+	}
+
+	// Signatures are only read when verified, add the other ones
+	var signatures [][2]string
+	for containerName, containerBlobs := range recorder.blobs {
+		for blobName := range containerBlobs {
+			if !isSignatureBlob(blobName) {
+				signatures = append(signatures, [2]string{containerName, blobName + signatureSuffix})
+			}
+		}
+	}
+	for _, signature := range signatures {
+		names, err := source.ListBlobs(ctx, signature[0], signature[1])
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if name != signature[1] {
+				continue
+			}
+			if _, err := recorder.GetBlob(ctx, signature[0], name); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Infof("Write bundle of cluster %s with %d aksapp configurations", clusterName, len(snap.appConfigs))
+	return writeBundle(w, recorder.blobs)
+}
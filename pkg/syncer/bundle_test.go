@@ -0,0 +1,137 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test bundles", func() {
+	var (
+		logger *logrus.Entry
+		root   string
+		bundle string
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		bundle = filepath.Join(root, "bundle.tar.gz")
+
+		writeFiles(root, map[string]string{
+			"storage/cluster/_global/a.yaml":       testClusterConfig("app-a", "type-a", "~1.0"),
+			"storage/cluster/_env/test/d.yaml":     testClusterConfig("app-d", "type-b", "2.0.0"),
+			"storage/cluster/_env/prod/e.yaml":     testClusterConfig("app-e", "type-c", "3.0.0"),
+			"storage/cluster/test-cluster/b.yaml":  testClusterConfig("app-b", "type-b", "2.0.0"),
+			"storage/cluster/other/c.yaml":         testClusterConfig("app-c", "type-c", "3.0.0"),
+			"storage/aksapp/type-a/1.0.0.yaml":     testAppConfig,
+			"storage/aksapp/type-a/1.0.1.yaml":     testAppConfig,
+			"storage/aksapp/type-a/1.0.1.yaml.sig": "signature",
+			"storage/aksapp/type-b/2.0.0.yaml":     testAppConfig,
+			"storage/aksapp/type-c/3.0.0.yaml":     testAppConfig,
+		})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	writeBundleFile := func() []byte {
+		var buf bytes.Buffer
+		Expect(WriteBundle(context.Background(), NewLocalSource(filepath.Join(root, "storage"), logger),
+			"test-cluster", Options{Environment: "test"}, &buf, logger)).To(Succeed())
+		Expect(ioutil.WriteFile(bundle, buf.Bytes(), 0644)).To(Succeed())
+		return buf.Bytes()
+	}
+
+	It("Test WriteBundle writes the blobs used by the cluster", func() {
+		data := writeBundleFile()
+		blobs, err := readBundle(bytes.NewReader(data))
+		Expect(err).To(BeNil())
+		Expect(blobs[clusterContainerName]).To(HaveLen(3))
+		Expect(blobs[clusterContainerName]).To(HaveKey("_global/a.yaml"))
+		Expect(blobs[clusterContainerName]).To(HaveKey("_env/test/d.yaml"))
+		Expect(blobs[clusterContainerName]).To(HaveKey("test-cluster/b.yaml"))
+		Expect(blobs[aksAppContainerName]).To(Equal(map[string]string{
+			"type-a/1.0.1.yaml":     testAppConfig,
+			"type-a/1.0.1.yaml.sig": "signature",
+			"type-b/2.0.0.yaml":     testAppConfig,
+		}))
+
+		// Bundles are reproducible
+		Expect(writeBundleFile()).To(Equal(data))
+	})
+
+	It("Test WriteBundle requires the environment of the cluster", func() {
+		var buf bytes.Buffer
+		err := WriteBundle(context.Background(), NewLocalSource(filepath.Join(root, "storage"), logger),
+			"test-cluster", Options{Region: "westus2"}, &buf, logger)
+		Expect(err).NotTo(BeNil())
+		Expect(buf.Len()).To(BeZero())
+	})
+
+	It("Test WriteBundle requires the region of the cluster when there are region layers", func() {
+		writeFiles(root, map[string]string{
+			"storage/cluster/_region/westus2/f.yaml": testClusterConfig("app-f", "type-c", "3.0.0"),
+		})
+		source := NewLocalSource(filepath.Join(root, "storage"), logger)
+		var buf bytes.Buffer
+		err := WriteBundle(context.Background(), source, "test-cluster", Options{Environment: "test"}, &buf, logger)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("region"))
+
+		Expect(WriteBundle(context.Background(), source, "test-cluster",
+			Options{Environment: "test", Region: "westus2"}, &buf, logger)).To(Succeed())
+	})
+
+	It("Test Run with a bundle source", func() {
+		writeBundleFile()
+		kubeClient := fake.NewSimpleClientset()
+		syncer := NewSyncerWithConfigSource(kubeClient, NewBundleSource(bundle, nil, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace", Environment: "test"})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		for _, name := range []string{"type-a-1.0.1", "type-b-2.0.0", configmaps.ClusterConfigMapName} {
+			_, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(), name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+		}
+	})
+
+	It("Test bundle source verifies the signature of the bundle", func() {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).To(BeNil())
+		data := writeBundleFile()
+		source := NewBundleSource(bundle, []crypto.PublicKey{publicKey}, logger)
+
+		_, err = source.ListBlobs(context.Background(), clusterContainerName, "")
+		Expect(errors.Is(err, ErrSignatureMissing)).To(BeTrue())
+
+		signature, err := Sign(privateKey, data)
+		Expect(err).To(BeNil())
+		Expect(ioutil.WriteFile(bundle+signatureSuffix, []byte(signature), 0644)).To(Succeed())
+		names, err := source.ListBlobs(context.Background(), clusterContainerName, "test-cluster/")
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"test-cluster/b.yaml"}))
+
+		Expect(ioutil.WriteFile(bundle, append(data, 0), 0644)).To(Succeed())
+		_, err = source.GetBlob(context.Background(), clusterContainerName, "test-cluster/b.yaml")
+		Expect(errors.Is(err, ErrSignatureInvalid)).To(BeTrue())
+	})
+})
@@ -0,0 +1,277 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+)
+
+// ConfigSource is where the syncer reads the cluster and aksapp configurations from.
+// Blob names are relative to the container, e.g. "<clusterName>/apps.yaml" in the
+// "cluster" container or "<type>/<version>.yaml" in the "aksapp" container.
+type ConfigSource interface {
+	// ListBlobs returns the names of the blobs in the container starting with prefix
+	ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error)
+	// GetBlob returns the content of a blob, an error is returned if it does not exist
+	GetBlob(ctx context.Context, containerName, blobName string) (string, error)
+	// String describes the source in logs
+	String() string
+}
+
+// BlobVersion identifies the version of a blob for conditional reads
+type BlobVersion struct {
+	ETag         string
+	LastModified string
+}
+
+// ConditionalConfigSource is a ConfigSource able to skip downloading blobs which
+// have not changed since they were last read
+type ConditionalConfigSource interface {
+	ConfigSource
+	// GetBlobIfChanged returns the content and the version of a blob. notModified is
+	// true and content is empty when the blob still matches the given version.
+	GetBlobIfChanged(ctx context.Context, containerName, blobName string, version BlobVersion) (
+		content string, newVersion BlobVersion, notModified bool, err error)
+}
+
+// blobClientSource reads configurations from Azure Blob Storage via blobclient.Interface
+type blobClientSource struct {
+	blobClient            blobclient.Interface
+	storageAccountName    string
+	storageEndpointSuffix string
+	logger                *logrus.Entry
+}
+
+// NewBlobClientSource returns a ConfigSource backed by blobclient.Interface
+func NewBlobClientSource(
+	blobClient blobclient.Interface,
+	storageAccountName string,
+	storageEndpointSuffix string,
+	logger *logrus.Entry) ConfigSource {
+	return &blobClientSource{
+		blobClient:            blobClient,
+		storageAccountName:    storageAccountName,
+		storageEndpointSuffix: storageEndpointSuffix,
+		logger:                logger,
+	}
+}
+
+func (b *blobClientSource) String() string {
+	return fmt.Sprintf("blob client (%s)", b.containerURL(""))
+}
+
+func (b *blobClientSource) containerURL(containerName string) string {
+	return fmt.Sprintf("https://%s.blob.%s/%s",
+		b.storageAccountName, b.storageEndpointSuffix, containerName)
+}
+
+func (b *blobClientSource) ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	blobList, err := b.blobClient.ListBlobsWithPrefix(ctx, b.containerURL(containerName), prefix)
+	if err != nil {
+		b.logger.Errorf("Failed to list container %s blobs with prefix %s via blob client, %s",
+			containerName, prefix, err.Error())
+		return nil, err
+	}
+
+	b.logger.Infof("Successfully list blobs in container %s with prefix %s",
+		containerName, prefix)
+
+	var names []string
+	for _, blob := range blobList.Blobs {
+		names = append(names, blob.Name)
+	}
+	return names, nil
+}
+
+func (b *blobClientSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	url := b.containerURL(containerName) + "/" + blobName
+
+	data, err := b.blobClient.GetBlobData(ctx, url)
+	if err != nil {
+		b.logger.Errorf("Failed to get container %s blob %s via blob client, %s",
+			containerName, blobName, err.Error())
+		return "", err
+	}
+	// GetBlobData doesn't return error when 404 occurs and return nil instead
+	if data == nil {
+		b.logger.Errorf("Container %s blob %s does not exist via blob client",
+			containerName, blobName)
+		return "", errors.New("Get a non-existent blob")
+	}
+
+	b.logger.Infof("Successfully get data from container %s blob %s",
+		containerName, blobName)
+
+	return string(data), nil
+}
+
+func (b *blobClientSource) GetBlobIfChanged(ctx context.Context, containerName, blobName string,
+	version BlobVersion) (string, BlobVersion, bool, error) {
+	url := b.containerURL(containerName) + "/" + blobName
+
+	blob, err := b.blobClient.GetBlobDataIfNoneMatch(ctx, url, version.ETag)
+	if err != nil {
+		b.logger.Errorf("Failed to get container %s blob %s via blob client, %s",
+			containerName, blobName, err.Error())
+		return "", BlobVersion{}, false, err
+	}
+	if blob == nil {
+		b.logger.Errorf("Container %s blob %s does not exist via blob client",
+			containerName, blobName)
+		return "", BlobVersion{}, false, errors.New("Get a non-existent blob")
+	}
+
+	newVersion := BlobVersion{ETag: blob.ETag, LastModified: blob.LastModified}
+	if blob.NotModified {
+		b.logger.Infof("Container %s blob %s is not modified", containerName, blobName)
+		return "", newVersion, true, nil
+	}
+
+	b.logger.Infof("Successfully get data from container %s blob %s",
+		containerName, blobName)
+
+	return string(blob.Data), newVersion, false, nil
+}
+
+// storageClientSource reads configurations from Azure Blob Storage via the
+// storage SDK client authenticated with an access key
+type storageClientSource struct {
+	storageClient storage.Client
+	logger        *logrus.Entry
+}
+
+// NewStorageClientSource returns a ConfigSource backed by the legacy storage.Client
+func NewStorageClientSource(storageClient storage.Client, logger *logrus.Entry) ConfigSource {
+	return &storageClientSource{
+		storageClient: storageClient,
+		logger:        logger,
+	}
+}
+
+func (s *storageClientSource) String() string {
+	return "storage client"
+}
+
+func (s *storageClientSource) ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	blobStorageClient := s.storageClient.GetBlobService()
+
+	params := storage.ListBlobsParameters{
+		Prefix: prefix,
+	}
+	var names []string
+	for {
+		// The storage SDK does not support contexts, check it between the pages
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		params.Timeout = storageTimeout(ctx)
+		blobList, err := blobStorageClient.GetContainerReference(containerName).ListBlobs(params)
+		if err != nil {
+			s.logger.Warnf("Failed to list container %s blobs with prefix %s from Azure Storage, %s",
+				containerName, prefix, err.Error())
+			return nil, err
+		}
+
+		for _, blob := range blobList.Blobs {
+			names = append(names, blob.Name)
+		}
+
+		// Follow the continuation marker until the listing is complete
+		if blobList.NextMarker == "" {
+			break
+		}
+		params.Marker = blobList.NextMarker
+	}
+
+	s.logger.Infof("Get blob list with prefix %s", prefix)
+	return names, nil
+}
+
+func (s *storageClientSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	blobStorageClient := s.storageClient.GetBlobService()
+
+	blob := blobStorageClient.GetContainerReference(containerName).GetBlobReference(blobName)
+	s.logger.Infof("Get blob form URL %s", blob.GetURL())
+
+	resp, err := blob.Get(&storage.GetBlobOptions{Timeout: storageTimeout(ctx)})
+	if err != nil {
+		s.logger.Warnf("Failed to get container %s blob %s from Azure Storage: %s",
+			containerName, blobName, err.Error())
+		return "", err
+	}
+	defer resp.Close()
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(resp)
+	if err != nil {
+		s.logger.Warnf("Failed to read data from response, %s", err.Error())
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func (s *storageClientSource) GetBlobIfChanged(ctx context.Context, containerName, blobName string,
+	version BlobVersion) (string, BlobVersion, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", BlobVersion{}, false, err
+	}
+	blobStorageClient := s.storageClient.GetBlobService()
+
+	blob := blobStorageClient.GetContainerReference(containerName).GetBlobReference(blobName)
+	s.logger.Infof("Get blob form URL %s", blob.GetURL())
+
+	resp, err := blob.Get(&storage.GetBlobOptions{
+		IfNoneMatch: version.ETag,
+		Timeout:     storageTimeout(ctx),
+	})
+	if err != nil {
+		if statusErr, ok := err.(storage.UnexpectedStatusCodeError); ok &&
+			statusErr.Got() == http.StatusNotModified {
+			s.logger.Infof("Container %s blob %s is not modified", containerName, blobName)
+			return "", version, true, nil
+		}
+		s.logger.Warnf("Failed to get container %s blob %s from Azure Storage: %s",
+			containerName, blobName, err.Error())
+		return "", BlobVersion{}, false, err
+	}
+	defer resp.Close()
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(resp)
+	if err != nil {
+		s.logger.Warnf("Failed to read data from response, %s", err.Error())
+		return "", BlobVersion{}, false, err
+	}
+
+	newVersion := BlobVersion{
+		ETag:         blob.Properties.Etag,
+		LastModified: time.Time(blob.Properties.LastModified).UTC().Format(http.TimeFormat),
+	}
+	return buf.String(), newVersion, false, nil
+}
+
+// storageTimeout returns the server timeout in seconds of a storage SDK request
+// from the context deadline, 0 means the default timeout of the service
+func storageTimeout(ctx context.Context) uint {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	timeout := time.Until(deadline)
+	if timeout < time.Second {
+		return 1
+	}
+	return uint(timeout.Round(time.Second) / time.Second)
+}
@@ -0,0 +1,126 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+// writeFiles writes blobs named by their container and blob name under root
+func writeFiles(root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+}
+
+var _ = Describe("Test local ConfigSource", func() {
+	var (
+		logger *logrus.Entry
+		root   string
+		source ConfigSource
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+
+		files := map[string]string{
+			"cluster/test-cluster/b.yaml":  "b\n",
+			"cluster/test-cluster/a.yaml":  "a\n",
+			"cluster/other-cluster/a.yaml": "other\n",
+			"aksapp/test-type/1.0.0.yaml":  "app\n",
+		}
+		writeFiles(root, files)
+		source = NewLocalSource(root, logger)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Test ListBlobs returns sorted blob names with prefix", func() {
+		names, err := source.ListBlobs(context.Background(), "cluster", "test-cluster/")
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"test-cluster/a.yaml", "test-cluster/b.yaml"}))
+	})
+
+	It("Test ListBlobs with non-existent container", func() {
+		names, err := source.ListBlobs(context.Background(), "non-existent", "")
+		Expect(err).To(BeNil())
+		Expect(names).To(BeEmpty())
+	})
+
+	It("Test GetBlob", func() {
+		data, err := source.GetBlob(context.Background(), "aksapp", "test-type/1.0.0.yaml")
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal("app\n"))
+
+		_, err = source.GetBlob(context.Background(), "aksapp", "test-type/2.0.0.yaml")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Test getBlobsWithPrefix with local source", func() {
+		syncer := NewSyncerWithConfigSource(nil, source, "test-cluster", logger)
+		data, _, err := syncer.getBlobsWithPrefix(context.Background(), "cluster", "test-cluster/")
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal("a\n---\nb\n---\n"))
+	})
+})
+
+var _ = Describe("Test http ConfigSource", func() {
+	var (
+		server *httptest.Server
+		source ConfigSource
+	)
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/cluster", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("comp")).To(Equal("list"))
+			Expect(r.URL.Query().Get("prefix")).To(Equal("test-cluster/"))
+			if r.URL.Query().Get("marker") == "" {
+				fmt.Fprint(w, `<EnumerationResults><Blobs><Blob><Name>test-cluster/a.yaml</Name></Blob></Blobs><NextMarker>m1</NextMarker></EnumerationResults>`)
+				return
+			}
+			fmt.Fprint(w, `<EnumerationResults><Blobs><Blob><Name>test-cluster/b.yaml</Name></Blob></Blobs><NextMarker/></EnumerationResults>`)
+		})
+		mux.HandleFunc("/aksapp/test-type/1.0.0.yaml", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "app\n")
+		})
+		server = httptest.NewServer(mux)
+		source = NewHTTPSource(server.URL+"/", log.New("test-service", "test-version"))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Test ListBlobs follows the continuation marker", func() {
+		names, err := source.ListBlobs(context.Background(), "cluster", "test-cluster/")
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"test-cluster/a.yaml", "test-cluster/b.yaml"}))
+	})
+
+	It("Test GetBlob", func() {
+		data, err := source.GetBlob(context.Background(), "aksapp", "test-type/1.0.0.yaml")
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal("app\n"))
+
+		_, err = source.GetBlob(context.Background(), "aksapp", "test-type/2.0.0.yaml")
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,80 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+)
+
+// ErrVersionOverwritten is returned when the content of an aksapp version
+// changed once written and Options.AllowVersionOverwrite is not set
+var ErrVersionOverwritten = errors.New("content of aksapp version changed")
+
+// checkVersionDigests compares the digest of every aksapp configuration with
+// the one recorded on its ConfigMap. A version is immutable: the operator only
+// reconciles an AksApp when its spec changes, so new content under the same
+// version would not be rolled out and clusters would silently diverge. Such a
+// change fails the sync unless overwrites are allowed, in which case the
+// AksApps using the version get the new digest to be reconciled again.
+func (s *Syncer) checkVersionDigests(ctx context.Context, snap *snapshot) error {
+	overwritten := make(map[string]string)
+	for i := range snap.appConfigs {
+		config := &snap.appConfigs[i]
+		callCtx, cancel := s.callContext(ctx)
+		existing, err := s.kubeClient.CoreV1().ConfigMaps(s.options.Namespace).Get(callCtx,
+			config.configMapName, metav1.GetOptions{})
+		cancel()
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get ConfigMap %s: %s", config.configMapName, err.Error())
+		}
+
+		digest := configmaps.Checksum(config.content)
+		recorded, ok := existing.Annotations[configmaps.ConfigHashAnnotationKey]
+		if !ok || recorded == digest {
+			config.overwritten = existing.Annotations[configmaps.ConfigOverwrittenAnnotationKey]
+		} else if s.options.AllowVersionOverwrite {
+			s.logger.Warnf("Content of aksapp %s version %s changed from %s to %s, reconcile the aksapps using it",
+				config.appType, config.version, recorded, digest)
+			versionOverwritesVec.WithLabelValues(config.appType, versionOverwriteAllowed).Inc()
+			config.overwritten = time.Now().UTC().Format(time.RFC3339)
+		} else {
+			s.logger.Errorf("Content of aksapp %s version %s changed from %s to %s, publish a new version instead",
+				config.appType, config.version, recorded, digest)
+			versionOverwritesVec.WithLabelValues(config.appType, versionOverwriteRefused).Inc()
+			return &BlobError{ContainerName: aksAppContainerName, BlobName: config.blobName,
+				Err: fmt.Errorf("%w: %s %s", ErrVersionOverwritten, config.appType, config.version)}
+		}
+		if config.overwritten != "" {
+			overwritten[config.configMapName] = digest
+		}
+	}
+	if len(overwritten) == 0 {
+		return nil
+	}
+
+	for _, app := range snap.apps {
+		digest, ok := overwritten[configmaps.GetAksAppConfigMapName(*app)]
+		if !ok {
+			continue
+		}
+		if app.Annotations == nil {
+			app.Annotations = make(map[string]string)
+		}
+		app.Annotations[deployerv1.ConfigDigestAnnotationKey] = digest
+	}
+
+	scheme := runtime.NewScheme()
+	_ = deployerv1.AddToScheme(scheme)
+	return snap.serializeApps(scheme)
+}
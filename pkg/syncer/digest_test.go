@@ -0,0 +1,94 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test version digests", func() {
+	var (
+		kubeClient *fake.Clientset
+		root       string
+		syncer     *Syncer
+		changed    string
+	)
+
+	getConfigMap := func(name string) map[string]string {
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(), name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return cm.Annotations
+	}
+
+	getClusterConfig := func() string {
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(),
+			configmaps.ClusterConfigMapName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return cm.Data[configmaps.ConfigDataKey]
+	}
+
+	BeforeEach(func() {
+		var err error
+		logger := log.New("test-service", "test-version")
+		kubeClient = fake.NewSimpleClientset()
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource(root, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+		})
+		Expect(syncer.Run(context.Background())).To(Succeed())
+
+		changed = testAppConfig + "data:\n  changed: \"true\"\n"
+		writeFiles(root, map[string]string{"aksapp/type-a/1.0.0.yaml": changed})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Test Run refuses content changes under the same version", func() {
+		refused := testutil.ToFloat64(versionOverwritesVec.WithLabelValues("type-a", versionOverwriteRefused))
+
+		err := syncer.Run(context.Background())
+		Expect(errors.Is(err, ErrVersionOverwritten)).To(BeTrue())
+		Expect(testutil.ToFloat64(versionOverwritesVec.WithLabelValues("type-a", versionOverwriteRefused))).
+			To(Equal(refused + 1))
+		Expect(getConfigMap("type-a-1.0.0")).To(HaveKeyWithValue(configmaps.ConfigHashAnnotationKey,
+			configmaps.Checksum(testAppConfig)))
+	})
+
+	It("Test Run reconciles the aksapps of overwritten versions when allowed", func() {
+		syncer.SetOptions(Options{Namespace: "test-namespace", AllowVersionOverwrite: true})
+		allowed := testutil.ToFloat64(versionOverwritesVec.WithLabelValues("type-a", versionOverwriteAllowed))
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		Expect(testutil.ToFloat64(versionOverwritesVec.WithLabelValues("type-a", versionOverwriteAllowed))).
+			To(Equal(allowed + 1))
+		annotations := getConfigMap("type-a-1.0.0")
+		Expect(annotations).To(HaveKeyWithValue(configmaps.ConfigHashAnnotationKey, configmaps.Checksum(changed)))
+		Expect(annotations).To(HaveKey(configmaps.ConfigOverwrittenAnnotationKey))
+		Expect(getClusterConfig()).To(ContainSubstring(deployerv1.ConfigDigestAnnotationKey))
+		Expect(getClusterConfig()).To(ContainSubstring(configmaps.Checksum(changed)))
+
+		// The digest is kept by the following syncs
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		Expect(getClusterConfig()).To(ContainSubstring(configmaps.Checksum(changed)))
+		Expect(testutil.ToFloat64(versionOverwritesVec.WithLabelValues("type-a", versionOverwriteAllowed))).
+			To(Equal(allowed + 1))
+	})
+})
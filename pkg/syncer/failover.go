@@ -0,0 +1,227 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/retry"
+)
+
+// failbackInterval is how long a replica which failed is tried after the
+// healthy ones, it is the default interval of the syncs
+const failbackInterval = 5 * time.Minute
+
+// failoverSource reads configurations from the first available of an ordered
+// list of replicas, e.g. storage accounts in different regions
+type failoverSource struct {
+	sources []ConfigSource
+	logger  *logrus.Entry
+
+	lock sync.Mutex
+	// unhealthyUntil is when each replica which failed is tried first again
+	unhealthyUntil []time.Time
+}
+
+// NewFailoverSource returns a ConfigSource reading from the first replica and
+// failing over to the next ones on errors classified as retriable by retry.GetError
+func NewFailoverSource(sources []ConfigSource, logger *logrus.Entry) ConfigSource {
+	for _, source := range sources {
+		sourceHealthyVec.WithLabelValues(source.String()).Set(1)
+	}
+	return &failoverSource{
+		sources:        sources,
+		logger:         logger,
+		unhealthyUntil: make([]time.Time, len(sources)),
+	}
+}
+
+func (f *failoverSource) String() string {
+	names := make([]string, 0, len(f.sources))
+	for _, source := range f.sources {
+		names = append(names, source.String())
+	}
+	return fmt.Sprintf("failover (%s)", strings.Join(names, ", "))
+}
+
+// order returns the replicas in the order they are tried, the healthy ones
+// first followed by the ones which recently failed
+func (f *failoverSource) order() []int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	now := time.Now()
+	var healthy, unhealthy []int
+	for i := range f.sources {
+		if now.Before(f.unhealthyUntil[i]) {
+			unhealthy = append(unhealthy, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (f *failoverSource) setHealthy(i int, healthy bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if healthy {
+		f.unhealthyUntil[i] = time.Time{}
+		sourceHealthyVec.WithLabelValues(f.sources[i].String()).Set(1)
+		return
+	}
+	f.unhealthyUntil[i] = time.Now().Add(failbackInterval)
+	sourceHealthyVec.WithLabelValues(f.sources[i].String()).Set(0)
+}
+
+// do calls fn with the replicas until one succeeds or fails with an error
+// which is not retriable. The call is given up once ctx is done since the
+// next replicas would fail too, they are tried first by the next sync.
+func (f *failoverSource) do(ctx context.Context, fn func(source ConfigSource) error) error {
+	var err error
+	for _, i := range f.order() {
+		source := f.sources[i]
+		if err = fn(source); err == nil {
+			f.setHealthy(i, true)
+			return nil
+		}
+		if !isRetriable(err) {
+			f.setHealthy(i, true)
+			return err
+		}
+
+		f.setHealthy(i, false)
+		if ctx.Err() != nil {
+			return err
+		}
+		f.logger.Warnf("Failed to read from %s, fail over to the next replica, %s", source, err.Error())
+		sourceFailoversVec.WithLabelValues(source.String()).Inc()
+	}
+	return err
+}
+
+func (f *failoverSource) ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	var names []string
+	err := f.do(ctx, func(source ConfigSource) error {
+		var err error
+		names, err = source.ListBlobs(ctx, containerName, prefix)
+		return err
+	})
+	return names, err
+}
+
+func (f *failoverSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	var content string
+	err := f.do(ctx, func(source ConfigSource) error {
+		var err error
+		content, err = source.GetBlob(ctx, containerName, blobName)
+		return err
+	})
+	return content, err
+}
+
+// GetBlobIfChanged reads conditionally from the replicas which support it.
+// The versions of a blob differ across replicas, a version sent to another
+// replica than the one it comes from only makes the blob be downloaded again.
+func (f *failoverSource) GetBlobIfChanged(ctx context.Context, containerName, blobName string,
+	version BlobVersion) (string, BlobVersion, bool, error) {
+	var content string
+	var newVersion BlobVersion
+	var notModified bool
+	err := f.do(ctx, func(source ConfigSource) error {
+		var err error
+		conditional, ok := source.(ConditionalConfigSource)
+		if !ok {
+			newVersion, notModified = BlobVersion{}, false
+			content, err = source.GetBlob(ctx, containerName, blobName)
+			return err
+		}
+		content, newVersion, notModified, err = conditional.GetBlobIfChanged(ctx, containerName, blobName, version)
+		return err
+	})
+	return content, newVersion, notModified, err
+}
+
+// isRetriable classifies an error of a replica with retry.GetError, along
+// with the status code of the response when the error carries one. Timeouts
+// and connectivity errors are retriable, the replica may be unreachable.
+func isRetriable(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return true
+	}
+
+	var resp *http.Response
+	var statusErr *blobclient.StatusError
+	var storageErr storage.AzureStorageServiceError
+	if errors.As(err, &statusErr) {
+		resp = &http.Response{StatusCode: statusErr.StatusCode}
+	} else if errors.As(err, &storageErr) {
+		resp = &http.Response{StatusCode: storageErr.StatusCode}
+	}
+	return retry.GetError(resp, err).Retriable
+}
+
+// CheckDrift compares the blobs of the configuration last written with every
+// replica of a failover source. Drifted blobs are reported by replica, a
+// replica which cannot be reached is skipped since its health is already
+// reported. Every blob is downloaded from every replica, call it on an
+// interval of its own, far longer than the one of the syncs. It must not run
+// concurrently with Run.
+func (s *Syncer) CheckDrift(ctx context.Context) {
+	f, ok := s.source.(*failoverSource)
+	if !ok || s.lastSnapshot == nil {
+		return
+	}
+
+	snap := s.lastSnapshot
+
+	blobs := map[string][]configmaps.SourceBlob{
+		clusterContainerName: snap.clusterSources,
+	}
+	for _, config := range snap.appConfigs {
+		blobs[aksAppContainerName] = append(blobs[aksAppContainerName], config.sources...)
+	}
+
+	for _, source := range f.sources {
+		drifted, err := s.countDriftedBlobs(ctx, source, blobs)
+		if err != nil {
+			s.logger.Warnf("Failed to check the drift of %s, %s", source, err.Error())
+			continue
+		}
+		sourceDriftedBlobsVec.WithLabelValues(source.String()).Set(float64(drifted))
+	}
+}
+
+// countDriftedBlobs returns the number of blobs which differ or are missing on a replica
+func (s *Syncer) countDriftedBlobs(ctx context.Context, source ConfigSource,
+	blobs map[string][]configmaps.SourceBlob) (int, error) {
+	drifted := 0
+	for containerName, containerBlobs := range blobs {
+		for _, blob := range containerBlobs {
+			callCtx, cancel := s.callContext(ctx)
+			content, err := source.GetBlob(callCtx, containerName, blob.Name)
+			cancel()
+			if err != nil && isRetriable(err) {
+				return 0, err
+			}
+			if err == nil && configmaps.NewSourceBlob(blob.Name, content).SHA256 == blob.SHA256 {
+				continue
+			}
+			s.logger.Warnf("Blob %s/%s of %s drifted from the synced configuration", containerName, blob.Name, source)
+			drifted++
+		}
+	}
+	return drifted, nil
+}
@@ -0,0 +1,128 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+// stubSource fails the calls to a ConfigSource with err when set
+type stubSource struct {
+	ConfigSource
+	err   error
+	calls int
+}
+
+func (s *stubSource) ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.ConfigSource.ListBlobs(ctx, containerName, prefix)
+}
+
+func (s *stubSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.ConfigSource.GetBlob(ctx, containerName, blobName)
+}
+
+var _ = Describe("Test failover source", func() {
+	var (
+		logger    *logrus.Entry
+		root      string
+		primary   *stubSource
+		secondary *stubSource
+		source    ConfigSource
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		files := map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+		}
+		for _, replica := range []string{"primary", "secondary"} {
+			writeFiles(filepath.Join(root, replica), files)
+		}
+		primary = &stubSource{ConfigSource: NewLocalSource(filepath.Join(root, "primary"), logger)}
+		secondary = &stubSource{ConfigSource: NewLocalSource(filepath.Join(root, "secondary"), logger)}
+		source = NewFailoverSource([]ConfigSource{primary, secondary}, logger)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Test failover on retriable errors", func() {
+		primary.err = &blobclient.StatusError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")}
+		failovers := testutil.ToFloat64(sourceFailoversVec.WithLabelValues(primary.String()))
+
+		content, err := source.GetBlob(context.Background(), aksAppContainerName, "type-a/1.0.0.yaml")
+		Expect(err).To(BeNil())
+		Expect(content).To(Equal(testAppConfig))
+		Expect(testutil.ToFloat64(sourceFailoversVec.WithLabelValues(primary.String()))).To(Equal(failovers + 1))
+		Expect(testutil.ToFloat64(sourceHealthyVec.WithLabelValues(primary.String()))).To(Equal(float64(0)))
+
+		// The replica which failed is tried last until the failback interval elapses
+		names, err := source.ListBlobs(context.Background(), clusterContainerName, "test-cluster/")
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"test-cluster/a.yaml"}))
+		Expect(primary.calls).To(Equal(1))
+		Expect(secondary.calls).To(Equal(2))
+	})
+
+	It("Test no failover on errors which are not retriable", func() {
+		primary.err = &blobclient.StatusError{StatusCode: http.StatusForbidden, Err: errors.New("forbidden")}
+
+		_, err := source.GetBlob(context.Background(), aksAppContainerName, "type-a/1.0.0.yaml")
+		Expect(err).To(Equal(primary.err))
+		Expect(secondary.calls).To(Equal(0))
+		Expect(testutil.ToFloat64(sourceHealthyVec.WithLabelValues(primary.String()))).To(Equal(float64(1)))
+	})
+
+	It("Test the last error is returned when every replica fails", func() {
+		primary.err = &net.DNSError{Err: "no such host", IsTimeout: true}
+		secondary.err = fmt.Errorf("failed to get response, err: %w", context.DeadlineExceeded)
+
+		_, err := source.GetBlob(context.Background(), aksAppContainerName, "type-a/1.0.0.yaml")
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(primary.calls).To(Equal(1))
+		Expect(secondary.calls).To(Equal(1))
+	})
+
+	It("Test Syncer CheckDrift reports the drift of the replicas", func() {
+		writeFiles(filepath.Join(root, "secondary"), map[string]string{
+			"aksapp/type-a/1.0.0.yaml": testAppConfig + "data:\n  drifted: \"true\"\n",
+		})
+		syncer := NewSyncerWithConfigSource(fake.NewSimpleClientset(), source, "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		// The syncs only read from the healthy primary
+		Expect(secondary.calls).To(Equal(0))
+
+		syncer.CheckDrift(context.Background())
+		Expect(testutil.ToFloat64(sourceDriftedBlobsVec.WithLabelValues(primary.String()))).To(Equal(float64(0)))
+		Expect(testutil.ToFloat64(sourceDriftedBlobsVec.WithLabelValues(secondary.String()))).To(Equal(float64(1)))
+	})
+})
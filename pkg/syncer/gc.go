@@ -0,0 +1,218 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+)
+
+const (
+	// DefaultGCGracePeriod is how long an obsolete aksapp ConfigMap is kept by default
+	DefaultGCGracePeriod = time.Hour
+	// DefaultGCRetainVersions is how many obsolete versions of an aksapp type are kept by default
+	DefaultGCRetainVersions = 2
+)
+
+// obsoleteVersion is the ConfigMaps of an aksapp version no longer referenced
+// by the cluster configuration, including the chunks of large configurations
+type obsoleteVersion struct {
+	version       string
+	obsoleteSince time.Time
+	configMaps    []corev1.ConfigMap
+}
+
+// managedLabels returns the labels of the ConfigMaps written by the syncer,
+// appType and version are empty for the cluster configuration
+func managedLabels(appType, version string) map[string]string {
+	labels := map[string]string{
+		configmaps.ManagedByLabelKey: configmaps.ManagedBySyncer,
+	}
+	if appType != "" {
+		labels[configmaps.AppTypeLabelKey] = appType
+		labels[configmaps.AppVersionLabelKey] = version
+	}
+	return labels
+}
+
+// cleanUpObsoleteConfigMaps garbage-collects the aksapp ConfigMaps written by
+// the syncer whose version is no longer referenced. currentVersions maps the
+// aksapp types of the cluster configuration to their version.
+//
+// An obsolete version is first marked with the time it became obsolete. It is
+// deleted once the grace period expired, unless it is one of the most recent
+// obsolete versions of its type kept for rollbacks.
+func (s *Syncer) cleanUpObsoleteConfigMaps(ctx context.Context, currentVersions map[string]string) error {
+	namespace := s.options.Namespace
+	now := time.Now()
+
+	if !s.legacyConfigMapsLabeled {
+		if err := s.labelLegacyConfigMaps(ctx, currentVersions); err != nil {
+			s.logger.Errorf("Error when label legacy configmaps: %s", err.Error())
+			return err
+		}
+		s.legacyConfigMapsLabeled = true
+	}
+
+	selector := fmt.Sprintf("%s=%s,%s", configmaps.ManagedByLabelKey, configmaps.ManagedBySyncer,
+		configmaps.AppTypeLabelKey)
+	listCtx, cancel := s.callContext(ctx)
+	defer cancel()
+	configMapList, err := s.kubeClient.CoreV1().ConfigMaps(namespace).List(listCtx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		s.logger.Errorf("Error when list configmaps: %s", err.Error())
+		return err
+	}
+
+	// Group the obsolete ConfigMaps by type and version
+	obsolete := make(map[string]map[string]*obsoleteVersion)
+	for _, c := range configMapList.Items {
+		appType := c.Labels[configmaps.AppTypeLabelKey]
+		version := c.Labels[configmaps.AppVersionLabelKey]
+		if current, ok := currentVersions[appType]; ok && current == version {
+			continue
+		}
+
+		since, err := s.markConfigMapObsolete(ctx, &c, now)
+		if err != nil {
+			s.logger.Errorf("Error when mark configmap %s obsolete: %s", c.Name, err.Error())
+			return err
+		}
+
+		if obsolete[appType] == nil {
+			obsolete[appType] = make(map[string]*obsoleteVersion)
+		}
+		v, ok := obsolete[appType][version]
+		if !ok {
+			v = &obsoleteVersion{version: version, obsoleteSince: since}
+			obsolete[appType][version] = v
+		}
+		if since.Before(v.obsoleteSince) {
+			v.obsoleteSince = since
+		}
+		v.configMaps = append(v.configMaps, c)
+	}
+
+	for appType, versions := range obsolete {
+		var sorted []*obsoleteVersion
+		for _, v := range versions {
+			sorted = append(sorted, v)
+		}
+		// Most recently obsoleted versions first
+		sort.Slice(sorted, func(i, j int) bool {
+			if sorted[i].obsoleteSince.Equal(sorted[j].obsoleteSince) {
+				return sorted[i].version > sorted[j].version
+			}
+			return sorted[i].obsoleteSince.After(sorted[j].obsoleteSince)
+		})
+
+		for i, v := range sorted {
+			if i < s.options.GCRetainVersions {
+				s.logger.Infof("Keep obsolete version %s of aksapp %s for rollbacks", v.version, appType)
+				continue
+			}
+			if now.Sub(v.obsoleteSince) < s.options.GCGracePeriod {
+				s.logger.Infof("Keep obsolete version %s of aksapp %s until the grace period expires", v.version, appType)
+				continue
+			}
+
+			for _, c := range v.configMaps {
+				s.logger.Infof("Cleanup obsolete configmap %s", c.Name)
+				deleteCtx, cancel := s.callContext(ctx)
+				err = s.kubeClient.CoreV1().ConfigMaps(namespace).Delete(deleteCtx, c.Name, metav1.DeleteOptions{})
+				cancel()
+				if err != nil {
+					s.logger.Errorf("Error when delete configmap %s: %s", c.Name, err.Error())
+					return err
+				}
+				configMapOperationVec.WithLabelValues(configMapOperationDelete).Inc()
+				s.logger.Infof("Successfully delete configmap %s", c.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// labelLegacyConfigMaps labels the aksapp ConfigMaps written before the syncer
+// labeled them, so that they are garbage-collected like the others. They are
+// the unlabeled ConfigMaps with a blob URL named <type>-<version> after an
+// aksapp type of the cluster configuration, the longest type matching the name
+// wins as it did for the previous garbage collection. It runs once per syncer.
+func (s *Syncer) labelLegacyConfigMaps(ctx context.Context, currentVersions map[string]string) error {
+	namespace := s.options.Namespace
+	listCtx, cancel := s.callContext(ctx)
+	defer cancel()
+	configMapList, err := s.kubeClient.CoreV1().ConfigMaps(namespace).List(listCtx, metav1.ListOptions{
+		LabelSelector: "!" + configmaps.ManagedByLabelKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range configMapList.Items {
+		if _, ok := c.Annotations[configmaps.ConfigAnnotationKey]; !ok {
+			continue
+		}
+		appType := ""
+		for t := range currentVersions {
+			if strings.HasPrefix(c.Name, t+"-") && len(t) > len(appType) {
+				appType = t
+			}
+		}
+		if appType == "" {
+			continue
+		}
+
+		if c.Labels == nil {
+			c.Labels = make(map[string]string)
+		}
+		for key, value := range managedLabels(appType, strings.TrimPrefix(c.Name, appType+"-")) {
+			c.Labels[key] = value
+		}
+		updateCtx, cancel := s.callContext(ctx)
+		_, err = s.kubeClient.CoreV1().ConfigMaps(namespace).Update(updateCtx, &c, metav1.UpdateOptions{})
+		cancel()
+		if err != nil {
+			return err
+		}
+		s.logger.Infof("Labeled legacy configmap %s of aksapp %s", c.Name, appType)
+	}
+	return nil
+}
+
+// markConfigMapObsolete returns since when the ConfigMap is obsolete, ConfigMaps
+// found obsolete for the first time are annotated with now
+func (s *Syncer) markConfigMapObsolete(ctx context.Context, c *corev1.ConfigMap, now time.Time) (time.Time, error) {
+	if value, ok := c.Annotations[configmaps.ObsoleteSinceAnnotationKey]; ok {
+		since, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return since, nil
+		}
+		s.logger.Warnf("Configmap %s has an invalid %s annotation %q, reset it",
+			c.Name, configmaps.ObsoleteSinceAnnotationKey, value)
+	}
+
+	if c.Annotations == nil {
+		c.Annotations = make(map[string]string)
+	}
+	c.Annotations[configmaps.ObsoleteSinceAnnotationKey] = now.UTC().Format(time.RFC3339)
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+	updated, err := s.kubeClient.CoreV1().ConfigMaps(c.Namespace).Update(ctx, c, metav1.UpdateOptions{})
+	if err != nil {
+		return time.Time{}, err
+	}
+	*c = *updated
+
+	s.logger.Infof("Configmap %s is obsolete", c.Name)
+	return now, nil
+}
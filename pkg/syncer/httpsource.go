@@ -0,0 +1,155 @@
+package syncer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const httpSourceTimeout = 30 * time.Second
+
+// httpSource reads configurations over plain HTTP without authentication, e.g.
+// from a container with public read access, a storage emulator or a static
+// mirror. Blobs are fetched from <baseURL>/<containerName>/<blobName> and listed
+// with the List Blobs API of the storage service.
+type httpSource struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *logrus.Entry
+}
+
+// NewHTTPSource returns a ConfigSource reading from baseURL over plain HTTP
+func NewHTTPSource(baseURL string, logger *logrus.Entry) ConfigSource {
+	return &httpSource{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: httpSourceTimeout},
+		logger:     logger,
+	}
+}
+
+func (h *httpSource) String() string {
+	return fmt.Sprintf("http (%s)", h.baseURL)
+}
+
+func (h *httpSource) ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	query := url.Values{}
+	query.Set("restype", "container")
+	query.Set("comp", "list")
+	query.Set("prefix", prefix)
+
+	var names []string
+	for {
+		listURL := fmt.Sprintf("%s/%s?%s", h.baseURL, containerName, query.Encode())
+		data, err := h.get(ctx, listURL)
+		if err != nil {
+			h.logger.Errorf("Failed to list container %s blobs with prefix %s over http, %s",
+				containerName, prefix, err.Error())
+			return nil, err
+		}
+
+		var out storage.BlobListResponse
+		if err = xml.Unmarshal(data, &out); err != nil {
+			h.logger.Errorf("Failed to unmarshal blob list from %s, %s", listURL, err.Error())
+			return nil, err
+		}
+		for _, blob := range out.Blobs {
+			names = append(names, blob.Name)
+		}
+
+		if out.NextMarker == "" {
+			break
+		}
+		query.Set("marker", out.NextMarker)
+	}
+
+	h.logger.Infof("Successfully list blobs in container %s with prefix %s",
+		containerName, prefix)
+	return names, nil
+}
+
+func (h *httpSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	blobURL := fmt.Sprintf("%s/%s/%s", h.baseURL, containerName, blobName)
+	data, err := h.get(ctx, blobURL)
+	if err != nil {
+		h.logger.Errorf("Failed to get container %s blob %s over http, %s",
+			containerName, blobName, err.Error())
+		return "", err
+	}
+
+	h.logger.Infof("Successfully get data from container %s blob %s",
+		containerName, blobName)
+	return string(data), nil
+}
+
+func (h *httpSource) GetBlobIfChanged(ctx context.Context, containerName, blobName string,
+	version BlobVersion) (string, BlobVersion, bool, error) {
+	blobURL := fmt.Sprintf("%s/%s/%s", h.baseURL, containerName, blobName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, blobURL, nil)
+	if err != nil {
+		return "", BlobVersion{}, false, err
+	}
+	// If-None-Match takes precedence, fall back to Last-Modified for servers without ETags
+	if version.ETag != "" {
+		req.Header.Set("If-None-Match", version.ETag)
+	} else if version.LastModified != "" {
+		req.Header.Set("If-Modified-Since", version.LastModified)
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		h.logger.Errorf("Failed to get container %s blob %s over http, %s",
+			containerName, blobName, err.Error())
+		return "", BlobVersion{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		h.logger.Infof("Container %s blob %s is not modified", containerName, blobName)
+		return "", version, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, blobURL)
+		h.logger.Errorf("Failed to get container %s blob %s over http, %s",
+			containerName, blobName, err.Error())
+		return "", BlobVersion{}, false, err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", BlobVersion{}, false, err
+	}
+
+	h.logger.Infof("Successfully get data from container %s blob %s",
+		containerName, blobName)
+	newVersion := BlobVersion{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	return string(data), newVersion, false, nil
+}
+
+func (h *httpSource) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,93 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// localSource reads configurations from a local directory laid out like the
+// storage account, i.e. <root>/<containerName>/<blobName>
+type localSource struct {
+	root   string
+	logger *logrus.Entry
+}
+
+// NewLocalSource returns a ConfigSource reading from a local directory
+func NewLocalSource(root string, logger *logrus.Entry) ConfigSource {
+	return &localSource{
+		root:   root,
+		logger: logger,
+	}
+}
+
+func (l *localSource) String() string {
+	return fmt.Sprintf("local directory (%s)", l.root)
+}
+
+func (l *localSource) ListBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	containerDir := filepath.Join(l.root, containerName)
+	if _, err := os.Stat(containerDir); err != nil {
+		if os.IsNotExist(err) {
+			l.logger.Warnf("Container directory %s does not exist", containerDir)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	err := filepath.Walk(containerDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(containerDir, path)
+		if err != nil {
+			return err
+		}
+		// Blob names always use '/' as the separator
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		l.logger.Errorf("Failed to list directory %s with prefix %s, %s",
+			containerDir, prefix, err.Error())
+		return nil, err
+	}
+
+	// Keep the same order as the storage service which lists blobs lexicographically
+	sort.Strings(names)
+	l.logger.Infof("Successfully list files in directory %s with prefix %s",
+		containerDir, prefix)
+	return names, nil
+}
+
+func (l *localSource) GetBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(l.root, containerName, filepath.FromSlash(blobName))
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		l.logger.Errorf("Failed to read file %s, %s", path, err.Error())
+		return "", err
+	}
+
+	l.logger.Infof("Successfully read data from file %s", path)
+	return string(data), nil
+}
@@ -0,0 +1,201 @@
+package syncer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	syncResultSucceeded = "succeeded"
+	syncResultFailed    = "failed"
+
+	fetchOperationList = "list"
+	fetchOperationGet  = "get"
+
+	fetchResultDownloaded  = "downloaded"
+	fetchResultNotModified = "not_modified"
+	fetchResultFailed      = "failed"
+
+	configMapOperationCreate = "create"
+	configMapOperationUpdate = "update"
+	configMapOperationDelete = "delete"
+
+	signatureResultVerified = "verified"
+	signatureResultMissing  = "missing"
+	signatureResultInvalid  = "invalid"
+
+	versionOverwriteAllowed = "allowed"
+	versionOverwriteRefused = "refused"
+)
+
+var (
+	lastSuccessfulSyncGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Help:      "The Unix timestamp of the last successful sync",
+			Name:      "last_successful_sync_timestamp_seconds",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+	)
+
+	consecutiveFailedSyncsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Help:      "The number of consecutive failed syncs",
+			Name:      "consecutive_failed_syncs",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+	)
+
+	syncResultVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of syncs by result",
+			Name:      "syncs_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"result",
+		},
+	)
+
+	blobsFetchedVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of blobs fetched from the configuration source",
+			Name:      "blobs_fetched_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"container",
+			"result",
+		},
+	)
+
+	bytesTransferredVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of bytes downloaded from the configuration source",
+			Name:      "bytes_transferred_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"container",
+		},
+	)
+
+	fetchLatencyVec = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Help:      "The latency in seconds of the requests to the configuration source",
+			Name:      "fetch_duration_seconds",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{
+			"container",
+			"operation",
+		},
+	)
+
+	configMapOperationVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of ConfigMaps created, updated or deleted",
+			Name:      "configmap_operations_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"operation",
+		},
+	)
+
+	parseFailuresVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of configurations which failed to be parsed",
+			Name:      "parse_failures_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"container",
+		},
+	)
+
+	signatureVerificationsVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of blob signature verifications by result",
+			Name:      "signature_verifications_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"container",
+			"result",
+		},
+	)
+
+	versionOverwritesVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of aksapp versions whose content changed once written by result",
+			Name:      "version_overwrites_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"app_type",
+			"result",
+		},
+	)
+
+	sourceHealthyVec = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Help:      "Whether the last call to a replica of the configuration succeeded (1) or failed with a retriable error (0)",
+			Name:      "source_healthy",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"source",
+		},
+	)
+
+	sourceFailoversVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Help:      "The number of calls failed over from a replica of the configuration to the next one",
+			Name:      "source_failovers_total",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"source",
+		},
+	)
+
+	sourceDriftedBlobsVec = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Help:      "The number of blobs of the last synced configuration which differ or are missing on a replica",
+			Name:      "source_drifted_blobs",
+			Namespace: "deployer",
+			Subsystem: "syncer",
+		},
+		[]string{
+			"source",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(lastSuccessfulSyncGauge)
+	prometheus.MustRegister(consecutiveFailedSyncsGauge)
+	prometheus.MustRegister(syncResultVec)
+	prometheus.MustRegister(blobsFetchedVec)
+	prometheus.MustRegister(bytesTransferredVec)
+	prometheus.MustRegister(fetchLatencyVec)
+	prometheus.MustRegister(configMapOperationVec)
+	prometheus.MustRegister(parseFailuresVec)
+	prometheus.MustRegister(signatureVerificationsVec)
+	prometheus.MustRegister(versionOverwritesVec)
+	prometheus.MustRegister(sourceHealthyVec)
+	prometheus.MustRegister(sourceFailoversVec)
+	prometheus.MustRegister(sourceDriftedBlobsVec)
+}
@@ -0,0 +1,160 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+const (
+	// Reserved prefixes of the cluster container holding the layers shared by
+	// several clusters, cluster names never start with '_'
+	globalLayerPrefix      = "_global/"
+	environmentLayerPrefix = "_env/%s/"
+	regionLayerPrefix      = "_region/%s/"
+
+	// provenanceToggles is the provenance of the versions overridden by toggles
+	provenanceToggles = "toggles"
+)
+
+// configLayer is a folder of the cluster container contributing AksApps to
+// the cluster configuration
+type configLayer struct {
+	prefix string
+	apps   []*deployerv1.AksApp
+}
+
+// Provenance records which layer set each field of the AksApps of the cluster
+// configuration. It maps the namespace/name of the AksApps to their field
+// paths, e.g. "version" or "variables.FOO", and to the prefix of the layer.
+type Provenance map[string]map[string]string
+
+func (p Provenance) set(app *deployerv1.AksApp, field, layer string) {
+	nn := app.Namespace + "/" + app.Name
+	if p[nn] == nil {
+		p[nn] = make(map[string]string)
+	}
+	p[nn][field] = layer
+}
+
+// clusterLayerPrefixes returns the prefixes of the layers of the cluster
+// configuration from the most general to the most specific: global,
+// environment, region and cluster
+func (s *Syncer) clusterLayerPrefixes() []string {
+	target := s.toggleTarget()
+	prefixes := []string{globalLayerPrefix}
+	if target.Environment != "" {
+		prefixes = append(prefixes, fmt.Sprintf(environmentLayerPrefix, target.Environment))
+	}
+	if target.Region != "" {
+		prefixes = append(prefixes, fmt.Sprintf(regionLayerPrefix, target.Region))
+	}
+	return append(prefixes, s.clusterName+"/")
+}
+
+// isClusterLayerBlob checks if the blob of the cluster container belongs to
+// one of the layers of the cluster configuration
+func (s *Syncer) isClusterLayerBlob(blobName string) bool {
+	for _, prefix := range s.clusterLayerPrefixes() {
+		if strings.HasPrefix(blobName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeLayers merges the AksApps of the layers by namespace/name, a more
+// specific layer overrides the type and version of an AksApp and its
+// variables, credentials and secrets key by key. The AksApps are returned in
+// the order they are first defined.
+func mergeLayers(layers []configLayer) ([]*deployerv1.AksApp, Provenance) {
+	provenance := make(Provenance)
+	merged := make(map[string]*deployerv1.AksApp)
+	var apps []*deployerv1.AksApp
+
+	for _, layer := range layers {
+		for _, app := range layer.apps {
+			nn := app.Namespace + "/" + app.Name
+			base, ok := merged[nn]
+			if !ok {
+				base = app.DeepCopy()
+				base.Spec = deployerv1.AksAppSpec{}
+				merged[nn] = base
+				apps = append(apps, base)
+			}
+			mergeAksApp(base, app, layer.prefix, provenance)
+		}
+	}
+
+	return apps, provenance
+}
+
+// mergeAksApp overrides the fields of base set by app
+func mergeAksApp(base, app *deployerv1.AksApp, layer string, provenance Provenance) {
+	if app.Spec.Type != "" {
+		base.Spec.Type = app.Spec.Type
+		provenance.set(base, "type", layer)
+	}
+	if app.Spec.Version != "" {
+		base.Spec.Version = app.Spec.Version
+		provenance.set(base, "version", layer)
+	}
+	base.Spec.Variables = mergeValues(base, base.Spec.Variables, app.Spec.Variables, "variables", layer, provenance)
+	base.Spec.Credentials = mergeValues(base, base.Spec.Credentials, app.Spec.Credentials, "credentials", layer, provenance)
+	base.Spec.Secrets = mergeValues(base, base.Spec.Secrets, app.Spec.Secrets, "secrets", layer, provenance)
+	if app.Spec.UnmanagedSecrets != nil {
+		base.Spec.UnmanagedSecrets = append([]string{}, app.Spec.UnmanagedSecrets...)
+		provenance.set(base, "unmanagedSecrets", layer)
+	}
+	for key, value := range app.Labels {
+		if base.Labels == nil {
+			base.Labels = make(map[string]string)
+		}
+		base.Labels[key] = value
+	}
+	for key, value := range app.Annotations {
+		if base.Annotations == nil {
+			base.Annotations = make(map[string]string)
+		}
+		base.Annotations[key] = value
+	}
+}
+
+func mergeValues(app *deployerv1.AksApp, base, values map[string]string, field, layer string,
+	provenance Provenance) map[string]string {
+	for key, value := range values {
+		if base == nil {
+			base = make(map[string]string)
+		}
+		base[key] = value
+		provenance.set(app, field+"."+key, layer)
+	}
+	return base
+}
+
+// composeClusterConfig replaces the AksApps and the configuration of the
+// snapshot with the merge of the layers. The configuration of a cluster
+// defined by its folder only is kept as is.
+func (s *Syncer) composeClusterConfig(snap *snapshot, layers []configLayer, scheme *runtime.Scheme) error {
+	apps, provenance := mergeLayers(layers)
+	snap.apps = apps
+	snap.provenance = provenance
+	if len(layers) == 1 && layers[0].prefix == s.clusterName+"/" {
+		return nil
+	}
+
+	return snap.serializeApps(scheme)
+}
+
+// provenanceAnnotation returns the value of the provenance annotation of the cluster ConfigMap
+func provenanceAnnotation(provenance Provenance) (string, error) {
+	data, err := json.Marshal(provenance)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,153 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+const testGlobalLayer = `apiVersion: deployer.aks/v1
+kind: AksApp
+metadata:
+  name: app-a
+  namespace: deployer
+spec:
+  type: type-a
+  version: 1.0.0
+  variables:
+    LOG_LEVEL: info
+    REPLICAS: "1"
+  secrets:
+    TOKEN: global-token
+---
+apiVersion: deployer.aks/v1
+kind: AksApp
+metadata:
+  name: app-b
+  namespace: deployer
+spec:
+  type: type-b
+  version: 2.0.0
+`
+
+const testEnvironmentLayer = `apiVersion: deployer.aks/v1
+kind: AksApp
+metadata:
+  name: app-a
+  namespace: deployer
+spec:
+  version: 1.1.0
+  variables:
+    REPLICAS: "3"
+`
+
+const testClusterLayer = `apiVersion: deployer.aks/v1
+kind: AksApp
+metadata:
+  name: app-a
+  namespace: deployer
+spec:
+  secrets:
+    TOKEN: cluster-token
+`
+
+var _ = Describe("Test Syncer Run with overlays", func() {
+	var (
+		logger     *logrus.Entry
+		kubeClient *fake.Clientset
+		root       string
+		syncer     *Syncer
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		kubeClient = fake.NewSimpleClientset()
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource(root, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace", Region: "eastus"})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Test Run merges the layers of the cluster configuration", func() {
+		writeFiles(root, map[string]string{
+			"cluster/_global/apps.yaml":          testGlobalLayer,
+			"cluster/_env/prod/apps.yaml":        testEnvironmentLayer,
+			"cluster/_env/staging/apps.yaml":     testClusterConfig("app-a", "type-a", "9.9.9"),
+			"cluster/_region/westus/apps.yaml":   testClusterConfig("app-a", "type-a", "9.9.9"),
+			"cluster/test-cluster/apps.yaml":     testClusterLayer,
+			"cluster/other-cluster/apps.yaml":    testClusterConfig("app-a", "type-a", "9.9.9"),
+			"aksapp/type-a/1.1.0.yaml":           testAppConfig,
+			"aksapp/type-b/2.0.0.yaml":           testAppConfig,
+			"cluster/_region/eastus/unused.yaml": "",
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(),
+			configmaps.ClusterConfigMapName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+
+		scheme := runtime.NewScheme()
+		_ = deployerv1.AddToScheme(scheme)
+		objs, err := configmaps.ParseConfig(logger, scheme, cm.Data[configmaps.ConfigDataKey])
+		Expect(err).To(BeNil())
+		Expect(objs).To(HaveLen(2))
+		app := objs[0].(*deployerv1.AksApp)
+		Expect(app.Name).To(Equal("app-a"))
+		Expect(app.Spec.Type).To(Equal("type-a"))
+		Expect(app.Spec.Version).To(Equal("1.1.0"))
+		Expect(app.Spec.Variables).To(Equal(map[string]string{"LOG_LEVEL": "info", "REPLICAS": "3"}))
+		Expect(app.Spec.Secrets).To(Equal(map[string]string{"TOKEN": "cluster-token"}))
+		Expect(objs[1].(*deployerv1.AksApp).Spec.Version).To(Equal("2.0.0"))
+
+		var provenance Provenance
+		Expect(json.Unmarshal([]byte(cm.Annotations[configmaps.ConfigProvenanceAnnotationKey]), &provenance)).To(Succeed())
+		Expect(provenance["deployer/app-a"]).To(Equal(map[string]string{
+			"type":                "_global/",
+			"version":             "_env/prod/",
+			"variables.LOG_LEVEL": "_global/",
+			"variables.REPLICAS":  "_env/prod/",
+			"secrets.TOKEN":       "test-cluster/",
+		}))
+	})
+
+	It("Test Run does not need a cluster folder", func() {
+		writeFiles(root, map[string]string{
+			"cluster/_global/apps.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml":  testAppConfig,
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		Expect(syncer.IsBlobRelevant(clusterContainerName, "_global/apps.yaml")).To(BeTrue())
+		Expect(syncer.IsBlobRelevant(clusterContainerName, "_region/eastus/apps.yaml")).To(BeTrue())
+		Expect(syncer.IsBlobRelevant(clusterContainerName, "_region/westus/apps.yaml")).To(BeFalse())
+	})
+
+	It("Test Run rejects AksApps defined twice in one layer", func() {
+		writeFiles(root, map[string]string{
+			"cluster/_global/a.yaml":   testClusterConfig("app-a", "type-a", "1.0.0"),
+			"cluster/_global/b.yaml":   testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml": testAppConfig,
+		})
+
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("_global/"))
+	})
+})
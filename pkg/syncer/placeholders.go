@@ -0,0 +1,141 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/Azure/aks-deployer/pkg/deploy"
+)
+
+const (
+	// valuesBlobNameFormat is the per-cluster values file of the cluster
+	// container, a flat map of placeholder names to values
+	valuesBlobNameFormat = "_values/%s.yaml"
+
+	placeholderClusterName      = "CLUSTER_NAME"
+	placeholderRegion           = "REGION"
+	placeholderDeployEnv        = "DEPLOY_ENV"
+	placeholderToggleURL        = "TOGGLE_URL"
+	placeholderE2EVersionString = "E2E_VERSION_STRING"
+)
+
+// placeholderRegexp matches ${NAME} and the escaped form $${NAME}
+var placeholderRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// builtinPlaceholders returns the placeholders describing the cluster. The
+// ones which are unknown, e.g. the region when it is not set, are left out so
+// using them fails as unresolved rather than resolving to an empty string.
+func (s *Syncer) builtinPlaceholders() map[string]string {
+	config := deploy.GetDeploymentConfig()
+	builtins := map[string]string{
+		placeholderClusterName:      s.clusterName,
+		placeholderRegion:           s.options.Region,
+		placeholderDeployEnv:        s.environment(),
+		placeholderToggleURL:        s.options.ToggleURL,
+		placeholderE2EVersionString: config.E2EConfig.VersionString,
+	}
+	values := make(map[string]string)
+	for name, value := range builtins {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+func isBuiltinPlaceholder(name string) bool {
+	switch name {
+	case placeholderClusterName, placeholderRegion, placeholderDeployEnv, placeholderToggleURL,
+		placeholderE2EVersionString:
+		return true
+	}
+	return false
+}
+
+// fetchPlaceholders returns the values of the placeholders of the cluster
+// configuration: the built-in placeholders and the values file of the cluster.
+// The values file cannot redefine a built-in placeholder.
+func (s *Syncer) fetchPlaceholders(ctx context.Context, snap *snapshot) (map[string]string, error) {
+	values := s.builtinPlaceholders()
+
+	valuesBlobName := fmt.Sprintf(valuesBlobNameFormat, s.clusterName)
+	blobNames, err := s.listBlobs(ctx, clusterContainerName, valuesBlobName)
+	if err != nil {
+		return nil, &BlobError{ContainerName: clusterContainerName, BlobName: valuesBlobName, Err: err}
+	}
+	found := false
+	for _, blobName := range blobNames {
+		if blobName == valuesBlobName {
+			found = true
+		}
+	}
+	if !found {
+		return values, nil
+	}
+
+	content, source, err := s.getSourceBlob(ctx, clusterContainerName, valuesBlobName)
+	if err != nil {
+		return nil, &BlobError{ContainerName: clusterContainerName, BlobName: valuesBlobName, Err: err}
+	}
+	snap.clusterSources = append(snap.clusterSources, source)
+
+	clusterValues := make(map[string]string)
+	if strings.TrimSpace(content) != "" {
+		decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(content)), len(content))
+		if err := decoder.Decode(&clusterValues); err != nil {
+			parseFailuresVec.WithLabelValues(clusterContainerName).Inc()
+			return nil, &BlobError{ContainerName: clusterContainerName, BlobName: valuesBlobName, Err: err}
+		}
+	}
+	for name, value := range clusterValues {
+		if isBuiltinPlaceholder(name) {
+			return nil, &BlobError{ContainerName: clusterContainerName, BlobName: valuesBlobName,
+				Err: fmt.Errorf("placeholder %s is built-in and cannot be redefined", name)}
+		}
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// substitutePlaceholders replaces the ${NAME} placeholders of the configuration
+// with their values, $${NAME} is written as ${NAME}. Comment lines are left
+// untouched. It fails with the names of the unresolved placeholders.
+func substitutePlaceholders(data string, values map[string]string) (string, error) {
+	unresolved := make(map[string]bool)
+	lines := strings.SplitAfter(data, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		lines[i] = placeholderRegexp.ReplaceAllStringFunc(line, func(match string) string {
+			if strings.HasPrefix(match, "$$") {
+				return match[1:]
+			}
+			name := placeholderRegexp.FindStringSubmatch(match)[1]
+			value, ok := values[name]
+			if !ok {
+				unresolved[name] = true
+				return match
+			}
+			return value
+		})
+	}
+
+	if len(unresolved) > 0 {
+		var names []string
+		for name := range unresolved {
+			names = append(names, "${"+name+"}")
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unresolved placeholders %s", strings.Join(names, ", "))
+	}
+
+	return strings.Join(lines, ""), nil
+}
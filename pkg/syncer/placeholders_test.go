@@ -0,0 +1,153 @@
+package syncer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+const testPlaceholderClusterConfig = `apiVersion: deployer.aks/v1
+kind: AksApp
+metadata:
+  name: ccp-pool-controller
+  namespace: deployer
+spec:
+  type: ccp-pool-controller
+  version: ${CCP_POOL_CONTROLLER_VERSION}
+  variables:
+    # Set by ${CLUSTER_NAME} in ${UNDOCUMENTED}
+    CLUSTER: ${CLUSTER_NAME}-${REGION}
+    TOGGLE_URL: ${TOGGLE_URL}
+    TEMPLATE: $${NOT_A_PLACEHOLDER}
+`
+
+var _ = Describe("Test placeholders", func() {
+	It("Test substitutePlaceholders", func() {
+		data, err := substitutePlaceholders("a: ${A}\n# ${B}\nb: $${B}-${A}\n", map[string]string{"A": "1"})
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal("a: 1\n# ${B}\nb: ${B}-1\n"))
+	})
+
+	It("Test substitutePlaceholders reports every unresolved placeholder", func() {
+		_, err := substitutePlaceholders("a: ${B}\nb: ${A}\nc: ${B}\n", map[string]string{})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("unresolved placeholders ${A}, ${B}"))
+	})
+})
+
+var _ = Describe("Test Syncer Run with placeholders", func() {
+	var (
+		logger     *logrus.Entry
+		kubeClient *fake.Clientset
+		root       string
+		server     *httptest.Server
+		syncer     *Syncer
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		kubeClient = fake.NewSimpleClientset()
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("{}"))
+		}))
+		syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource(root, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace", Region: "eastus", ToggleURL: server.URL})
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(root)
+	})
+
+	It("Test Run substitutes placeholders from the cluster metadata and values file", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/apps.yaml":        testPlaceholderClusterConfig,
+			"cluster/_values/test-cluster.yaml":     "CCP_POOL_CONTROLLER_VERSION: 1.2.3\n",
+			"aksapp/ccp-pool-controller/1.2.3.yaml": testAppConfig,
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(),
+			configmaps.ClusterConfigMapName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+
+		scheme := runtime.NewScheme()
+		_ = deployerv1.AddToScheme(scheme)
+		objs, err := configmaps.ParseConfig(logger, scheme, cm.Data[configmaps.ConfigDataKey])
+		Expect(err).To(BeNil())
+		app := objs[0].(*deployerv1.AksApp)
+		Expect(app.Spec.Version).To(Equal("1.2.3"))
+		Expect(app.Spec.Variables).To(Equal(map[string]string{
+			"CLUSTER":    "test-cluster-eastus",
+			"TOGGLE_URL": server.URL,
+			"TEMPLATE":   "${NOT_A_PLACEHOLDER}",
+		}))
+		Expect(syncer.IsBlobRelevant(clusterContainerName, "_values/test-cluster.yaml")).To(BeTrue())
+	})
+
+	It("Test Run fails on unresolved placeholders", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/apps.yaml": testPlaceholderClusterConfig,
+		})
+
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("unresolved placeholders ${CCP_POOL_CONTROLLER_VERSION}"))
+		list, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(context.Background(), metav1.ListOptions{})
+		Expect(list.Items).To(BeEmpty())
+	})
+
+	It("Test Run fails on built-in placeholders which are not set", func() {
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/apps.yaml":        testPlaceholderClusterConfig,
+			"cluster/_values/test-cluster.yaml":     "CCP_POOL_CONTROLLER_VERSION: 1.2.3\n",
+			"aksapp/ccp-pool-controller/1.2.3.yaml": testAppConfig,
+		})
+
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("unresolved placeholders ${REGION}, ${TOGGLE_URL}"))
+	})
+
+	It("Test Run rejects values defining built-in placeholders which are not set", func() {
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/apps.yaml":    testClusterConfig("app-a", "type-a", "1.0.0"),
+			"cluster/_values/test-cluster.yaml": "REGION: westus\n",
+			"aksapp/type-a/1.0.0.yaml":          testAppConfig,
+		})
+
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("REGION"))
+	})
+
+	It("Test Run rejects values redefining built-in placeholders", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/apps.yaml":    testClusterConfig("app-a", "type-a", "1.0.0"),
+			"cluster/_values/test-cluster.yaml": "REGION: westus\n",
+			"aksapp/type-a/1.0.0.yaml":          testAppConfig,
+		})
+
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("REGION"))
+	})
+})
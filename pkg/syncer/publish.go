@@ -0,0 +1,394 @@
+package syncer
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+)
+
+const (
+	// lockBlobSuffix is the suffix of the blob leased by the publisher updating
+	// a cluster folder or publishing an aksapp version
+	lockBlobSuffix = ".lock"
+	// publishLeaseDuration is the duration in seconds of the lease on the lock
+	// blob, the longest finite lease of the storage service
+	publishLeaseDuration = 60
+
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// publishLeaseRenewInterval is how often the lease on the lock blob is renewed
+// while publishing, well within its duration
+var publishLeaseRenewInterval = publishLeaseDuration * time.Second / 3
+
+// ErrVersionExists is returned when publishing an aksapp version which was already published
+var ErrVersionExists = errors.New("aksapp version already exists")
+
+// Publisher validates configurations the same way the syncer parses them and
+// uploads them to the storage account the syncer reads from
+type Publisher struct {
+	blobClient            blobclient.Interface
+	storageAccountName    string
+	storageEndpointSuffix string
+	// signingKey signs every blob uploaded as <blob>.sig when set
+	signingKey crypto.Signer
+	logger     *logrus.Entry
+}
+
+// NewPublisher returns a Publisher uploading to a storage account via blobclient.Interface
+func NewPublisher(
+	blobClient blobclient.Interface,
+	storageAccountName string,
+	storageEndpointSuffix string,
+	logger *logrus.Entry) *Publisher {
+	return &Publisher{
+		blobClient:            blobClient,
+		storageAccountName:    storageAccountName,
+		storageEndpointSuffix: storageEndpointSuffix,
+		logger:                logger,
+	}
+}
+
+// SetSigningKey sets the key signing the blobs uploaded
+func (p *Publisher) SetSigningKey(key crypto.Signer) {
+	p.signingKey = key
+}
+
+func (p *Publisher) containerURL(containerName string) string {
+	return fmt.Sprintf("https://%s.blob.%s/%s",
+		p.storageAccountName, p.storageEndpointSuffix, containerName)
+}
+
+// PublishClusterFolder uploads the files of a folder of the cluster container,
+// i.e. a cluster or one of the _global, _env/<env> and _region/<region>
+// layers. The folder is validated as a whole, along with the blobs already in
+// it which are not replaced, while holding the lease of <folder>.lock so that
+// only one writer updates it at a time.
+func (p *Publisher) PublishClusterFolder(ctx context.Context, folder string, files map[string]string) error {
+	folder = strings.Trim(folder, "/")
+	if folder == "" {
+		return fmt.Errorf("cluster folder is not set")
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no configuration files to publish in %s", folder)
+	}
+	prefix := folder + "/"
+	blobs, err := folderBlobs(prefix, files)
+	if err != nil {
+		return err
+	}
+
+	if err := p.ensureContainer(ctx, clusterContainerName); err != nil {
+		return err
+	}
+
+	return p.withLease(ctx, clusterContainerName, folder+lockBlobSuffix, func(ctx context.Context) error {
+		blobList, err := p.blobClient.ListBlobsWithPrefix(ctx, p.containerURL(clusterContainerName), prefix)
+		if err != nil {
+			return err
+		}
+		folderContent := make(map[string]string)
+		for name, content := range blobs {
+			folderContent[name] = content
+		}
+		for _, blob := range blobList.Blobs {
+			if isSignatureBlob(blob.Name) {
+				// A stale signature would fail the verification of the new blob
+				signed := strings.TrimSuffix(blob.Name, signatureSuffix)
+				if _, ok := blobs[signed]; ok && p.signingKey == nil {
+					return fmt.Errorf("%s is signed, its replacement must be signed too", signed)
+				}
+				continue
+			}
+			if _, ok := folderContent[blob.Name]; ok {
+				continue
+			}
+			data, _, err := p.blobClient.GetBlobDataV1(ctx, p.storageAccountName, clusterContainerName, blob.Name)
+			if err != nil {
+				return &BlobError{ContainerName: clusterContainerName, BlobName: blob.Name, Err: err}
+			}
+			folderContent[blob.Name] = string(data)
+		}
+
+		// The syncer concatenates the blobs of the folder in the listing order
+		var body string
+		for _, name := range sortedKeys(folderContent) {
+			body = body + folderContent[name] + "---\n"
+		}
+		scheme := runtime.NewScheme()
+		_ = deployerv1.AddToScheme(scheme)
+		if _, err := parseClusterLayer(p.logger, scheme, prefix, body); err != nil {
+			return err
+		}
+
+		for _, name := range sortedKeys(blobs) {
+			if err := p.putBlob(ctx, clusterContainerName, name, blobs[name], nil); err != nil {
+				return err
+			}
+		}
+		p.logger.Infof("Published %d configuration files to cluster folder %s", len(blobs), folder)
+		return nil
+	})
+}
+
+// PublishAksApp uploads the configuration of an aksapp version as the blob <type>/<version>.yaml
+func (p *Publisher) PublishAksApp(ctx context.Context, appType, version, content string) error {
+	blobName := fmt.Sprintf(aksAppBlobNameFormat, appType, version)
+	return p.publishAksApp(ctx, appType, version, blobName, map[string]string{blobName: content})
+}
+
+// PublishAksAppFolder uploads the manifests of an aksapp version to the folder
+// <type>/<version>/, along with the index.txt ordering them if any
+func (p *Publisher) PublishAksAppFolder(ctx context.Context, appType, version string, files map[string]string) error {
+	folder := fmt.Sprintf(aksAppFolderFormat, appType, version)
+	blobs, err := folderBlobs(folder, files)
+	if err != nil {
+		return err
+	}
+	return p.publishAksApp(ctx, appType, version, folder, blobs)
+}
+
+// publishAksApp validates and uploads the blobs of an aksapp version. Versions
+// are immutable, clusters pinned to a version must keep getting the same
+// manifests, so the version must not exist yet and blobs are only created.
+// The lease of <type>/<version>.lock is held while uploading so that only one
+// writer publishes a version, and the blobs already uploaded are deleted when
+// an upload fails so that no partial version is left behind.
+func (p *Publisher) publishAksApp(ctx context.Context, appType, version, blobName string, blobs map[string]string) error {
+	if appType == "" || version == "" || strings.Contains(appType, "/") || strings.Contains(version, "/") {
+		return fmt.Errorf("invalid aksapp type %q or version %q", appType, version)
+	}
+	content, err := appConfigContent(blobName, blobs)
+	if err != nil {
+		return &BlobError{ContainerName: aksAppContainerName, BlobName: blobName, Err: err}
+	}
+	objs, err := configmaps.ParseConfigToUnstructured(p.logger, content)
+	if err != nil {
+		return &BlobError{ContainerName: aksAppContainerName, BlobName: blobName, Err: err}
+	}
+	if len(objs) == 0 {
+		return &BlobError{ContainerName: aksAppContainerName, BlobName: blobName,
+			Err: fmt.Errorf("no objects found in aksapp configuration")}
+	}
+
+	if err := p.ensureContainer(ctx, aksAppContainerName); err != nil {
+		return err
+	}
+
+	lockBlobName := appType + "/" + version + lockBlobSuffix
+	return p.withLease(ctx, aksAppContainerName, lockBlobName, func(leaseCtx context.Context) error {
+		exists, err := p.appVersionExists(leaseCtx, appType, version)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: %s %s", ErrVersionExists, appType, version)
+		}
+
+		createOnly := map[string]interface{}{headerIfNoneMatch: "*"}
+		var uploaded []string
+		for _, name := range sortedKeys(blobs) {
+			err := p.putBlob(leaseCtx, aksAppContainerName, name, blobs[name], createOnly)
+			var blobErr *BlobError
+			if err != nil && errors.As(err, &blobErr) && blobErr.BlobName == name+signatureSuffix {
+				// The blob was uploaded, its signature was not
+				uploaded = append(uploaded, name)
+			}
+			if err != nil {
+				// The lease may be lost, the blobs are deleted regardless
+				p.deleteBlobs(ctx, aksAppContainerName, uploaded)
+				return err
+			}
+			uploaded = append(uploaded, name)
+			if p.signingKey != nil {
+				uploaded = append(uploaded, name+signatureSuffix)
+			}
+		}
+		p.logger.Infof("Published aksapp %s version %s", appType, version)
+		return nil
+	})
+}
+
+// deleteBlobs deletes the blobs of a publish which failed. Blobs which cannot
+// be deleted are logged, the version must then be deleted by hand.
+func (p *Publisher) deleteBlobs(ctx context.Context, containerName string, blobNames []string) {
+	for _, blobName := range blobNames {
+		if err := p.blobClient.DeleteBlob(ctx, p.storageAccountName, containerName, blobName); err != nil {
+			p.logger.Errorf("Failed to delete blob %s/%s of the failed publish, %s",
+				containerName, blobName, err.Error())
+			continue
+		}
+		p.logger.Infof("Deleted blob %s/%s of the failed publish", containerName, blobName)
+	}
+}
+
+// appConfigContent returns the configuration of an aksapp version the syncer
+// gets from its blobs, blobName being either the blob or the folder
+func appConfigContent(blobName string, blobs map[string]string) (string, error) {
+	if !strings.HasSuffix(blobName, "/") {
+		return blobs[blobName], nil
+	}
+
+	names := sortedKeys(blobs)
+	names, err := orderFolderBlobs(blobName, names, blobs[blobName+aksAppIndexBlobName])
+	if err != nil {
+		return "", err
+	}
+	var content string
+	for _, name := range names {
+		content = content + blobs[name] + "---\n"
+	}
+	return content, nil
+}
+
+// appVersionExists checks if either the blob or the folder of an aksapp version exists
+func (p *Publisher) appVersionExists(ctx context.Context, appType, version string) (bool, error) {
+	exists, err := p.blobClient.BlobExists(ctx, p.storageAccountName, aksAppContainerName,
+		fmt.Sprintf(aksAppBlobNameFormat, appType, version))
+	if err != nil || exists {
+		return exists, err
+	}
+	blobList, err := p.blobClient.ListBlobsWithPrefix(ctx, p.containerURL(aksAppContainerName),
+		fmt.Sprintf(aksAppFolderFormat, appType, version))
+	if err != nil {
+		return false, err
+	}
+	return len(blobList.Blobs) > 0, nil
+}
+
+// ensureContainer creates a private container if it does not exist
+func (p *Publisher) ensureContainer(ctx context.Context, containerName string) error {
+	exists, err := p.blobClient.ContainerExists(ctx, p.storageAccountName, containerName)
+	if err != nil || exists {
+		return err
+	}
+	p.logger.Infof("Create container %s", containerName)
+	return p.blobClient.CreateContainerWithACL(ctx, p.storageAccountName, containerName,
+		blobclient.BlobPublicAccessLevelNotSet)
+}
+
+// withLease runs fn while holding the lease of a lock blob, which is created
+// when missing. The lease is renewed until fn returns. When a renewal fails the
+// context of fn is canceled and the publish fails, another writer may hold the
+// lease by then.
+func (p *Publisher) withLease(ctx context.Context, containerName, blobName string,
+	fn func(ctx context.Context) error) error {
+	exists, err := p.blobClient.BlobExists(ctx, p.storageAccountName, containerName, blobName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := p.blobClient.PutBlobDataV1(ctx, p.storageAccountName, containerName, blobName,
+			[]byte{}, nil); err != nil {
+			return fmt.Errorf("failed to create lock blob %s/%s: %s", containerName, blobName, err.Error())
+		}
+	}
+
+	leaseID, err := p.blobClient.AcquireLease(ctx, p.storageAccountName, containerName, blobName, publishLeaseDuration)
+	if err != nil {
+		return fmt.Errorf("failed to acquire the lease of %s/%s, another writer may be publishing: %s",
+			containerName, blobName, err.Error())
+	}
+	defer func() {
+		if err := p.blobClient.ReleaseLease(ctx, p.storageAccountName, containerName, blobName, leaseID); err != nil {
+			p.logger.Warnf("Failed to release the lease of %s/%s, it expires in %d seconds, %s",
+				containerName, blobName, publishLeaseDuration, err.Error())
+		}
+	}()
+
+	leaseCtx, cancel := context.WithCancel(ctx)
+	var renewErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(publishLeaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leaseCtx.Done():
+				return
+			case <-ticker.C:
+				if err := p.blobClient.RenewLease(leaseCtx, p.storageAccountName, containerName, blobName,
+					leaseID); err != nil {
+					if leaseCtx.Err() == nil {
+						renewErr = err
+						cancel()
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	err = fn(leaseCtx)
+	cancel()
+	wg.Wait()
+	if renewErr != nil {
+		return fmt.Errorf("failed to renew the lease of %s/%s, another writer may be publishing: %s",
+			containerName, blobName, renewErr.Error())
+	}
+	return err
+}
+
+// putBlob uploads a blob followed by its signature when a signing key is set
+func (p *Publisher) putBlob(ctx context.Context, containerName, blobName, content string,
+	extraHeaders map[string]interface{}) error {
+	p.logger.Infof("Upload blob %s/%s", containerName, blobName)
+	if err := p.blobClient.PutBlobDataV1(ctx, p.storageAccountName, containerName, blobName,
+		[]byte(content), extraHeaders); err != nil {
+		return &BlobError{ContainerName: containerName, BlobName: blobName, Err: err}
+	}
+	if p.signingKey == nil {
+		return nil
+	}
+
+	signature, err := Sign(p.signingKey, []byte(content))
+	if err != nil {
+		return err
+	}
+	signatureBlobName := blobName + signatureSuffix
+	if err := p.blobClient.PutBlobDataV1(ctx, p.storageAccountName, containerName, signatureBlobName,
+		[]byte(signature+"\n"), extraHeaders); err != nil {
+		return &BlobError{ContainerName: containerName, BlobName: signatureBlobName, Err: err}
+	}
+	return nil
+}
+
+// folderBlobs returns the blob names of files relative to a folder
+func folderBlobs(folder string, files map[string]string) (map[string]string, error) {
+	blobs := make(map[string]string)
+	for name, content := range files {
+		clean := path.Clean(name)
+		if name == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("invalid file name %q", name)
+		}
+		if isSignatureBlob(clean) || strings.HasSuffix(clean, lockBlobSuffix) {
+			return nil, fmt.Errorf("file name %q has a reserved suffix", name)
+		}
+		blobs[folder+clean] = content
+	}
+	return blobs, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
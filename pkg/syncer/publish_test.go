@@ -0,0 +1,249 @@
+package syncer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient/mock_blobclient"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test Publisher", func() {
+	var (
+		blobClient *mock_blobclient.MockInterface
+		publisher  *Publisher
+		ctx        context.Context
+	)
+
+	BeforeEach(func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		blobClient = mock_blobclient.NewMockInterface(mockCtrl)
+		publisher = NewPublisher(blobClient, "account", "core.windows.net", log.New("test-service", "test-version"))
+		ctx = context.Background()
+	})
+
+	expectLease := func(containerName, lockBlobName string) {
+		blobClient.EXPECT().BlobExists(gomock.Any(), "account", containerName, lockBlobName).Return(false, nil)
+		blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", containerName, lockBlobName,
+			[]byte{}, nil).Return(nil)
+		blobClient.EXPECT().AcquireLease(gomock.Any(), "account", containerName, lockBlobName,
+			uint(publishLeaseDuration)).Return("lease-id", nil)
+		blobClient.EXPECT().ReleaseLease(gomock.Any(), "account", containerName, lockBlobName, "lease-id").Return(nil)
+	}
+
+	Describe("Test PublishClusterFolder", func() {
+		BeforeEach(func() {
+			blobClient.EXPECT().ContainerExists(gomock.Any(), "account", clusterContainerName).Return(false, nil)
+			blobClient.EXPECT().CreateContainerWithACL(gomock.Any(), "account", clusterContainerName,
+				blobclient.BlobPublicAccessLevelNotSet).Return(nil)
+		})
+
+		It("Test PublishClusterFolder uploads the folder under the lease", func() {
+			expectLease(clusterContainerName, "test-cluster.lock")
+			blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), "https://account.blob.core.windows.net/cluster",
+				"test-cluster/").Return(storage.BlobListResponse{
+				Blobs: []storage.Blob{{Name: "test-cluster/a.yaml"}, {Name: "test-cluster/b.yaml"}},
+			}, nil)
+			blobClient.EXPECT().GetBlobDataV1(gomock.Any(), "account", clusterContainerName, "test-cluster/b.yaml").
+				Return([]byte(testClusterConfig("app-b", "type-b", "1.0.0")), 200, nil)
+			content := testClusterConfig("app-a", "type-a", "1.0.0")
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", clusterContainerName, "test-cluster/a.yaml",
+				[]byte(content), nil).Return(nil)
+
+			Expect(publisher.PublishClusterFolder(ctx, "test-cluster/", map[string]string{"a.yaml": content})).To(Succeed())
+		})
+
+		It("Test PublishClusterFolder validates the folder with the blobs kept", func() {
+			expectLease(clusterContainerName, "_global.lock")
+			blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), gomock.Any(), "_global/").Return(storage.BlobListResponse{
+				Blobs: []storage.Blob{{Name: "_global/b.yaml"}},
+			}, nil)
+			blobClient.EXPECT().GetBlobDataV1(gomock.Any(), "account", clusterContainerName, "_global/b.yaml").
+				Return([]byte(testClusterConfig("app-a", "type-a", "1.0.0")), 200, nil)
+
+			err := publisher.PublishClusterFolder(ctx, "_global", map[string]string{
+				"a.yaml": testClusterConfig("app-a", "type-a", "2.0.0"),
+			})
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("defined more than once"))
+		})
+
+		It("Test PublishClusterFolder rejects objects other than AksApps", func() {
+			expectLease(clusterContainerName, "test-cluster.lock")
+			blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), gomock.Any(), gomock.Any()).Return(storage.BlobListResponse{}, nil)
+
+			err := publisher.PublishClusterFolder(ctx, "test-cluster", map[string]string{"a.yaml": testAppConfig})
+			Expect(err).NotTo(BeNil())
+		})
+
+		It("Test PublishClusterFolder does not replace signed blobs without a signing key", func() {
+			expectLease(clusterContainerName, "test-cluster.lock")
+			blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), gomock.Any(), gomock.Any()).Return(storage.BlobListResponse{
+				Blobs: []storage.Blob{{Name: "test-cluster/a.yaml"}, {Name: "test-cluster/a.yaml.sig"}},
+			}, nil)
+
+			err := publisher.PublishClusterFolder(ctx, "test-cluster", map[string]string{
+				"a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			})
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("must be signed"))
+		})
+
+		It("Test PublishClusterFolder fails when another writer holds the lease", func() {
+			blobClient.EXPECT().BlobExists(gomock.Any(), "account", clusterContainerName, "test-cluster.lock").Return(true, nil)
+			blobClient.EXPECT().AcquireLease(gomock.Any(), "account", clusterContainerName, "test-cluster.lock",
+				gomock.Any()).Return("", errors.New("conflict"))
+
+			err := publisher.PublishClusterFolder(ctx, "test-cluster", map[string]string{
+				"a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			})
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("another writer"))
+		})
+	})
+
+	Describe("Test withLease", func() {
+		var renewInterval time.Duration
+
+		BeforeEach(func() {
+			renewInterval = publishLeaseRenewInterval
+			publishLeaseRenewInterval = 10 * time.Millisecond
+		})
+
+		AfterEach(func() {
+			publishLeaseRenewInterval = renewInterval
+		})
+
+		It("Test withLease renews the lease while publishing", func() {
+			expectLease(clusterContainerName, "test-cluster.lock")
+			blobClient.EXPECT().RenewLease(gomock.Any(), "account", clusterContainerName, "test-cluster.lock",
+				"lease-id").Return(nil).MinTimes(1)
+
+			Expect(publisher.withLease(ctx, clusterContainerName, "test-cluster.lock", func(ctx context.Context) error {
+				time.Sleep(50 * time.Millisecond)
+				return ctx.Err()
+			})).To(Succeed())
+		})
+
+		It("Test withLease fails when the lease cannot be renewed", func() {
+			expectLease(clusterContainerName, "test-cluster.lock")
+			blobClient.EXPECT().RenewLease(gomock.Any(), "account", clusterContainerName, "test-cluster.lock",
+				"lease-id").Return(errors.New("lease lost"))
+
+			err := publisher.withLease(ctx, clusterContainerName, "test-cluster.lock", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("failed to renew the lease"))
+		})
+	})
+
+	Describe("Test PublishAksApp", func() {
+		expectContainer := func() {
+			blobClient.EXPECT().ContainerExists(gomock.Any(), "account", aksAppContainerName).Return(true, nil)
+			expectLease(aksAppContainerName, "type-a/1.0.0.lock")
+		}
+		expectVersion := func(exists bool, folder []storage.Blob) {
+			blobClient.EXPECT().BlobExists(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0.yaml").Return(exists, nil)
+			if !exists {
+				blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), "https://account.blob.core.windows.net/aksapp",
+					"type-a/1.0.0/").Return(storage.BlobListResponse{Blobs: folder}, nil)
+			}
+		}
+		createOnly := map[string]interface{}{headerIfNoneMatch: "*"}
+
+		It("Test PublishAksApp creates the blob of a new version", func() {
+			expectContainer()
+			expectVersion(false, nil)
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0.yaml",
+				[]byte(testAppConfig), createOnly).Return(nil)
+
+			Expect(publisher.PublishAksApp(ctx, "type-a", "1.0.0", testAppConfig)).To(Succeed())
+		})
+
+		It("Test PublishAksApp signs the blobs", func() {
+			publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).To(BeNil())
+			publisher.SetSigningKey(privateKey)
+			expectContainer()
+			expectVersion(false, nil)
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0.yaml",
+				[]byte(testAppConfig), createOnly).Return(nil)
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0.yaml.sig",
+				gomock.Any(), createOnly).DoAndReturn(
+				func(_ context.Context, _, _, _ string, data []byte, _ map[string]interface{}) error {
+					Expect(verifySignature([]crypto.PublicKey{publicKey}, []byte(testAppConfig),
+						decodeSignature(string(data)))).To(BeTrue())
+					return nil
+				})
+
+			Expect(publisher.PublishAksApp(ctx, "type-a", "1.0.0", testAppConfig)).To(Succeed())
+		})
+
+		It("Test PublishAksApp refuses to overwrite a version", func() {
+			expectContainer()
+			expectVersion(true, nil)
+			err := publisher.PublishAksApp(ctx, "type-a", "1.0.0", testAppConfig)
+			Expect(errors.Is(err, ErrVersionExists)).To(BeTrue())
+
+			expectContainer()
+			expectVersion(false, []storage.Blob{{Name: "type-a/1.0.0/a.yaml"}})
+			err = publisher.PublishAksAppFolder(ctx, "type-a", "1.0.0", map[string]string{"a.yaml": testAppConfig})
+			Expect(errors.Is(err, ErrVersionExists)).To(BeTrue())
+		})
+
+		It("Test PublishAksAppFolder deletes the blobs uploaded when an upload fails", func() {
+			expectContainer()
+			expectVersion(false, nil)
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0/a.yaml",
+				gomock.Any(), createOnly).Return(nil)
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0/b.yaml",
+				gomock.Any(), createOnly).Return(errors.New("connection reset"))
+			blobClient.EXPECT().DeleteBlob(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0/a.yaml").Return(nil)
+
+			err := publisher.PublishAksAppFolder(ctx, "type-a", "1.0.0", map[string]string{
+				"a.yaml": testAppConfig,
+				"b.yaml": testAppConfig,
+			})
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("connection reset"))
+		})
+
+		It("Test PublishAksApp rejects invalid configurations", func() {
+			Expect(publisher.PublishAksApp(ctx, "type-a", "1.0.0", "")).NotTo(Succeed())
+			Expect(publisher.PublishAksApp(ctx, "type-a", "1.0.0", "kind: [")).NotTo(Succeed())
+			Expect(publisher.PublishAksApp(ctx, "type-a", "../1.0.0", testAppConfig)).NotTo(Succeed())
+		})
+
+		It("Test PublishAksAppFolder validates the index", func() {
+			err := publisher.PublishAksAppFolder(ctx, "type-a", "1.0.0", map[string]string{
+				"a.yaml":            testAppConfig,
+				aksAppIndexBlobName: "a.yaml\nb.yaml\n",
+			})
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("b.yaml"))
+
+			expectContainer()
+			expectVersion(false, nil)
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0/a.yaml",
+				gomock.Any(), createOnly).Return(nil)
+			blobClient.EXPECT().PutBlobDataV1(gomock.Any(), "account", aksAppContainerName, "type-a/1.0.0/index.txt",
+				gomock.Any(), createOnly).Return(nil)
+			Expect(publisher.PublishAksAppFolder(ctx, "type-a", "1.0.0", map[string]string{
+				"a.yaml":            testAppConfig,
+				aksAppIndexBlobName: "a.yaml\n",
+			})).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,149 @@
+package syncer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+)
+
+const (
+	// signatureSuffix is the suffix of the detached signature blob of a blob
+	signatureSuffix = ".sig"
+
+	signatureVerified   = "verified"
+	signatureUnverified = "unverified"
+)
+
+var (
+	// ErrSignatureMissing is returned when a blob has no signature blob
+	ErrSignatureMissing = errors.New("signature is missing")
+	// ErrSignatureInvalid is returned when no public key verifies the signature of a blob
+	ErrSignatureInvalid = errors.New("signature is invalid")
+)
+
+// ParsePublicKeys parses the PEM encoded PKIX public keys verifying the
+// signatures of the blobs. ed25519 keys verify the signature of the blob
+// content, ECDSA keys verify the ASN.1 signature of its SHA-256 digest as
+// produced by cosign sign-blob.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case ed25519.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, key)
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public key found")
+	}
+	return keys, nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #8 ed25519 or ECDSA private key signing bundles
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no private key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// Sign returns the base64 encoded signature of the content verified by verifySignature
+func Sign(key crypto.Signer, content []byte) (string, error) {
+	var signature []byte
+	var err error
+	switch key.(type) {
+	case ed25519.PrivateKey:
+		signature, err = key.Sign(rand.Reader, content, crypto.Hash(0))
+	default:
+		digest := sha256.Sum256(content)
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// decodeSignature returns the signature of a signature blob, which is either
+// base64 encoded or raw
+func decodeSignature(content string) []byte {
+	if signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content)); err == nil {
+		return signature
+	}
+	return []byte(content)
+}
+
+// verifySignature checks that one of the keys verifies the signature of the content
+func verifySignature(keys []crypto.PublicKey, content, signature []byte) bool {
+	digest := sha256.Sum256(content)
+	for _, key := range keys {
+		switch k := key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, content, signature) {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, digest[:], signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSignatureBlob checks if the blob is the detached signature of another blob
+func isSignatureBlob(blobName string) bool {
+	return strings.HasSuffix(blobName, signatureSuffix)
+}
+
+// signatureStatus returns the value of the signature annotation of a
+// ConfigMap, the configuration is verified once the signatures of all the
+// blobs it is assembled from were verified
+func signatureStatus(sources []configmaps.SourceBlob) string {
+	if len(sources) == 0 {
+		return signatureUnverified
+	}
+	for _, source := range sources {
+		if !source.Verified {
+			return signatureUnverified
+		}
+	}
+	return signatureVerified
+}
@@ -0,0 +1,155 @@
+package syncer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+// encodePublicKey returns the PEM encoding of a public key
+func encodePublicKey(key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	Expect(err).To(BeNil())
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+var _ = Describe("Test signatures", func() {
+	var (
+		edPublicKey  ed25519.PublicKey
+		edPrivateKey ed25519.PrivateKey
+		ecPrivateKey *ecdsa.PrivateKey
+		keys         []crypto.PublicKey
+	)
+
+	BeforeEach(func() {
+		var err error
+		edPublicKey, edPrivateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).To(BeNil())
+		ecPrivateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).To(BeNil())
+
+		keys, err = ParsePublicKeys(append(encodePublicKey(edPublicKey), encodePublicKey(&ecPrivateKey.PublicKey)...))
+		Expect(err).To(BeNil())
+		Expect(keys).To(HaveLen(2))
+	})
+
+	It("Test ParsePublicKeys rejects files without public keys", func() {
+		_, err := ParsePublicKeys([]byte("not a key"))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Test verifySignature with ed25519 and cosign signatures", func() {
+		content := []byte("data")
+		Expect(verifySignature(keys, content, ed25519.Sign(edPrivateKey, content))).To(BeTrue())
+
+		digest := sha256.Sum256(content)
+		signature, err := ecdsa.SignASN1(rand.Reader, ecPrivateKey, digest[:])
+		Expect(err).To(BeNil())
+		Expect(verifySignature(keys, content,
+			decodeSignature(base64.StdEncoding.EncodeToString(signature)+"\n"))).To(BeTrue())
+
+		Expect(verifySignature(keys, []byte("tampered"), signature)).To(BeFalse())
+	})
+
+	It("Test signatureStatus is verified once every blob is verified", func() {
+		verified := configmaps.SourceBlob{Name: "a.yaml", Verified: true}
+		Expect(signatureStatus([]configmaps.SourceBlob{verified})).To(Equal(signatureVerified))
+		Expect(signatureStatus([]configmaps.SourceBlob{verified, {Name: "b.yaml"}})).To(Equal(signatureUnverified))
+		Expect(signatureStatus(nil)).To(Equal(signatureUnverified))
+	})
+
+	Describe("Test Syncer Run with signatures", func() {
+		var (
+			kubeClient *fake.Clientset
+			root       string
+			syncer     *Syncer
+			files      map[string]string
+		)
+
+		sign := func(files map[string]string) map[string]string {
+			signed := make(map[string]string)
+			for name, content := range files {
+				signed[name] = content
+				signed[name+signatureSuffix] = base64.StdEncoding.EncodeToString(
+					ed25519.Sign(edPrivateKey, []byte(content)))
+			}
+			return signed
+		}
+
+		BeforeEach(func() {
+			var err error
+			logger := log.New("test-service", "test-version")
+			kubeClient = fake.NewSimpleClientset()
+			root, err = ioutil.TempDir("", "syncer")
+			Expect(err).To(BeNil())
+			syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource(root, logger), "test-cluster", logger)
+			syncer.SetOptions(Options{Namespace: "test-namespace", PublicKeys: keys})
+			files = map[string]string{
+				"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+				"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(root)
+		})
+
+		It("Test Run writes verified configurations", func() {
+			writeFiles(root, sign(files))
+
+			Expect(syncer.Run(context.Background())).To(Succeed())
+			cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(),
+				configmaps.ClusterConfigMapName, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			Expect(cm.Annotations).To(HaveKeyWithValue(configmaps.ConfigSignatureAnnotationKey, signatureVerified))
+			// Signatures are not part of the configuration
+			Expect(cm.Data[configmaps.ConfigDataKey]).NotTo(ContainSubstring(signatureSuffix))
+		})
+
+		It("Test Run rejects unsigned blobs", func() {
+			writeFiles(root, sign(map[string]string{
+				"cluster/test-cluster/a.yaml": files["cluster/test-cluster/a.yaml"],
+			}))
+			writeFiles(root, map[string]string{
+				"aksapp/type-a/1.0.0.yaml": files["aksapp/type-a/1.0.0.yaml"],
+			})
+
+			missing := testutil.ToFloat64(signatureVerificationsVec.WithLabelValues(aksAppContainerName, signatureResultMissing))
+			err := syncer.Run(context.Background())
+			Expect(errors.Is(err, ErrSignatureMissing)).To(BeTrue())
+			Expect(testutil.ToFloat64(signatureVerificationsVec.WithLabelValues(aksAppContainerName, signatureResultMissing))).
+				To(Equal(missing + 1))
+		})
+
+		It("Test Run rejects tampered blobs", func() {
+			writeFiles(root, sign(files))
+			writeFiles(root, map[string]string{
+				"aksapp/type-a/1.0.0.yaml": testAppConfig + "data:\n  tampered: \"true\"\n",
+			})
+
+			err := syncer.Run(context.Background())
+			Expect(errors.Is(err, ErrSignatureInvalid)).To(BeTrue())
+			list, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(context.Background(), metav1.ListOptions{})
+			Expect(list.Items).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,390 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+)
+
+// BlobError is returned when a blob breaks the sync, e.g. it cannot be fetched or parsed
+type BlobError struct {
+	ContainerName string
+	BlobName      string
+	Err           error
+}
+
+func (e *BlobError) Error() string {
+	return fmt.Sprintf("blob %s/%s: %s", e.ContainerName, e.BlobName, e.Err.Error())
+}
+
+// Unwrap returns the underlying error
+func (e *BlobError) Unwrap() error {
+	return e.Err
+}
+
+// appConfig is the configuration of one aksapp type/version
+type appConfig struct {
+	appType       string
+	version       string
+	blobName      string
+	configMapName string
+	content       string
+	sources       []configmaps.SourceBlob
+	// overwritten is the last time the content changed under the same version, if ever
+	overwritten string
+}
+
+// snapshot is the complete set of configurations of a cluster read in one sync.
+// A snapshot is only written to the cluster once every blob it references has
+// been fetched and validated.
+type snapshot struct {
+	clusterBlobName string
+	clusterConfig   string
+	clusterSources  []configmaps.SourceBlob
+	apps            []*deployerv1.AksApp
+	provenance      Provenance
+	// appConfigs is unique per ConfigMap name, in the order of the cluster configuration
+	appConfigs []appConfig
+}
+
+// serializeApps rewrites the cluster configuration from the AksApps of the
+// snapshot once they are merged, toggled or resolved
+func (snap *snapshot) serializeApps(scheme *runtime.Scheme) error {
+	objs := make([]runtime.Object, 0, len(snap.apps))
+	for _, app := range snap.apps {
+		objs = append(objs, app)
+	}
+	clusterConfig, err := configmaps.SerializeConfig(scheme, objs)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the cluster configuration: %s", err.Error())
+	}
+	snap.clusterConfig = clusterConfig
+	return nil
+}
+
+// fetchSnapshot fetches and parses the cluster configuration and every aksapp
+// configuration it references
+func (s *Syncer) fetchSnapshot(ctx context.Context) (*snapshot, error) {
+	snap := &snapshot{
+		clusterBlobName: fmt.Sprintf(clusterBlobNameFormat, s.clusterName),
+	}
+
+	scheme := runtime.NewScheme()
+	_ = deployerv1.AddToScheme(scheme)
+
+	placeholders, err := s.fetchPlaceholders(ctx, snap)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compose the cluster configuration from the layers, the folder of cluster
+	// name overrides the region, environment and global layers
+	var layers []configLayer
+	for _, prefix := range s.clusterLayerPrefixes() {
+		layer, err := s.fetchClusterLayer(ctx, snap, prefix, placeholders, scheme)
+		if err != nil {
+			return nil, err
+		}
+		if layer != nil {
+			layers = append(layers, *layer)
+		}
+	}
+	if len(layers) == 0 {
+		s.logger.Warnf("No configuration files found in cluster folder")
+		return nil, &BlobError{ContainerName: clusterContainerName, BlobName: s.clusterName + "/",
+			Err: fmt.Errorf("no configuration files found")}
+	}
+	if err := s.composeClusterConfig(snap, layers, scheme); err != nil {
+		return nil, err
+	}
+
+	// Gate the AksApps before fetching their configurations
+	if err := s.applyToggles(ctx, snap, scheme); err != nil {
+		return nil, err
+	}
+	resolved, err := s.resolveVersions(ctx, snap)
+	if err != nil {
+		return nil, err
+	}
+	if resolved {
+		if err := snap.serializeApps(scheme); err != nil {
+			return nil, err
+		}
+	}
+
+	appTypes := make(map[string]bool)
+	for _, app := range snap.apps {
+		appTypes[app.Spec.Type] = true
+	}
+	s.appTypes.Store(appTypes)
+
+	fetched := make(map[string]bool)
+	for _, app := range snap.apps {
+		configMapName := configmaps.GetAksAppConfigMapName(*app)
+		if fetched[configMapName] {
+			continue
+		}
+		fetched[configMapName] = true
+
+		s.logger.Infof("Fetching %s:%s configuration...", app.Spec.Type, app.Spec.Version)
+		config, err := s.fetchAppConfig(ctx, app.Spec.Type, app.Spec.Version)
+		if err != nil {
+			s.logger.Warningf("Failed to fetch aksapp configuration, %s", err.Error())
+			return nil, err
+		}
+		config.configMapName = configMapName
+		snap.appConfigs = append(snap.appConfigs, *config)
+	}
+
+	return snap, nil
+}
+
+// fetchClusterLayer fetches and parses the AksApps of a layer of the cluster
+// configuration once its placeholders are substituted, it returns nil when the
+// layer has no configuration files
+func (s *Syncer) fetchClusterLayer(ctx context.Context, snap *snapshot, prefix string,
+	placeholders map[string]string, scheme *runtime.Scheme) (*configLayer, error) {
+	body, sources, err := s.getBlobsWithPrefix(ctx, clusterContainerName, prefix)
+	if err != nil {
+		s.logger.Warnf("Failed to get configuration files in %s, %s", prefix, err.Error())
+		return nil, &BlobError{ContainerName: clusterContainerName, BlobName: prefix, Err: err}
+	}
+	if body == "" {
+		return nil, nil
+	}
+	body, err = substitutePlaceholders(body, placeholders)
+	if err != nil {
+		s.logger.Errorf("Failed to substitute placeholders of cluster configuration %s, %s", prefix, err.Error())
+		parseFailuresVec.WithLabelValues(clusterContainerName).Inc()
+		return nil, &BlobError{ContainerName: clusterContainerName, BlobName: prefix, Err: err}
+	}
+	snap.clusterConfig += body
+	snap.clusterSources = append(snap.clusterSources, sources...)
+
+	return parseClusterLayer(s.logger, scheme, prefix, body)
+}
+
+// parseClusterLayer parses the AksApps of a layer of the cluster configuration,
+// which must only hold AksApps with distinct names
+func parseClusterLayer(logger *logrus.Entry, scheme *runtime.Scheme, prefix, body string) (*configLayer, error) {
+	objs, err := configmaps.ParseConfig(logger, scheme, body)
+	if err != nil {
+		logger.Errorf("Failed to parse cluster configuration %s, %s", prefix, err.Error())
+		parseFailuresVec.WithLabelValues(clusterContainerName).Inc()
+		return nil, &BlobError{ContainerName: clusterContainerName, BlobName: prefix, Err: err}
+	}
+
+	layer := &configLayer{prefix: prefix}
+	names := make(map[string]bool)
+	for _, obj := range objs {
+		app, ok := obj.(*deployerv1.AksApp)
+		if !ok {
+			return nil, &BlobError{ContainerName: clusterContainerName, BlobName: prefix,
+				Err: fmt.Errorf("unexpected %s object in cluster configuration", obj.GetObjectKind().GroupVersionKind())}
+		}
+		// AksApps are only merged across layers
+		nn := app.Namespace + "/" + app.Name
+		if names[nn] {
+			return nil, &BlobError{ContainerName: clusterContainerName, BlobName: prefix,
+				Err: fmt.Errorf("aksapp %s is defined more than once", nn)}
+		}
+		names[nn] = true
+		layer.apps = append(layer.apps, app)
+	}
+
+	return layer, nil
+}
+
+// fetchAppConfig fetches the configuration of an aksapp type/version. It is
+// either the blob <type>/<version>.yaml or the manifests of the folder
+// <type>/<version>/ concatenated in order, see orderAppBlobs.
+func (s *Syncer) fetchAppConfig(ctx context.Context, appType, version string) (*appConfig, error) {
+	config := &appConfig{
+		appType: appType,
+		version: version,
+	}
+
+	folder := fmt.Sprintf(aksAppFolderFormat, appType, version)
+	blobNames, err := s.listBlobs(ctx, aksAppContainerName, folder)
+	if err != nil {
+		return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: folder, Err: err}
+	}
+
+	if len(blobNames) == 0 {
+		config.blobName = fmt.Sprintf(aksAppBlobNameFormat, appType, version)
+		content, source, err := s.getSourceBlob(ctx, aksAppContainerName, config.blobName)
+		if err != nil {
+			return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: config.blobName, Err: err}
+		}
+		config.content = content
+		config.sources = []configmaps.SourceBlob{source}
+		return config, nil
+	}
+
+	config.blobName = folder
+	blobNames, err = s.orderAppBlobs(ctx, folder, blobNames)
+	if err != nil {
+		return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: folder + aksAppIndexBlobName, Err: err}
+	}
+	config.content, config.sources, err = s.concatBlobs(ctx, aksAppContainerName, blobNames)
+	if err != nil {
+		return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: folder, Err: err}
+	}
+
+	return config, nil
+}
+
+// orderAppBlobs returns the manifests of an aksapp folder in the order they
+// are concatenated. The blobs listed by the optional index.txt of the folder
+// come first, one name relative to the folder per line, blank lines and lines
+// starting with # are ignored. The other blobs follow sorted by name.
+func (s *Syncer) orderAppBlobs(ctx context.Context, folder string, blobNames []string) ([]string, error) {
+	indexBlobName := folder + aksAppIndexBlobName
+	var index string
+	for _, blobName := range blobNames {
+		if blobName != indexBlobName {
+			continue
+		}
+		content, err := s.getBlob(ctx, aksAppContainerName, indexBlobName)
+		if err != nil {
+			return nil, err
+		}
+		index = content
+	}
+	return orderFolderBlobs(folder, blobNames, index)
+}
+
+// orderFolderBlobs orders the manifests of an aksapp folder given the content
+// of its index, which is empty when the folder has none
+func orderFolderBlobs(folder string, blobNames []string, index string) ([]string, error) {
+	indexBlobName := folder + aksAppIndexBlobName
+	remaining := make(map[string]bool)
+	for _, blobName := range blobNames {
+		if blobName != indexBlobName {
+			remaining[blobName] = true
+		}
+	}
+
+	var ordered []string
+	if index != "" {
+		for _, line := range strings.Split(index, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			blobName := folder + line
+			if !remaining[blobName] {
+				return nil, fmt.Errorf("%s is listed in the index but not found or listed twice", line)
+			}
+			delete(remaining, blobName)
+			ordered = append(ordered, blobName)
+		}
+	}
+
+	var rest []string
+	for blobName := range remaining {
+		rest = append(rest, blobName)
+	}
+	sort.Strings(rest)
+
+	return append(ordered, rest...), nil
+}
+
+// validateSnapshot checks that the snapshot is consistent as a whole before it
+// gets written to the cluster
+func (s *Syncer) validateSnapshot(snap *snapshot) error {
+	clusterPrefix := s.clusterName + "/"
+
+	names := make(map[string]bool)
+	versions := make(map[string]string)
+	for _, app := range snap.apps {
+		nn := app.Namespace + "/" + app.Name
+		if names[nn] {
+			return &BlobError{ContainerName: clusterContainerName, BlobName: clusterPrefix,
+				Err: fmt.Errorf("aksapp %s is defined more than once", nn)}
+		}
+		names[nn] = true
+
+		if app.Spec.Type == "" || app.Spec.Version == "" {
+			return &BlobError{ContainerName: clusterContainerName, BlobName: clusterPrefix,
+				Err: fmt.Errorf("aksapp %s has no type or version", nn)}
+		}
+
+		// The ConfigMaps of the other versions of a type are cleaned up
+		if version, ok := versions[app.Spec.Type]; ok && version != app.Spec.Version {
+			return &BlobError{ContainerName: clusterContainerName, BlobName: clusterPrefix,
+				Err: fmt.Errorf("aksapp type %s references both version %s and %s",
+					app.Spec.Type, version, app.Spec.Version)}
+		}
+		versions[app.Spec.Type] = app.Spec.Version
+	}
+
+	for _, config := range snap.appConfigs {
+		objs, err := configmaps.ParseConfigToUnstructured(s.logger, config.content)
+		if err != nil {
+			parseFailuresVec.WithLabelValues(aksAppContainerName).Inc()
+			return &BlobError{ContainerName: aksAppContainerName, BlobName: config.blobName, Err: err}
+		}
+		if len(objs) == 0 {
+			return &BlobError{ContainerName: aksAppContainerName, BlobName: config.blobName,
+				Err: fmt.Errorf("no objects found in aksapp configuration")}
+		}
+	}
+
+	return nil
+}
+
+// applySnapshot writes the aksapp ConfigMaps and then the cluster ConfigMap.
+// The cluster ConfigMap is left untouched if any aksapp ConfigMap cannot be
+// written, so that it never references a missing configuration.
+func (s *Syncer) applySnapshot(ctx context.Context, snap *snapshot) error {
+	for _, config := range snap.appConfigs {
+		// Stop before the next write when the sync is cancelled, the cluster
+		// ConfigMap still references the previous configurations
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.logger.Infof("Syncing %s:%s configuration...", config.appType, config.version)
+		annotations, err := s.configAnnotations(config.blobName, config.sources)
+		if err != nil {
+			return err
+		}
+		if config.overwritten != "" {
+			annotations[configmaps.ConfigOverwrittenAnnotationKey] = config.overwritten
+		}
+		err = s.writeConfigMaps(ctx, config.configMapName, config.content,
+			managedLabels(config.appType, config.version), annotations)
+		if err != nil {
+			s.logger.Errorf("Failed to create/update aksapp configuration, %s", err.Error())
+			return fmt.Errorf("failed to write ConfigMap %s: %s", config.configMapName, err.Error())
+		}
+	}
+
+	// Create/Update the cluster ConfigMap after creating the component
+	// configurations to avoid configurationMissingErr during reconciliation.
+	annotations, err := s.configAnnotations(snap.clusterBlobName, snap.clusterSources)
+	if err != nil {
+		return err
+	}
+	if len(snap.provenance) > 0 {
+		annotations[configmaps.ConfigProvenanceAnnotationKey], err = provenanceAnnotation(snap.provenance)
+		if err != nil {
+			return err
+		}
+	}
+	err = s.writeConfigMaps(ctx, configmaps.ClusterConfigMapName, snap.clusterConfig,
+		managedLabels("", ""), annotations)
+	if err != nil {
+		s.logger.Errorf("Failed to create/update cluster configuration, %s", err.Error())
+		return fmt.Errorf("failed to write ConfigMap %s: %s", configmaps.ClusterConfigMapName, err.Error())
+	}
+
+	return nil
+}
@@ -1,23 +1,25 @@
 package syncer
 
 import (
-	"bytes"
 	"context"
-	"errors"
+	"crypto"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/sirupsen/logrus"
 
 	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
-	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
 	"github.com/Azure/aks-deployer/pkg/configmaps"
 )
 
@@ -27,24 +29,58 @@ const (
 
 	clusterBlobNameFormat = "%s.yaml"
 	aksAppBlobNameFormat  = "%s/%s.yaml"
+	// aksAppFolderFormat is the folder of a multi-file aksapp type/version
+	aksAppFolderFormat = "%s/%s/"
+	// aksAppIndexBlobName is the optional blob of an aksapp folder ordering its manifests
+	aksAppIndexBlobName = "index.txt"
 )
 
 // Options syncer options
 type Options struct {
 	ToggleURL string
 	Namespace string
+	// Region is the region of the cluster which toggle rules are evaluated for
+	Region string
+	// Environment is the environment of the cluster which selects the
+	// environment layer and toggle rules, the DEPLOY_ENV of the syncer when empty
+	Environment string
+	// GCGracePeriod is how long the ConfigMaps of an obsolete aksapp version are kept
+	GCGracePeriod time.Duration
+	// GCRetainVersions is how many obsolete versions of an aksapp type are kept for rollbacks
+	GCRetainVersions int
+	// CallTimeout bounds every call to the configuration source and the API server
+	CallTimeout time.Duration
+	// PublicKeys verify the detached signature <blob>.sig of every blob read,
+	// signatures are not verified when empty
+	PublicKeys []crypto.PublicKey
+	// AllowVersionOverwrite lets the content of an aksapp version change once
+	// written, the AksApps using it are reconciled again. Such changes are
+	// refused otherwise.
+	AllowVersionOverwrite bool
 }
 
+// DefaultCallTimeout is the default timeout of the calls to the configuration
+// source and the API server
+const DefaultCallTimeout = 30 * time.Second
+
 // Syncer syncs configuration from remote to local ConfigMaps
 type Syncer struct {
-	kubeClient            kubernetes.Interface
-	storageClient         storage.Client
-	blobClient            blobclient.Interface
-	storageAccountName    string
-	storageEndpointSuffix string
-	clusterName           string
-	options               Options
-	logger                *logrus.Entry
+	kubeClient  kubernetes.Interface
+	source      ConfigSource
+	blobCache   *blobCache
+	clusterName string
+	// lastSnapshot is the last configuration successfully written to the cluster
+	lastSnapshot *snapshot
+	// consecutiveFailures is read by the health check, use atomic operations
+	consecutiveFailures int32
+	// appTypes is the set of aksapp types referenced by the last cluster
+	// configuration fetched, a map[string]bool read by the event receiver
+	appTypes atomic.Value
+	// legacyConfigMapsLabeled is set once the ConfigMaps written before they
+	// were labeled are labeled
+	legacyConfigMapsLabeled bool
+	options                 Options
+	logger                  *logrus.Entry
 }
 
 // NewSyncer returns a Syncer
@@ -54,15 +90,9 @@ func NewSyncer(
 	clusterName string,
 	logger *logrus.Entry) *Syncer {
 
-	syncer := &Syncer{
-		kubeClient:    kubeClient,
-		storageClient: storageClient,
-		clusterName:   clusterName,
-		logger:        logger,
-	}
-
 	logger.Info("Create a new Syncer using stoage client")
-	return syncer
+	return NewSyncerWithConfigSource(kubeClient,
+		NewStorageClientSource(storageClient, logger), clusterName, logger)
 }
 
 // NewSyncerWithBlobClient returns a Syncer using BlobClient
@@ -74,16 +104,33 @@ func NewSyncerWithBlobClient(
 	clusterName string,
 	logger *logrus.Entry) *Syncer {
 
+	logger.Info("Create a new Syncer using blob client")
+	return NewSyncerWithConfigSource(kubeClient,
+		NewBlobClientSource(blobClient, storageAccountName, storageEndpointSuffix, logger),
+		clusterName, logger)
+}
+
+// NewSyncerWithConfigSource returns a Syncer reading configurations from source
+func NewSyncerWithConfigSource(
+	kubeClient kubernetes.Interface,
+	source ConfigSource,
+	clusterName string,
+	logger *logrus.Entry) *Syncer {
+
 	syncer := &Syncer{
-		kubeClient:            kubeClient,
-		blobClient:            blobClient,
-		storageAccountName:    storageAccountName,
-		storageEndpointSuffix: storageEndpointSuffix,
-		clusterName:           clusterName,
-		logger:                logger,
+		kubeClient:  kubeClient,
+		source:      source,
+		blobCache:   newBlobCache(),
+		clusterName: clusterName,
+		options: Options{
+			GCGracePeriod:    DefaultGCGracePeriod,
+			GCRetainVersions: DefaultGCRetainVersions,
+			CallTimeout:      DefaultCallTimeout,
+		},
+		logger: logger,
 	}
 
-	logger.Info("Create a new Syncer using blob client")
+	logger.Infof("Create a new Syncer using %s", source)
 	return syncer
 }
 
@@ -92,223 +139,350 @@ func (s *Syncer) SetOptions(opt Options) {
 	s.options = opt
 }
 
-// Run runs the syncer routine
-func (s *Syncer) Run() {
-	s.logger.Infof("Syncing %s cluster configuration...", s.clusterName)
-
-	// Fetch cluster configuration
-	clusterBlobName := fmt.Sprintf(clusterBlobNameFormat, s.clusterName)
-	// Check the folder of cluster name
-	body, err := s.getAzureStorageBlobsWithPrefix(clusterContainerName, s.clusterName+"/")
+// Run runs the syncer routine. The configurations are synced as a whole: when
+// any blob fails to be fetched, parsed or written, the cluster ConfigMap keeps
+// the previous snapshot and the returned error reports the broken blob.
+//
+// Run stops at the next call to the configuration source or the API server
+// when ctx is cancelled. The aksapp ConfigMaps are written before the cluster
+// ConfigMap referencing them, so an aborted sync leaves the cluster on the
+// previous snapshot.
+func (s *Syncer) Run(ctx context.Context) error {
+	err := s.run(ctx)
 	if err != nil {
-		s.logger.Warnf("Failed to get configuration files in cluster folder, %s", err.Error())
-		return
-	}
-	if body == "" {
-		s.logger.Warnf("No configuration files found in cluster folder")
-		return
+		syncResultVec.WithLabelValues(syncResultFailed).Inc()
+		consecutiveFailedSyncsGauge.Set(float64(atomic.AddInt32(&s.consecutiveFailures, 1)))
+		return err
 	}
 
-	scheme := runtime.NewScheme()
-	_ = deployerv1.AddToScheme(scheme)
-	objs, err := configmaps.ParseConfig(s.logger, scheme, body)
-	if err != nil {
-		s.logger.Errorf("Failed to parse cluster configuration %s, %s",
-			configmaps.ClusterConfigMapName, err.Error())
-		return
+	syncResultVec.WithLabelValues(syncResultSucceeded).Inc()
+	atomic.StoreInt32(&s.consecutiveFailures, 0)
+	consecutiveFailedSyncsGauge.Set(0)
+	lastSuccessfulSyncGauge.SetToCurrentTime()
+	return nil
+}
+
+// callContext returns the context of one call to the configuration source or the API server
+func (s *Syncer) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.options.CallTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, s.options.CallTimeout)
+}
 
-	// Save new ConfigMaps to avoid being cleaned up
-	configMapTypeMap := make(map[string]string)
+// ConsecutiveFailures returns the number of syncs which failed in a row
+func (s *Syncer) ConsecutiveFailures() int {
+	return int(atomic.LoadInt32(&s.consecutiveFailures))
+}
 
-	// Create new ConfigMaps
-	for _, obj := range objs {
-		app := obj.(*deployerv1.AksApp)
-		s.logger.Infof("Syncing %s:%s configuration...", app.Spec.Type, app.Spec.Version)
-		aksAppBlobName := fmt.Sprintf(aksAppBlobNameFormat, app.Spec.Type, app.Spec.Version)
-		body, err := s.getAzureStorageBlob(aksAppContainerName, aksAppBlobName)
-		if err != nil {
-			s.logger.Warningf("Failed to fetch aksapp configuration, %s", err.Error())
-			continue
-		}
+func (s *Syncer) run(ctx context.Context) error {
+	s.logger.Infof("Syncing %s cluster configuration from %s...", s.clusterName, s.source)
 
-		configMapName := configmaps.GetAksAppConfigMapName(*app)
-		configMapTypeMap[app.Spec.Type] = configMapName
+	// 1. Fetch and validate all the configurations before writing any of them
+	snap, err := s.fetchSnapshot(ctx)
+	if err == nil {
+		err = s.validateSnapshot(snap)
+	}
+	if err == nil {
+		err = s.checkVersionDigests(ctx, snap)
+	}
+	if err != nil {
+		s.logger.Errorf("Failed to sync cluster configuration, keep the last known good configuration: %s",
+			err.Error())
+		return err
+	}
 
-		_, err = s.createOrUpdateConfigMap(s.newConfigMap(configMapName, body, aksAppBlobName))
-		if err != nil {
-			s.logger.Errorf("Failed to create/update aksapp configuration, %s", err.Error())
-			continue
-		}
+	// 2. Write the aksapp ConfigMaps and the cluster ConfigMap
+	if err = s.applySnapshot(ctx, snap); err != nil {
+		s.logger.Errorf("Failed to apply cluster configuration: %s", err.Error())
+		return err
 	}
+	s.lastSnapshot = snap
 
-	// Create/Update the cluster ConfigMap after creating the component
-	// configurations to avoid configurationMissingErr during reconciliation.
-	_, err = s.createOrUpdateConfigMap(s.newConfigMap(configmaps.ClusterConfigMapName, body, clusterBlobName))
-	if err != nil {
-		s.logger.Errorf("Failed to create/update cluster configuration, %s", err.Error())
+	// Forget the blobs which are no longer referenced
+	s.blobCache.prune()
+
+	// Save current versions to avoid being cleaned up
+	currentVersions := make(map[string]string)
+	for _, config := range snap.appConfigs {
+		currentVersions[config.appType] = config.version
 	}
 
 	// Clean up the obsolete ConfigMaps at last to avoid
 	// configurationMissingErr when reconciling the old AksApps.
-	err = s.cleanUpObsoleteConfigMaps(configMapTypeMap)
+	err = s.cleanUpObsoleteConfigMaps(ctx, currentVersions)
 	if err != nil {
 		s.logger.Errorf("Failed to cleanup obsolete configmaps: %s", err.Error())
 	}
+
+	return nil
+}
+
+// IsBlobRelevant checks if a change of the blob may change the configuration of
+// the cluster: the blobs of the layers of the cluster configuration, its values
+// file and the blobs of the aksapp types it uses
+func (s *Syncer) IsBlobRelevant(containerName, blobName string) bool {
+	switch containerName {
+	case clusterContainerName:
+		return s.isClusterLayerBlob(blobName) || blobName == fmt.Sprintf(valuesBlobNameFormat, s.clusterName)
+	case aksAppContainerName:
+		appTypes, ok := s.appTypes.Load().(map[string]bool)
+		if !ok {
+			// No cluster configuration fetched yet
+			return true
+		}
+		return appTypes[strings.SplitN(blobName, "/", 2)[0]]
+	default:
+		return false
+	}
 }
 
-func (s *Syncer) getAzureStorageBlobViaBlobClient(containerName, blobName string) (string, error) {
-	ctx := context.TODO()
-	url := fmt.Sprintf("https://%s.blob.%s/%s/%s",
-		s.storageAccountName, s.storageEndpointSuffix, containerName, blobName)
+// getBlob reads a blob and verifies its detached signature when public keys are configured
+func (s *Syncer) getBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	content, _, err := s.getSourceBlob(ctx, containerName, blobName)
+	return content, err
+}
 
-	data, err := s.blobClient.GetBlobData(ctx, url)
+// getSourceBlob reads a blob like getBlob, along with its SourceBlob recording
+// if its signature was verified
+func (s *Syncer) getSourceBlob(ctx context.Context, containerName, blobName string) (
+	string, configmaps.SourceBlob, error) {
+	content, err := s.readBlob(ctx, containerName, blobName)
 	if err != nil {
-		s.logger.Errorf("Failed to get container %s blob %s via blob client, %s",
-			containerName, blobName, err.Error())
-		return "", err
+		return "", configmaps.SourceBlob{}, err
 	}
-	// GetBlobData doesn't return error when 404 occurs and return nil instead
-	if data == nil {
-		s.logger.Errorf("Container %s blob %s does not exist via blob client",
-			containerName, blobName)
-		return "", errors.New("Get a non-existent blob")
+	source := configmaps.NewSourceBlob(blobName, content)
+	if len(s.options.PublicKeys) == 0 {
+		return content, source, nil
 	}
 
-	s.logger.Infof("Successfully get data from container %s blob %s",
-		containerName, blobName)
-
-	return string(data), nil
+	signature, err := s.readBlob(ctx, containerName, blobName+signatureSuffix)
+	if err != nil {
+		s.logger.Errorf("Failed to read the signature of blob %s/%s, %s", containerName, blobName, err.Error())
+		signatureVerificationsVec.WithLabelValues(containerName, signatureResultMissing).Inc()
+		return "", configmaps.SourceBlob{}, fmt.Errorf("%w: %s", ErrSignatureMissing, err.Error())
+	}
+	if !verifySignature(s.options.PublicKeys, []byte(content), decodeSignature(signature)) {
+		s.logger.Errorf("Signature of blob %s/%s is invalid", containerName, blobName)
+		signatureVerificationsVec.WithLabelValues(containerName, signatureResultInvalid).Inc()
+		return "", configmaps.SourceBlob{}, ErrSignatureInvalid
+	}
+	signatureVerificationsVec.WithLabelValues(containerName, signatureResultVerified).Inc()
+	source.Verified = true
+	return content, source, nil
 }
 
-func (s *Syncer) getAzureStorageBlobViaBlobStorageClient(containerName, blobName string) (string, error) {
-	blobStorageClient := s.storageClient.GetBlobService()
-
-	blob := blobStorageClient.GetContainerReference(containerName).GetBlobReference(blobName)
-	s.logger.Infof("Get blob form URL %s", blob.GetURL())
+// readBlob reads a blob, blobs which have been read before are only downloaded
+// again if they changed when the source supports conditional reads
+func (s *Syncer) readBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	source, ok := s.source.(ConditionalConfigSource)
+	if !ok {
+		return s.fetchBlob(ctx, containerName, blobName)
+	}
 
-	resp, err := blob.Get(&storage.GetBlobOptions{})
+	cached, found := s.blobCache.get(containerName, blobName)
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
+	start := time.Now()
+	content, version, notModified, err := source.GetBlobIfChanged(callCtx, containerName, blobName, cached.version)
+	fetchLatencyVec.WithLabelValues(containerName, fetchOperationGet).Observe(time.Since(start).Seconds())
 	if err != nil {
-		s.logger.Warnf("Failed to get container %s blob %s from Azure Storage: %s",
-			containerName, blobName, err.Error())
+		blobsFetchedVec.WithLabelValues(containerName, fetchResultFailed).Inc()
 		return "", err
 	}
+	if notModified && found {
+		blobsFetchedVec.WithLabelValues(containerName, fetchResultNotModified).Inc()
+		return cached.content, nil
+	}
+	if notModified {
+		// Not expected since no version is sent for blobs missing from the cache
+		return s.fetchBlob(ctx, containerName, blobName)
+	}
+	blobsFetchedVec.WithLabelValues(containerName, fetchResultDownloaded).Inc()
+	bytesTransferredVec.WithLabelValues(containerName).Add(float64(len(content)))
+
+	s.blobCache.set(containerName, blobName, blobCacheEntry{
+		content: content,
+		version: version,
+	})
+	return content, nil
+}
 
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(resp)
+// fetchBlob downloads a blob unconditionally
+func (s *Syncer) fetchBlob(ctx context.Context, containerName, blobName string) (string, error) {
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
+	start := time.Now()
+	content, err := s.source.GetBlob(callCtx, containerName, blobName)
+	fetchLatencyVec.WithLabelValues(containerName, fetchOperationGet).Observe(time.Since(start).Seconds())
 	if err != nil {
-		s.logger.Warnf("Failed to read data from response, %s", err.Error())
+		blobsFetchedVec.WithLabelValues(containerName, fetchResultFailed).Inc()
 		return "", err
 	}
 
-	return buf.String(), nil
+	blobsFetchedVec.WithLabelValues(containerName, fetchResultDownloaded).Inc()
+	bytesTransferredVec.WithLabelValues(containerName).Add(float64(len(content)))
+	return content, nil
 }
 
-func (s *Syncer) getAzureStorageBlob(containerName, blobName string) (string, error) {
-	// Use blob client if not nil
-	if s.blobClient != nil {
-		return s.getAzureStorageBlobViaBlobClient(containerName, blobName)
+// listBlobs returns the names of the blobs in the container starting with
+// prefix, except the detached signatures
+func (s *Syncer) listBlobs(ctx context.Context, containerName, prefix string) ([]string, error) {
+	callCtx, cancel := s.callContext(ctx)
+	defer cancel()
+	start := time.Now()
+	blobNames, err := s.source.ListBlobs(callCtx, containerName, prefix)
+	fetchLatencyVec.WithLabelValues(containerName, fetchOperationList).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
 	}
 
-	return s.getAzureStorageBlobViaBlobStorageClient(containerName, blobName)
+	var names []string
+	for _, blobName := range blobNames {
+		if !isSignatureBlob(blobName) {
+			names = append(names, blobName)
+		}
+	}
+	return names, nil
 }
 
-func (s *Syncer) getAzureStorageBlobsWithPrefixViaBlobClient(containerName, prefix string) (string, error) {
-	ctx := context.TODO()
-	url := fmt.Sprintf("https://%s.blob.%s/%s",
-		s.storageAccountName, s.storageEndpointSuffix, containerName)
-
-	blobList, err := s.blobClient.ListBlobsWithPrefix(ctx, url, prefix)
+// getBlobsWithPrefix concatenates all the blobs with the prefix as one configuration
+func (s *Syncer) getBlobsWithPrefix(ctx context.Context, containerName, prefix string) (
+	string, []configmaps.SourceBlob, error) {
+	blobNames, err := s.listBlobs(ctx, containerName, prefix)
 	if err != nil {
-		s.logger.Errorf("Failed to list container %s blobs with prefix %s via blob client, %s",
-			containerName, prefix, err.Error())
-		return "", err
+		return "", nil, err
 	}
 
-	s.logger.Infof("Successfully list blobs in container %s with prefix %s",
-		containerName, prefix)
+	return s.concatBlobs(ctx, containerName, blobNames)
+}
 
+// concatBlobs concatenates the blobs in order as one configuration, it also
+// returns the digests of the blobs
+func (s *Syncer) concatBlobs(ctx context.Context, containerName string, blobNames []string) (
+	string, []configmaps.SourceBlob, error) {
 	var body string
-	for _, blob := range blobList.Blobs {
-		blobBody, err := s.getAzureStorageBlob(containerName, blob.Name)
+	var sources []configmaps.SourceBlob
+	for _, blobName := range blobNames {
+		blobBody, source, err := s.getSourceBlob(ctx, containerName, blobName)
 		if err != nil {
 			s.logger.Errorf("Failed to get one blob of configurations %s, %s",
-				blob.Name, err.Error())
-			return "", err
+				blobName, err.Error())
+			return "", nil, err
 		}
 		body = body + blobBody
 		body = body + "---\n"
+		sources = append(sources, source)
 	}
 
-	return body, nil
+	return body, sources, nil
 }
 
-func (s *Syncer) getAzureStorageBlobsWithPrefixViaBlobStorageClient(containerName, prefix string) (string, error) {
-	blobStorageClient := s.storageClient.GetBlobService()
-
-	blobList, err := blobStorageClient.GetContainerReference(containerName).ListBlobs(storage.ListBlobsParameters{
-		Prefix: prefix,
-	})
-	if err != nil {
-		s.logger.Warnf("Failed to list container %s blobs with prefix %s from Azure Storage, %s",
-			containerName, prefix, err.Error())
-		return "", err
+// configAnnotations returns the annotations recording where a configuration
+// comes from and if the signatures of its blobs were verified
+func (s *Syncer) configAnnotations(blobURL string, sources []configmaps.SourceBlob) (map[string]string, error) {
+	annotations := map[string]string{
+		configmaps.ConfigAnnotationKey:          blobURL,
+		configmaps.ConfigSignatureAnnotationKey: signatureStatus(sources),
 	}
-
-	s.logger.Infof("Get blob list with prefix %s", prefix)
-	var body string
-	for _, blob := range blobList.Blobs {
-		s.logger.Infof("Get blob %s", blob.Name)
-		blobBody, err := s.getAzureStorageBlob(containerName, blob.Name)
+	if len(sources) > 0 {
+		data, err := json.Marshal(sources)
 		if err != nil {
-			s.logger.Warnf("Failed to get a piece of configuration %s, %s", blob.Name, err.Error())
-			return "", err
+			return nil, err
 		}
-		body = body + blobBody
-		body = body + "---\n"
+		annotations[configmaps.ConfigSourcesAnnotationKey] = string(data)
 	}
+	return annotations, nil
+}
 
-	return body, nil
+// newConfigMaps returns the ConfigMap storing the configuration followed by
+// its chunks when the configuration is too large for one ConfigMap
+func (s *Syncer) newConfigMaps(name, data string, labels, annotations map[string]string) ([]*corev1.ConfigMap, error) {
+	return configmaps.NewConfigMaps(name, s.options.Namespace, data, labels, annotations)
 }
 
-func (s *Syncer) getAzureStorageBlobsWithPrefix(containerName, prefix string) (string, error) {
-	// Use blob client if not nil
-	if s.blobClient != nil {
-		return s.getAzureStorageBlobsWithPrefixViaBlobClient(containerName, prefix)
+// writeConfigMaps creates or updates the ConfigMaps storing a configuration.
+// The chunks are written before the ConfigMap referencing them.
+func (s *Syncer) writeConfigMaps(ctx context.Context, name, data string, labels, annotations map[string]string) error {
+	cms, err := s.newConfigMaps(name, data, labels, annotations)
+	if err != nil {
+		return err
+	}
+	if len(cms) > 1 {
+		s.logger.Infof("Configuration %s is split across %d ConfigMaps", name, len(cms))
+	}
+	previousChunks, err := s.configChunks(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for i := len(cms) - 1; i >= 0; i-- {
+		if _, err = s.createOrUpdateConfigMap(ctx, cms[i]); err != nil {
+			return err
+		}
 	}
 
-	return s.getAzureStorageBlobsWithPrefixViaBlobStorageClient(containerName, prefix)
+	// The chunks of a larger previous configuration are no longer referenced
+	for i := len(cms); i < previousChunks; i++ {
+		chunkName := configmaps.GetConfigChunkName(name, i)
+		s.logger.Infof("Delete stale chunk ConfigMap:%s", chunkName)
+		deleteCtx, cancel := s.callContext(ctx)
+		err = s.kubeClient.CoreV1().ConfigMaps(s.options.Namespace).Delete(deleteCtx, chunkName, metav1.DeleteOptions{})
+		cancel()
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			configMapOperationVec.WithLabelValues(configMapOperationDelete).Inc()
+		}
+	}
+	return nil
 }
 
-func (s *Syncer) newConfigMap(name, data, blobURL string) *corev1.ConfigMap {
-	return &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: s.options.Namespace,
-			Annotations: map[string]string{
-				configmaps.ConfigAnnotationKey: blobURL,
-			},
-		},
-		Data: map[string]string{
-			configmaps.ConfigDataKey: data,
-		},
+// configChunks returns the number of ConfigMaps the configuration currently
+// stored under name is split across, 0 when there is none
+func (s *Syncer) configChunks(ctx context.Context, name string) (int, error) {
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+	existing, err := s.kubeClient.CoreV1().ConfigMaps(s.options.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, nil
 	}
+	if err != nil {
+		return 0, err
+	}
+	chunks, err := strconv.Atoi(existing.Annotations[configmaps.ConfigChunksAnnotationKey])
+	if err != nil || chunks < 1 {
+		return 1, nil
+	}
+	return chunks, nil
 }
 
 // TODO(shuche): Add mechanism to clean up ConfigMaps
-func (s *Syncer) createOrUpdateConfigMap(configmap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+func (s *Syncer) createOrUpdateConfigMap(ctx context.Context, configmap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
 	// Get specific namespace set to the syncer
 	namespace := s.options.Namespace
-	ctx := context.TODO()
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
 
 	var cm *corev1.ConfigMap
-	_, err := s.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, configmap.Name, metav1.GetOptions{})
+	existing, err := s.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, configmap.Name, metav1.GetOptions{})
 	if apierrors.IsNotFound(err) {
 		s.logger.Infof("Creating ConfigMap:%s...", configmap.Name)
 		cm, err = s.kubeClient.CoreV1().ConfigMaps(namespace).Create(ctx, configmap, metav1.CreateOptions{})
+		if err == nil {
+			configMapOperationVec.WithLabelValues(configMapOperationCreate).Inc()
+		}
+	} else if err == nil && isConfigMapUpToDate(existing, configmap) {
+		// Skip the update to avoid triggering reconciliations for nothing
+		s.logger.Infof("ConfigMap:%s is up to date", configmap.Name)
+		return existing, nil
 	} else {
 		s.logger.Infof("Updating ConfigMap:%s...", configmap.Name)
 		cm, err = s.kubeClient.CoreV1().ConfigMaps(namespace).Update(ctx, configmap, metav1.UpdateOptions{})
+		if err == nil {
+			configMapOperationVec.WithLabelValues(configMapOperationUpdate).Inc()
+		}
 	}
 
 	if err != nil {
@@ -318,49 +492,13 @@ func (s *Syncer) createOrUpdateConfigMap(configmap *corev1.ConfigMap) (*corev1.C
 	return cm, nil
 }
 
-// Cleanup obsolete configmaps after configmap and aksapp are created
-func (s *Syncer) cleanUpObsoleteConfigMaps(configMapTypeMap map[string]string) error {
-	namespace := s.options.Namespace
-	ctx := context.TODO()
-	configMapList, err := s.kubeClient.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
-
-	if err != nil {
-		s.logger.Errorf("Error when list configmaps: %s", err.Error())
-		return err
-	}
-
-	for _, c := range configMapList.Items {
-		name := c.GetName()
-		if s.isConfigMapObsolete(name, configMapTypeMap) {
-			s.logger.Infof("Cleanup obsolete configmap %s", name)
-			err = s.kubeClient.CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{})
-			if err != nil {
-				s.logger.Errorf("Error when delete configmap %s: %s", name, err.Error())
-				return err
-			}
-			s.logger.Infof("Successfully delete configmap %s", name)
-		}
-	}
-
-	return nil
-}
-
-func (s *Syncer) isConfigMapObsolete(configMapName string, configMapTypeMap map[string]string) bool {
-	// 1. Found aksapp type for give configMapName by finding longest prefix match in aksapp type list
-	// To avoid conflict when finding aksapp since there will be privatecluster and privatecluster-ccp-proxy both exist in the aksapp type list
-	matchAksAppType := ""
-	for aksappType := range configMapTypeMap {
-		if strings.HasPrefix(configMapName, aksappType) {
-			if len(aksappType) > len(matchAksAppType) {
-				matchAksAppType = aksappType
-			}
-		}
-	}
-	// 2. Check if the configMapName is the same with current valid configMap name
-	if matchAksAppType == "" {
-		s.logger.Warningf("Configmap %s has not found matching aksapp", configMapName)
+// isConfigMapUpToDate checks if the existing ConfigMap has the same content hash,
+// labels and annotations as the desired one
+func isConfigMapUpToDate(existing, desired *corev1.ConfigMap) bool {
+	hash, ok := existing.Annotations[configmaps.ConfigHashAnnotationKey]
+	if !ok || hash != desired.Annotations[configmaps.ConfigHashAnnotationKey] {
 		return false
 	}
-	s.logger.Infof("Found configmaps of aksapp %s: %s - %s", matchAksAppType, configMapName, configMapTypeMap[matchAksAppType])
-	return !strings.EqualFold(configMapTypeMap[matchAksAppType], configMapName)
+	return reflect.DeepEqual(existing.Labels, desired.Labels) &&
+		reflect.DeepEqual(existing.Annotations, desired.Annotations)
 }
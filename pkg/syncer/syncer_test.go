@@ -2,20 +2,52 @@ package syncer
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient"
+	"github.com/Azure/aks-deployer/pkg/clients/blobclient/mock_blobclient"
 	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/sirupsen/logrus"
-	"github.com/Azure/aks-deployer/pkg/clients/blobclient/mock_blobclient"
 	"k8s.io/client-go/kubernetes/fake"
 
+	"github.com/Azure/aks-deployer/pkg/configmaps"
 	"github.com/Azure/aks-deployer/pkg/log"
 )
 
+// newConfigMap returns the ConfigMap of a configuration small enough for one ConfigMap
+func (s *Syncer) newConfigMap(name, data, blobURL string) *corev1.ConfigMap {
+	annotations, err := s.configAnnotations(blobURL, nil)
+	Expect(err).To(BeNil())
+	cms, err := s.newConfigMaps(name, data, nil, annotations)
+	Expect(err).To(BeNil())
+	Expect(cms).To(HaveLen(1))
+	return cms[0]
+}
+
+// newBlobData returns the blob data returned by the blob client, nil data means 404
+func newBlobData(data []byte) *blobclient.BlobData {
+	if data == nil {
+		return nil
+	}
+	return &blobclient.BlobData{Data: data, ETag: "test-etag"}
+}
+
 var _ = Describe("Test Syncer with Blob Client", func() {
 	var (
 		logger     *logrus.Entry
@@ -34,25 +66,25 @@ var _ = Describe("Test Syncer with Blob Client", func() {
 			"test-storage-account-name", "test-storage-endpoint-suffix", "test-cluster-name", logger)
 	})
 
-	It("Test getAzureStorageBlob with BlobClient with empty bytes", func() {
-		blobClient.EXPECT().GetBlobData(gomock.Any(), gomock.Any()).Times(1).Return([]byte(""), nil)
-		_, err := syncer.getAzureStorageBlob("test-container-name", "test-blob-name")
+	It("Test getBlob with BlobClient with empty bytes", func() {
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(newBlobData([]byte("")), nil)
+		_, err := syncer.getBlob(context.Background(), "test-container-name", "test-blob-name")
 		Expect(err).To(BeNil())
 	})
 
-	It("Test getAzureStorageBlob with BlobClient with nil (404)", func() {
-		blobClient.EXPECT().GetBlobData(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
-		_, err := syncer.getAzureStorageBlob("test-container-name", "test-blob-name")
+	It("Test getBlob with BlobClient with nil (404)", func() {
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+		_, err := syncer.getBlob(context.Background(), "test-container-name", "test-blob-name")
 		Expect(err).NotTo(BeNil())
 	})
 
-	It("Test getAzureStorageBlobsWithPrefix with BlobClient", func() {
+	It("Test getBlobsWithPrefix with BlobClient", func() {
 		blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(storage.BlobListResponse{}, nil)
-		_, err := syncer.getAzureStorageBlobsWithPrefix("test-container-name", "test-blob-name")
+		_, _, err := syncer.getBlobsWithPrefix(context.Background(), "test-container-name", "test-blob-name")
 		Expect(err).To(BeNil())
 	})
 
-	It("Test getAzureStorageBlobsWithPrefix with BlobClient with one blob", func() {
+	It("Test getBlobsWithPrefix with BlobClient with one blob", func() {
 		blobList := storage.BlobListResponse{
 			Blobs: []storage.Blob{
 				{
@@ -62,15 +94,15 @@ var _ = Describe("Test Syncer with Blob Client", func() {
 		}
 		content := []byte("blob-1-data\n")
 
-		blobClient.EXPECT().GetBlobData(gomock.Any(), gomock.Any()).Times(1).Return(content, nil)
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(newBlobData(content), nil)
 		blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(blobList, nil)
 
-		data, err := syncer.getAzureStorageBlobsWithPrefix("test-container-name", "test-blob-name")
+		data, _, err := syncer.getBlobsWithPrefix(context.Background(), "test-container-name", "test-blob-name")
 		Expect(err).To(BeNil())
 		Expect(data).To(Equal(string(content) + "---\n"))
 	})
 
-	It("Test getAzureStorageBlobsWithPrefix with BlobClient with multiple blobs", func() {
+	It("Test getBlobsWithPrefix with BlobClient with multiple blobs", func() {
 		blobList := storage.BlobListResponse{
 			Blobs: []storage.Blob{
 				{
@@ -84,16 +116,16 @@ var _ = Describe("Test Syncer with Blob Client", func() {
 		content1 := []byte("blob-1-data\n")
 		content2 := []byte("blob-2-data\n")
 
-		blobClient.EXPECT().GetBlobData(gomock.Any(), gomock.Any()).Times(1).Return(content1, nil)
-		blobClient.EXPECT().GetBlobData(gomock.Any(), gomock.Any()).Times(1).Return(content2, nil)
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(newBlobData(content1), nil)
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(newBlobData(content2), nil)
 		blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(blobList, nil)
 
-		data, err := syncer.getAzureStorageBlobsWithPrefix("test-container-name", "test-blob-name")
+		data, _, err := syncer.getBlobsWithPrefix(context.Background(), "test-container-name", "test-blob-name")
 		Expect(err).To(BeNil())
 		Expect(data).To(Equal(string(content1) + "---\n" + string(content2) + "---\n"))
 	})
 
-	It("Test getAzureStorageBlobsWithPrefix with BlobClient with empty data", func() {
+	It("Test getBlobsWithPrefix with BlobClient with empty data", func() {
 		blobList := storage.BlobListResponse{
 			Blobs: []storage.Blob{
 				{
@@ -107,23 +139,22 @@ var _ = Describe("Test Syncer with Blob Client", func() {
 		var content1 []byte
 		var content2 []byte
 
-		blobClient.EXPECT().GetBlobData(gomock.Any(), gomock.Any()).Times(1).Return(content1, nil)
-		blobClient.EXPECT().GetBlobData(gomock.Any(), gomock.Any()).Times(1).Return(content2, nil)
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(newBlobData(content1), nil)
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(newBlobData(content2), nil)
 		blobClient.EXPECT().ListBlobsWithPrefix(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(blobList, nil)
 
-		_, err := syncer.getAzureStorageBlobsWithPrefix("test-container-name", "test-blob-name")
+		_, _, err := syncer.getBlobsWithPrefix(context.Background(), "test-container-name", "test-blob-name")
 		Expect(err).NotTo(BeNil())
 	})
 })
 
-var _ = Describe("Test Syncer clean up obsolete configmaps", func() {
+var _ = Describe("Test Syncer incremental sync", func() {
 	var (
-		logger           *logrus.Entry
-		kubeClient       *fake.Clientset
-		blobClient       *mock_blobclient.MockInterface
-		syncer           *Syncer
-		ctx              context.Context
-		configMapTypeMap map[string]string
+		logger     *logrus.Entry
+		kubeClient *fake.Clientset
+		blobClient *mock_blobclient.MockInterface
+		syncer     *Syncer
+		ctx        context.Context
 	)
 
 	BeforeEach(func() {
@@ -133,48 +164,439 @@ var _ = Describe("Test Syncer clean up obsolete configmaps", func() {
 		blobClient = mock_blobclient.NewMockInterface(mockCtrl)
 		syncer = NewSyncerWithBlobClient(kubeClient, blobClient,
 			"test-storage-account-name", "test-storage-endpoint-suffix", "test-cluster-name", logger)
-		opt := Options{
-			Namespace: "test-namespace",
-		}
-		syncer.SetOptions(opt)
-		kubeClient.CoreV1().ConfigMaps("test-namespace").Create(ctx, syncer.newConfigMap("aksapp-test", "test", "test-blob-url"), metav1.CreateOptions{})
-		kubeClient.CoreV1().ConfigMaps("test-namespace").Create(ctx, syncer.newConfigMap("aksapp-123-test", "test", "test-blob-url"), metav1.CreateOptions{})
-		configMapTypeMap = make(map[string]string)
-		configMapTypeMap["aksapp"] = "aksapp-test"
-		configMapTypeMap["aksapp-123"] = "aksapp-123-test"
-	})
-
-	It("Test cleanUpObsoleteConfigMaps with configmaps to delete obsolete configmaps", func() {
-		kubeClient.CoreV1().ConfigMaps("test-namespace").Create(ctx, syncer.newConfigMap("aksapp-test123", "test", "test-blob-url"), metav1.CreateOptions{})
-		err := syncer.cleanUpObsoleteConfigMaps(configMapTypeMap)
-		Expect(err).To(BeNil())
-		listAfterCleanup, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
-		Expect(len(listAfterCleanup.Items)).To(Equal(2))
-		for _, c := range listAfterCleanup.Items {
-			Expect(c.GetName).NotTo(Equal("aksapp-test123"))
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+		ctx = context.Background()
+	})
+
+	It("Test getBlob sends the cached ETag and reuses the cached content", func() {
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), "").Times(1).
+			Return(&blobclient.BlobData{Data: []byte("data"), ETag: "etag-1"}, nil)
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), "etag-1").Times(1).
+			Return(&blobclient.BlobData{ETag: "etag-1", NotModified: true}, nil)
+
+		data, err := syncer.getBlob(context.Background(), "test-container-name", "test-blob-name")
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal("data"))
+
+		data, err = syncer.getBlob(context.Background(), "test-container-name", "test-blob-name")
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal("data"))
+	})
+
+	It("Test getBlob forgets pruned blobs", func() {
+		blobClient.EXPECT().GetBlobDataIfNoneMatch(gomock.Any(), gomock.Any(), "").Times(2).
+			Return(&blobclient.BlobData{Data: []byte("data"), ETag: "etag-1"}, nil)
+
+		_, err := syncer.getBlob(context.Background(), "test-container-name", "test-blob-name")
+		Expect(err).To(BeNil())
+		syncer.blobCache.prune()
+		syncer.blobCache.prune()
+		_, err = syncer.getBlob(context.Background(), "test-container-name", "test-blob-name")
+		Expect(err).To(BeNil())
+	})
+
+	It("Test createOrUpdateConfigMap skips unchanged ConfigMaps", func() {
+		cm, err := syncer.createOrUpdateConfigMap(context.Background(), syncer.newConfigMap("test-config", "data", "test-blob-url"))
+		Expect(err).To(BeNil())
+		kubeClient.ClearActions()
+
+		_, err = syncer.createOrUpdateConfigMap(context.Background(), syncer.newConfigMap("test-config", "data", "test-blob-url"))
+		Expect(err).To(BeNil())
+		for _, action := range kubeClient.Actions() {
+			Expect(action.GetVerb()).To(Equal("get"))
 		}
-		kubeClient.CoreV1().ConfigMaps("test-namespace").Create(ctx, syncer.newConfigMap("aksapp-123-test123", "test", "test-blob-url"), metav1.CreateOptions{})
-		err = syncer.cleanUpObsoleteConfigMaps(configMapTypeMap)
+
+		updated, err := syncer.createOrUpdateConfigMap(context.Background(), syncer.newConfigMap("test-config", "new-data", "test-blob-url"))
+		Expect(err).To(BeNil())
+		Expect(updated.Annotations[configmaps.ConfigHashAnnotationKey]).NotTo(
+			Equal(cm.Annotations[configmaps.ConfigHashAnnotationKey]))
+		got, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "test-config", metav1.GetOptions{})
+		Expect(got.Data[configmaps.ConfigDataKey]).To(Equal("new-data"))
+	})
+})
+
+const testAppConfig = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: default
+`
+
+func testClusterConfig(name, appType, version string) string {
+	return fmt.Sprintf(`apiVersion: deployer.aks/v1
+kind: AksApp
+metadata:
+  name: %s
+  namespace: deployer
+spec:
+  type: %s
+  version: %s
+`, name, appType, version)
+}
+
+var _ = Describe("Test Syncer Run", func() {
+	var (
+		logger     *logrus.Entry
+		kubeClient *fake.Clientset
+		root       string
+		syncer     *Syncer
+		ctx        context.Context
+	)
+
+	getConfigMap := func(name string) (*corev1.ConfigMap, error) {
+		return kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, name, metav1.GetOptions{})
+	}
+
+	manifest := func(name string) string {
+		return strings.Replace(testAppConfig, "name: test", "name: "+name, 1)
+	}
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		kubeClient = fake.NewSimpleClientset()
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource(root, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Test Run writes the aksapp and cluster ConfigMaps", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"cluster/test-cluster/b.yaml": testClusterConfig("app-b", "type-b", "2.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+			"aksapp/type-b/2.0.0.yaml":    testAppConfig,
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		_, err := getConfigMap("type-a-1.0.0")
+		Expect(err).To(BeNil())
+		_, err = getConfigMap("type-b-2.0.0")
+		Expect(err).To(BeNil())
+		_, err = getConfigMap(configmaps.ClusterConfigMapName)
+		Expect(err).To(BeNil())
+	})
+
+	It("Test Run writes nothing when an aksapp blob is missing", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"cluster/test-cluster/b.yaml": testClusterConfig("app-b", "type-b", "2.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+		})
+
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		blobErr, ok := err.(*BlobError)
+		Expect(ok).To(BeTrue())
+		Expect(blobErr.BlobName).To(Equal("type-b/2.0.0.yaml"))
+
+		list, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
+		Expect(list.Items).To(BeEmpty())
+	})
+
+	It("Test Run keeps the last known good configuration", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+		})
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		good, _ := getConfigMap(configmaps.ClusterConfigMapName)
+
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.1.0"),
+			"aksapp/type-a/1.1.0.yaml":    "not: [valid",
+		})
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("type-a/1.1.0.yaml"))
+
+		cm, _ := getConfigMap(configmaps.ClusterConfigMapName)
+		Expect(cm.Data).To(Equal(good.Data))
+		_, err = getConfigMap("type-a-1.0.0")
+		Expect(err).To(BeNil())
+		_, err = getConfigMap("type-a-1.1.0")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Test Run rejects conflicting versions of the same type", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"cluster/test-cluster/b.yaml": testClusterConfig("app-b", "type-a", "2.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+			"aksapp/type-a/2.0.0.yaml":    testAppConfig,
+		})
+
+		Expect(syncer.Run(context.Background())).NotTo(Succeed())
+		list, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
+		Expect(list.Items).To(BeEmpty())
+	})
+
+	It("Test Run concatenates the manifests of an aksapp folder", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml":   testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0/b.yaml":    manifest("b"),
+			"aksapp/type-a/1.0.0/a.yaml":    manifest("a"),
+			"aksapp/type-a/1.0.0/c/d.yaml":  manifest("d"),
+			"aksapp/type-a/1.0.0.yaml":      "not: [valid",
+			"aksapp/type-a/1.0.0-rc.1.yaml": "not: [valid",
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		cm, err := getConfigMap("type-a-1.0.0")
+		Expect(err).To(BeNil())
+		Expect(cm.Data[configmaps.ConfigDataKey]).To(Equal(manifest("a") + "---\n" + manifest("b") + "---\n" + manifest("d") + "---\n"))
+		Expect(cm.Annotations).To(HaveKeyWithValue(configmaps.ConfigAnnotationKey, "type-a/1.0.0/"))
+
+		var sources []configmaps.SourceBlob
+		Expect(json.Unmarshal([]byte(cm.Annotations[configmaps.ConfigSourcesAnnotationKey]), &sources)).To(Succeed())
+		Expect(sources).To(Equal([]configmaps.SourceBlob{
+			configmaps.NewSourceBlob("type-a/1.0.0/a.yaml", manifest("a")),
+			configmaps.NewSourceBlob("type-a/1.0.0/b.yaml", manifest("b")),
+			configmaps.NewSourceBlob("type-a/1.0.0/c/d.yaml", manifest("d")),
+		}))
+	})
+
+	It("Test Run orders the manifests of an aksapp folder with its index", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml":   testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0/index.txt": "# CRDs first\nc/d.yaml\n\nb.yaml\n",
+			"aksapp/type-a/1.0.0/b.yaml":    manifest("b"),
+			"aksapp/type-a/1.0.0/a.yaml":    manifest("a"),
+			"aksapp/type-a/1.0.0/c/d.yaml":  manifest("d"),
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		cm, err := getConfigMap("type-a-1.0.0")
+		Expect(err).To(BeNil())
+		Expect(cm.Data[configmaps.ConfigDataKey]).To(Equal(manifest("d") + "---\n" + manifest("b") + "---\n" + manifest("a") + "---\n"))
+
+		writeFiles(root, map[string]string{
+			"aksapp/type-a/1.0.0/index.txt": "missing.yaml\n",
+		})
+		err = syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("missing.yaml"))
+	})
+
+	It("Test Run splits large configurations across ConfigMaps", func() {
+		buf := make([]byte, 1536*1024)
+		_, err := rand.Read(buf)
 		Expect(err).To(BeNil())
-		listAfterCleanup, _ = kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
-		Expect(len(listAfterCleanup.Items)).To(Equal(2))
-		for _, c := range listAfterCleanup.Items {
-			Expect(c.GetName).NotTo(Equal("aksapp-123-test123"))
+		largeAppConfig := testAppConfig + "data:\n  blob: " + base64.StdEncoding.EncodeToString(buf) + "\n"
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    largeAppConfig,
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		cm, err := getConfigMap("type-a-1.0.0")
+		Expect(err).To(BeNil())
+		Expect(cm.Annotations).To(HaveKeyWithValue(configmaps.ConfigEncodingAnnotationKey, configmaps.ConfigEncodingGzip))
+
+		// Chunks are not obsolete
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		data, err := configmaps.GetConfigData(cm, getConfigMap)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(largeAppConfig))
+	})
+
+	It("Test Run aborts when the context is cancelled", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+		})
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		err := syncer.Run(cancelled)
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		list, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
+		Expect(list.Items).To(BeEmpty())
+	})
+
+	It("Test Run counts consecutive failures", func() {
+		parseFailures := testutil.ToFloat64(parseFailuresVec.WithLabelValues(aksAppContainerName))
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    "not: [valid",
+		})
+		Expect(syncer.Run(context.Background())).NotTo(Succeed())
+		Expect(syncer.Run(context.Background())).NotTo(Succeed())
+		Expect(syncer.ConsecutiveFailures()).To(Equal(2))
+		Expect(testutil.ToFloat64(consecutiveFailedSyncsGauge)).To(Equal(float64(2)))
+		Expect(testutil.ToFloat64(parseFailuresVec.WithLabelValues(aksAppContainerName))).To(Equal(parseFailures + 2))
+
+		writeFiles(root, map[string]string{
+			"aksapp/type-a/1.0.0.yaml": testAppConfig,
+		})
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		Expect(syncer.ConsecutiveFailures()).To(Equal(0))
+		Expect(testutil.ToFloat64(lastSuccessfulSyncGauge)).NotTo(BeZero())
+	})
+})
+
+var _ = Describe("Test Syncer clean up obsolete configmaps", func() {
+	var (
+		logger     *logrus.Entry
+		kubeClient *fake.Clientset
+		syncer     *Syncer
+		ctx        context.Context
+	)
+
+	createConfigMap := func(name string, labels map[string]string) {
+		cms, err := syncer.newConfigMaps(name, "test", labels, map[string]string{
+			configmaps.ConfigAnnotationKey: "test-blob-url",
+		})
+		Expect(err).To(BeNil())
+		_, err = kubeClient.CoreV1().ConfigMaps("test-namespace").Create(ctx, cms[0], metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+	}
+
+	listNames := func() []string {
+		list, err := kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
+		Expect(err).To(BeNil())
+		var names []string
+		for _, c := range list.Items {
+			names = append(names, c.Name)
 		}
+		return names
+	}
+
+	BeforeEach(func() {
+		logger = log.New("test-service", "test-version")
+		kubeClient = fake.NewSimpleClientset()
+		syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource("", logger), "test-cluster-name", logger)
+		syncer.SetOptions(Options{
+			Namespace:        "test-namespace",
+			GCGracePeriod:    0,
+			GCRetainVersions: 0,
+		})
+		ctx = context.Background()
+
+		createConfigMap("aksapp-1.0.0", managedLabels("aksapp", "1.0.0"))
+		createConfigMap("aksapp-123-1.0.0", managedLabels("aksapp-123", "1.0.0"))
+		createConfigMap(configmaps.ClusterConfigMapName, managedLabels("", ""))
 	})
 
-	It("Test cleanUpObsoleteConfigMaps and no need to cleanup", func() {
-		err := syncer.cleanUpObsoleteConfigMaps(configMapTypeMap)
+	It("Test cleanUpObsoleteConfigMaps deletes obsolete versions", func() {
+		createConfigMap("aksapp-0.9.0", managedLabels("aksapp", "0.9.0"))
+		createConfigMap("aksapp-123-0.9.0", managedLabels("aksapp-123", "0.9.0"))
+
+		err := syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0", "aksapp-123": "1.0.0"})
 		Expect(err).To(BeNil())
-		listAfterCleanup, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
-		Expect(len(listAfterCleanup.Items)).To(Equal(2))
+		Expect(listNames()).To(ConsistOf("aksapp-1.0.0", "aksapp-123-1.0.0", configmaps.ClusterConfigMapName))
 	})
 
-	It("Test cleanUpObsoleteConfigMaps and with no matching aksapp", func() {
-		kubeClient.CoreV1().ConfigMaps("test-namespace").Create(ctx, syncer.newConfigMap("aks321-test123", "test", "test-blob-url"), metav1.CreateOptions{})
-		err := syncer.cleanUpObsoleteConfigMaps(configMapTypeMap)
+	It("Test cleanUpObsoleteConfigMaps only deletes ConfigMaps managed by the syncer", func() {
+		_, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "aksapp-0.9.0", Namespace: "test-namespace"},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		createConfigMap("other", map[string]string{configmaps.AppTypeLabelKey: "aksapp"})
+
+		err = syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0", "aksapp-123": "1.0.0"})
+		Expect(err).To(BeNil())
+		Expect(listNames()).To(ConsistOf("aksapp-1.0.0", "aksapp-123-1.0.0", configmaps.ClusterConfigMapName,
+			"aksapp-0.9.0", "other"))
+	})
+
+	It("Test cleanUpObsoleteConfigMaps collects the ConfigMaps written before they were labeled", func() {
+		createConfigMap("aksapp-0.9.0", nil)
+		createConfigMap("aksapp-123-0.9.0", nil)
+		createConfigMap("unknown-0.9.0", nil)
+
+		err := syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0", "aksapp-123": "1.0.0"})
+		Expect(err).To(BeNil())
+		Expect(listNames()).To(ConsistOf("aksapp-1.0.0", "aksapp-123-1.0.0", configmaps.ClusterConfigMapName,
+			"unknown-0.9.0"))
+	})
+
+	It("Test labelLegacyConfigMaps keeps the labels of the ConfigMaps", func() {
+		createConfigMap("aksapp-0.9.0", map[string]string{"team": "test-team"})
+
+		Expect(syncer.labelLegacyConfigMaps(ctx, map[string]string{"aksapp": "1.0.0"})).To(Succeed())
+		c, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "aksapp-0.9.0", metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(c.Labels).To(HaveKeyWithValue("team", "test-team"))
+		Expect(c.Labels).To(HaveKeyWithValue(configmaps.ManagedByLabelKey, configmaps.ManagedBySyncer))
+		Expect(c.Labels).To(HaveKeyWithValue(configmaps.AppVersionLabelKey, "0.9.0"))
+	})
+
+	It("Test writeConfigMaps deletes the chunks of a larger previous configuration", func() {
+		buf := make([]byte, 1536*1024)
+		_, err := rand.Read(buf)
+		Expect(err).To(BeNil())
+		labels := managedLabels("aksapp", "1.0.0")
+		annotations := map[string]string{configmaps.ConfigAnnotationKey: "test-blob-url"}
+		Expect(syncer.writeConfigMaps(ctx, "aksapp-1.0.0", base64.StdEncoding.EncodeToString(buf),
+			labels, annotations)).To(Succeed())
+		Expect(listNames()).To(ContainElement(configmaps.GetConfigChunkName("aksapp-1.0.0", 1)))
+
+		Expect(syncer.writeConfigMaps(ctx, "aksapp-1.0.0", "test", labels, annotations)).To(Succeed())
+		Expect(listNames()).To(ConsistOf("aksapp-1.0.0", "aksapp-123-1.0.0", configmaps.ClusterConfigMapName))
+	})
+
+	It("Test cleanUpObsoleteConfigMaps deletes the types removed from the cluster configuration", func() {
+		err := syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0"})
+		Expect(err).To(BeNil())
+		Expect(listNames()).To(ConsistOf("aksapp-1.0.0", configmaps.ClusterConfigMapName))
+	})
+
+	It("Test cleanUpObsoleteConfigMaps keeps obsolete versions during the grace period", func() {
+		syncer.options.GCGracePeriod = time.Hour
+		createConfigMap("aksapp-0.9.0", managedLabels("aksapp", "0.9.0"))
+
+		err := syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0", "aksapp-123": "1.0.0"})
+		Expect(err).To(BeNil())
+		Expect(listNames()).To(ContainElement("aksapp-0.9.0"))
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "aksapp-0.9.0", metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(cm.Annotations).To(HaveKey(configmaps.ObsoleteSinceAnnotationKey))
+
+		// The grace period starts when the version becomes obsolete
+		cm.Annotations[configmaps.ObsoleteSinceAnnotationKey] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+		_, err = kubeClient.CoreV1().ConfigMaps("test-namespace").Update(ctx, cm, metav1.UpdateOptions{})
+		Expect(err).To(BeNil())
+		err = syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0", "aksapp-123": "1.0.0"})
+		Expect(err).To(BeNil())
+		Expect(listNames()).NotTo(ContainElement("aksapp-0.9.0"))
+	})
+
+	It("Test cleanUpObsoleteConfigMaps retains the most recent obsolete versions", func() {
+		syncer.options.GCRetainVersions = 1
+		for i, version := range []string{"0.7.0", "0.8.0", "0.9.0"} {
+			name := "aksapp-" + version
+			createConfigMap(name, managedLabels("aksapp", version))
+			cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			cm.Annotations[configmaps.ObsoleteSinceAnnotationKey] = time.Now().Add(time.Duration(i-3) * time.Hour).UTC().Format(time.RFC3339)
+			_, err = kubeClient.CoreV1().ConfigMaps("test-namespace").Update(ctx, cm, metav1.UpdateOptions{})
+			Expect(err).To(BeNil())
+		}
+
+		err := syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0", "aksapp-123": "1.0.0"})
+		Expect(err).To(BeNil())
+		Expect(listNames()).To(ConsistOf("aksapp-1.0.0", "aksapp-123-1.0.0", configmaps.ClusterConfigMapName,
+			"aksapp-0.9.0"))
+	})
+
+	It("Test rewriting an obsolete version makes it current again", func() {
+		syncer.options.GCGracePeriod = time.Hour
+		createConfigMap("aksapp-0.9.0", managedLabels("aksapp", "0.9.0"))
+		err := syncer.cleanUpObsoleteConfigMaps(context.Background(), map[string]string{"aksapp": "1.0.0", "aksapp-123": "1.0.0"})
+		Expect(err).To(BeNil())
+
+		err = syncer.writeConfigMaps(context.Background(), "aksapp-0.9.0", "test", managedLabels("aksapp", "0.9.0"),
+			map[string]string{configmaps.ConfigAnnotationKey: "test-blob-url"})
+		Expect(err).To(BeNil())
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "aksapp-0.9.0", metav1.GetOptions{})
 		Expect(err).To(BeNil())
-		listAfterCleanup, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(ctx, metav1.ListOptions{})
-		Expect(len(listAfterCleanup.Items)).To(Equal(3))
+		Expect(cm.Annotations).NotTo(HaveKey(configmaps.ObsoleteSinceAnnotationKey))
 	})
 })
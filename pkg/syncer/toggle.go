@@ -0,0 +1,236 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/deploy"
+)
+
+// ToggleDocument is the feature-toggle document served at Options.ToggleURL.
+// Rules are evaluated in order for every AksApp of the cluster configuration,
+// a later matching rule overrides the decisions of the earlier ones.
+//
+// Example:
+//
+//	rules:
+//	- name: kill-switch-foo
+//	  apps:
+//	  - type: foo
+//	    enabled: false
+//	- name: dark-launch-foo-in-eastus
+//	  match:
+//	    regions: ["eastus"]
+//	    environments: ["staging", "prod"]
+//	  apps:
+//	  - type: foo
+//	    enabled: true
+//	    version: 1.2.0
+type ToggleDocument struct {
+	Rules []ToggleRule `json:"rules"`
+}
+
+// ToggleRule applies app toggles to the clusters it matches
+type ToggleRule struct {
+	Name  string      `json:"name,omitempty"`
+	Match ToggleMatch `json:"match,omitempty"`
+	Apps  []AppToggle `json:"apps"`
+}
+
+// ToggleMatch selects clusters with shell patterns as supported by path.Match.
+// An empty list matches everything.
+type ToggleMatch struct {
+	Clusters     []string `json:"clusters,omitempty"`
+	Regions      []string `json:"regions,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+}
+
+// AppToggle decides if the AksApps of a type are included and which version they use
+type AppToggle struct {
+	// Type is the AksApp type, shell patterns are supported
+	Type string `json:"type"`
+	// Enabled excludes the AksApps of the type when false, unset leaves the decision unchanged
+	Enabled *bool `json:"enabled,omitempty"`
+	// Version overrides the version of the AksApps of the type when set
+	Version string `json:"version,omitempty"`
+}
+
+// ToggleTarget identifies the cluster toggle rules are evaluated for
+type ToggleTarget struct {
+	Cluster     string
+	Region      string
+	Environment string
+}
+
+// toggleDecision is the result of evaluating the toggle rules for an AksApp
+type toggleDecision struct {
+	enabled bool
+	version string
+}
+
+// ParseToggleDocument parses a toggle document in YAML or JSON
+func ParseToggleDocument(data []byte) (*ToggleDocument, error) {
+	doc := &ToggleDocument{}
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data))
+	if err := decoder.Decode(doc); err != nil {
+		return nil, err
+	}
+
+	for i, rule := range doc.Rules {
+		patterns := append(append(append([]string{}, rule.Match.Clusters...),
+			rule.Match.Regions...), rule.Match.Environments...)
+		for _, app := range rule.Apps {
+			if app.Type == "" {
+				return nil, fmt.Errorf("rule %d (%s) has an app toggle without type", i, rule.Name)
+			}
+			patterns = append(patterns, app.Type)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d (%s) has an invalid pattern %q: %s",
+					i, rule.Name, pattern, err.Error())
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// decide evaluates the rules of the document for an AksApp on the target cluster
+func (d *ToggleDocument) decide(target ToggleTarget, app *deployerv1.AksApp) toggleDecision {
+	decision := toggleDecision{
+		enabled: true,
+		version: app.Spec.Version,
+	}
+
+	for _, rule := range d.Rules {
+		if !rule.Match.matches(target) {
+			continue
+		}
+		for _, toggle := range rule.Apps {
+			if !matchAny([]string{toggle.Type}, app.Spec.Type) {
+				continue
+			}
+			if toggle.Enabled != nil {
+				decision.enabled = *toggle.Enabled
+			}
+			if toggle.Version != "" {
+				decision.version = toggle.Version
+			}
+		}
+	}
+
+	return decision
+}
+
+func (m ToggleMatch) matches(target ToggleTarget) bool {
+	return (len(m.Clusters) == 0 || matchAny(m.Clusters, target.Cluster)) &&
+		(len(m.Regions) == 0 || matchAny(m.Regions, target.Region)) &&
+		(len(m.Environments) == 0 || matchAny(m.Environments, target.Environment))
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		// Patterns are validated when the document is parsed
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Syncer) toggleTarget() ToggleTarget {
+	return ToggleTarget{
+		Cluster:     s.clusterName,
+		Region:      s.options.Region,
+		Environment: s.environment(),
+	}
+}
+
+// environment returns the environment of the cluster
+func (s *Syncer) environment() string {
+	if s.options.Environment != "" {
+		return s.options.Environment
+	}
+	return deploy.GetDeploymentConfig().DeployEnv
+}
+
+// fetchToggles downloads and parses the toggle document
+func (s *Syncer) fetchToggles(ctx context.Context) (*ToggleDocument, error) {
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.options.ToggleURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{Timeout: httpSourceTimeout}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, s.options.ToggleURL)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseToggleDocument(data)
+}
+
+// applyToggles gates the AksApps of the snapshot with the toggle document.
+// The cluster configuration is rewritten when any AksApp is excluded or
+// gets another version.
+func (s *Syncer) applyToggles(ctx context.Context, snap *snapshot, scheme *runtime.Scheme) error {
+	if s.options.ToggleURL == "" {
+		return nil
+	}
+
+	doc, err := s.fetchToggles(ctx)
+	if err != nil {
+		s.logger.Errorf("Failed to fetch toggles from %s, %s", s.options.ToggleURL, err.Error())
+		return fmt.Errorf("failed to fetch toggles from %s: %s", s.options.ToggleURL, err.Error())
+	}
+
+	target := s.toggleTarget()
+	changed := false
+	var apps []*deployerv1.AksApp
+	for _, app := range snap.apps {
+		decision := doc.decide(target, app)
+		if !decision.enabled {
+			s.logger.Infof("AksApp %s/%s (%s) is disabled by toggles", app.Namespace, app.Name, app.Spec.Type)
+			changed = true
+			continue
+		}
+		if decision.version != app.Spec.Version {
+			s.logger.Infof("AksApp %s/%s (%s) version is overridden by toggles: %s -> %s",
+				app.Namespace, app.Name, app.Spec.Type, app.Spec.Version, decision.version)
+			app.Spec.Version = decision.version
+			if snap.provenance != nil {
+				snap.provenance.set(app, "version", provenanceToggles)
+			}
+			changed = true
+		}
+		apps = append(apps, app)
+	}
+	snap.apps = apps
+
+	if !changed {
+		return nil
+	}
+
+	return snap.serializeApps(scheme)
+}
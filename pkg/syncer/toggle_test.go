@@ -0,0 +1,144 @@
+package syncer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+const testToggles = `
+rules:
+- name: kill-switch
+  apps:
+  - type: type-b
+    enabled: false
+- name: dark-launch
+  match:
+    clusters: ["test-*"]
+    regions: ["eastus"]
+  apps:
+  - type: type-b
+    enabled: true
+    version: 2.1.0
+- name: pin
+  match:
+    environments: ["staging"]
+  apps:
+  - type: "*"
+    version: 0.0.1
+`
+
+var _ = Describe("Test toggles", func() {
+	newApp := func(appType, version string) *deployerv1.AksApp {
+		return &deployerv1.AksApp{
+			Spec: deployerv1.AksAppSpec{Type: appType, Version: version},
+		}
+	}
+
+	It("Test ParseToggleDocument rejects invalid documents", func() {
+		_, err := ParseToggleDocument([]byte("rules:\n- apps:\n  - enabled: false\n"))
+		Expect(err).NotTo(BeNil())
+		_, err = ParseToggleDocument([]byte("rules:\n- match:\n    clusters: [\"[\"]\n  apps: []\n"))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Test later rules override earlier ones", func() {
+		doc, err := ParseToggleDocument([]byte(testToggles))
+		Expect(err).To(BeNil())
+
+		target := ToggleTarget{Cluster: "test-cluster", Region: "westus", Environment: "prod"}
+		Expect(doc.decide(target, newApp("type-a", "1.0.0"))).To(Equal(toggleDecision{enabled: true, version: "1.0.0"}))
+		Expect(doc.decide(target, newApp("type-b", "2.0.0")).enabled).To(BeFalse())
+
+		target.Region = "eastus"
+		Expect(doc.decide(target, newApp("type-b", "2.0.0"))).To(Equal(toggleDecision{enabled: true, version: "2.1.0"}))
+
+		target.Environment = "staging"
+		Expect(doc.decide(target, newApp("type-a", "1.0.0"))).To(Equal(toggleDecision{enabled: true, version: "0.0.1"}))
+	})
+})
+
+var _ = Describe("Test Syncer Run with toggles", func() {
+	var (
+		logger     *logrus.Entry
+		kubeClient *fake.Clientset
+		root       string
+		server     *httptest.Server
+		toggles    string
+		syncer     *Syncer
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		kubeClient = fake.NewSimpleClientset()
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		toggles = testToggles
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if toggles == "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(toggles))
+		}))
+		syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource(root, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace", ToggleURL: server.URL, Region: "eastus"})
+
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "1.0.0"),
+			"cluster/test-cluster/b.yaml": testClusterConfig("app-b", "type-b", "2.0.0"),
+			"aksapp/type-a/1.0.0.yaml":    testAppConfig,
+			"aksapp/type-b/2.1.0.yaml":    testAppConfig,
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(root)
+	})
+
+	It("Test Run applies version overrides to the cluster configuration", func() {
+		Expect(syncer.Run(context.Background())).To(Succeed())
+
+		ctx := context.Background()
+		_, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "type-b-2.1.0", metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, configmaps.ClusterConfigMapName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+
+		scheme := runtime.NewScheme()
+		_ = deployerv1.AddToScheme(scheme)
+		objs, err := configmaps.ParseConfig(logger, scheme, cm.Data[configmaps.ConfigDataKey])
+		Expect(err).To(BeNil())
+		Expect(objs).To(HaveLen(2))
+		Expect(objs[1].(*deployerv1.AksApp).Spec.Version).To(Equal("2.1.0"))
+	})
+
+	It("Test Run excludes disabled AksApps", func() {
+		syncer.options.Region = "westus"
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		Expect(syncer.lastSnapshot.apps).To(HaveLen(1))
+		Expect(syncer.lastSnapshot.apps[0].Spec.Type).To(Equal("type-a"))
+	})
+
+	It("Test Run fails when toggles cannot be fetched", func() {
+		toggles = ""
+		Expect(syncer.Run(context.Background())).NotTo(Succeed())
+		list, _ := kubeClient.CoreV1().ConfigMaps("test-namespace").List(context.Background(), metav1.ListOptions{})
+		Expect(list.Items).To(BeEmpty())
+	})
+})
@@ -0,0 +1,365 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+)
+
+const (
+	// aksAppChannelsBlobNameFormat is the optional channel index of an aksapp
+	// type, a map of channel names to versions or version constraints
+	aksAppChannelsBlobNameFormat = "%s/channels.yaml"
+)
+
+// versionBound is one comparison of a version constraint
+type versionBound struct {
+	op      string
+	version *utilversion.Version
+}
+
+func (b versionBound) matches(v *utilversion.Version) bool {
+	switch b.op {
+	case ">=":
+		return v.AtLeast(b.version)
+	case ">":
+		return v.AtLeast(b.version) && !b.version.AtLeast(v)
+	case "<=":
+		return b.version.AtLeast(v)
+	case "<":
+		return v.LessThan(b.version)
+	default:
+		return v.AtLeast(b.version) && b.version.AtLeast(v)
+	}
+}
+
+// versionConstraint is a set of bounds a version must all match
+type versionConstraint []versionBound
+
+func (c versionConstraint) matches(v *utilversion.Version) bool {
+	for _, b := range c {
+		if !b.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// isVersionConstraint checks if the version is a constraint, which needs an
+// explicit operator: a ~, ^, >, < or = prefix or a x or * component. Other
+// versions, e.g. 1.4 or 20210101, name a blob.
+func isVersionConstraint(version string) bool {
+	terms := strings.FieldsFunc(version, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	for _, term := range terms {
+		if strings.ContainsAny(term[:1], "~^><=") {
+			return true
+		}
+		for _, part := range strings.Split(term, ".") {
+			if part == "x" || part == "X" || part == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseVersionConstraint parses a version constraint, the terms separated by
+// spaces or commas must all match. Supported terms are:
+//
+//	~1.4     >=1.4.0 <1.5.0, ~1 is >=1.0.0 <2.0.0
+//	^1.4.2   >=1.4.2 <2.0.0, ^0.4.2 is >=0.4.2 <0.5.0
+//	1.4.x    >=1.4.0 <1.5.0, 1.4 and 1.4.* are the same
+//	>=1.4.2  and >, <=, <, =
+func parseVersionConstraint(constraint string) (versionConstraint, error) {
+	terms := strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+
+	var bounds versionConstraint
+	for _, term := range terms {
+		termBounds, err := parseVersionTerm(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %s", constraint, err.Error())
+		}
+		bounds = append(bounds, termBounds...)
+	}
+	return bounds, nil
+}
+
+func parseVersionTerm(term string) ([]versionBound, error) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(term, op) {
+			v, err := utilversion.ParseSemantic(strings.TrimPrefix(term, op))
+			if err != nil {
+				return nil, err
+			}
+			return []versionBound{{op: op, version: v}}, nil
+		}
+	}
+
+	prefix := ""
+	if strings.HasPrefix(term, "~") || strings.HasPrefix(term, "^") {
+		prefix, term = term[:1], term[1:]
+	}
+	components, err := parseVersionComponents(term)
+	if err != nil {
+		return nil, err
+	}
+	for len(components) < 3 && prefix == "^" {
+		components = append(components, 0)
+	}
+
+	lower := make([]uint, 3)
+	copy(lower, components)
+	lowerVersion := semanticVersion(lower)
+
+	// The upper bound increments the last component given, or the first
+	// non-zero one for caret constraints
+	i := len(components) - 1
+	if prefix == "^" {
+		i = 0
+		for i < 2 && components[i] == 0 {
+			i++
+		}
+	} else if prefix == "~" && len(components) == 3 {
+		i = 1
+	} else if len(components) == 3 {
+		return []versionBound{{op: "=", version: lowerVersion}}, nil
+	}
+	upper := make([]uint, 3)
+	copy(upper, components[:i+1])
+	upper[i]++
+
+	return []versionBound{
+		{op: ">=", version: lowerVersion},
+		{op: "<", version: semanticVersion(upper)},
+	}, nil
+}
+
+// parseVersionComponents parses 1, 1.4 or 1.4.2, where trailing x or *
+// components are left out
+func parseVersionComponents(version string) ([]uint, error) {
+	var components []uint
+	wildcard := false
+	for i, part := range strings.Split(version, ".") {
+		if i >= 3 {
+			return nil, fmt.Errorf("too many components in %q", version)
+		}
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = true
+			continue
+		}
+		if wildcard {
+			return nil, fmt.Errorf("unexpected component after a wildcard in %q", version)
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid component %q in %q", part, version)
+		}
+		components = append(components, uint(n))
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("no version in %q", version)
+	}
+	return components, nil
+}
+
+func semanticVersion(components []uint) *utilversion.Version {
+	return utilversion.MustParseSemantic(fmt.Sprintf("%d.%d.%d", components[0], components[1], components[2]))
+}
+
+// listAppVersions returns the versions published for an aksapp type, both
+// <type>/<version>.yaml blobs and <type>/<version>/ folders, by the name of
+// their blobs
+func (s *Syncer) listAppVersions(ctx context.Context, appType string) (map[*utilversion.Version]string, error) {
+	prefix := appType + "/"
+	blobNames, err := s.listBlobs(ctx, aksAppContainerName, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	versions := make(map[*utilversion.Version]string)
+	for _, blobName := range blobNames {
+		name := appVersionName(prefix, blobName)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		// Blobs which are not versions, e.g. the channel index, are skipped
+		if v, err := utilversion.ParseSemantic(name); err == nil {
+			versions[v] = name
+		}
+	}
+	return versions, nil
+}
+
+// appVersionExists checks if a version of an aksapp type is published under
+// exactly this name
+func (s *Syncer) appVersionExists(ctx context.Context, appType, version string) (bool, error) {
+	prefix := appType + "/"
+	blobNames, err := s.listBlobs(ctx, aksAppContainerName, prefix+version)
+	if err != nil {
+		return false, err
+	}
+	for _, blobName := range blobNames {
+		if appVersionName(prefix, blobName) == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// appVersionName returns the version name of a blob of an aksapp type given
+// the prefix <type>/, the blobs of a version folder and the signatures of the
+// blobs belong to the version
+func appVersionName(prefix, blobName string) string {
+	name := strings.TrimPrefix(blobName, prefix)
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(name, signatureSuffix), ".yaml")
+}
+
+// highestMatching returns the highest version matching a constraint, pre-releases
+// are skipped. It returns nil when no version matches.
+func highestMatching(constraint versionConstraint, versions []*utilversion.Version) *utilversion.Version {
+	var resolved *utilversion.Version
+	for _, v := range versions {
+		if v.PreRelease() != "" || !constraint.matches(v) {
+			continue
+		}
+		if resolved == nil || resolved.LessThan(v) {
+			resolved = v
+		}
+	}
+	return resolved
+}
+
+// fetchChannels returns the channel index of an aksapp type, nil when the type has none
+func (s *Syncer) fetchChannels(ctx context.Context, appType string) (map[string]string, error) {
+	blobName := fmt.Sprintf(aksAppChannelsBlobNameFormat, appType)
+	blobNames, err := s.listBlobs(ctx, aksAppContainerName, blobName)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, name := range blobNames {
+		found = found || name == blobName
+	}
+	if !found {
+		return nil, nil
+	}
+
+	content, err := s.getBlob(ctx, aksAppContainerName, blobName)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := parseChannels(content)
+	if err != nil {
+		return nil, &BlobError{ContainerName: aksAppContainerName, BlobName: blobName, Err: err}
+	}
+	return channels, nil
+}
+
+// parseChannels parses a channel index
+func parseChannels(content string) (map[string]string, error) {
+	channels := make(map[string]string)
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(content)), len(content))
+	if err := decoder.Decode(&channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// resolveVersion resolves the version of an aksapp type. A version published
+// under this exact name is returned as is. A channel of the channel index of
+// the type is replaced by its version or constraint. A constraint resolves to
+// the highest published version matching it, pre-releases are only used when
+// named exactly. Other versions are returned as is, they name a blob.
+func (s *Syncer) resolveVersion(ctx context.Context, appType, version string) (string, error) {
+	exists, err := s.appVersionExists(ctx, appType, version)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return version, nil
+	}
+
+	channels, err := s.fetchChannels(ctx, appType)
+	if err != nil {
+		return "", err
+	}
+	if channelVersion, ok := channels[version]; ok {
+		s.logger.Infof("Channel %s of aksapp %s is %s", version, appType, channelVersion)
+		version = channelVersion
+	}
+	if !isVersionConstraint(version) {
+		return version, nil
+	}
+
+	constraint, err := parseVersionConstraint(version)
+	if err != nil {
+		return "", err
+	}
+	versions, err := s.listAppVersions(ctx, appType)
+	if err != nil {
+		return "", err
+	}
+	published := make([]*utilversion.Version, 0, len(versions))
+	for v := range versions {
+		published = append(published, v)
+	}
+	resolved := highestMatching(constraint, published)
+	if resolved == nil {
+		return "", fmt.Errorf("no version of aksapp %s matches %s", appType, version)
+	}
+	return versions[resolved], nil
+}
+
+// resolveVersions replaces the constraints and channels used as AksApp
+// versions with the versions they resolve to. The original constraint is kept
+// in an annotation of the AksApp.
+func (s *Syncer) resolveVersions(ctx context.Context, snap *snapshot) (bool, error) {
+	resolved := make(map[string]string)
+	changed := false
+	for _, app := range snap.apps {
+		constraint := app.Spec.Version
+		key := app.Spec.Type + "/" + constraint
+		version, ok := resolved[key]
+		if !ok {
+			var err error
+			version, err = s.resolveVersion(ctx, app.Spec.Type, constraint)
+			if err != nil {
+				s.logger.Errorf("Failed to resolve version %s of aksapp %s, %s", constraint, app.Spec.Type, err.Error())
+				return false, &BlobError{ContainerName: aksAppContainerName, BlobName: app.Spec.Type + "/", Err: err}
+			}
+			resolved[key] = version
+		}
+		if version == constraint {
+			continue
+		}
+
+		s.logger.Infof("AksApp %s/%s (%s) version %s resolves to %s",
+			app.Namespace, app.Name, app.Spec.Type, constraint, version)
+		if app.Annotations == nil {
+			app.Annotations = make(map[string]string)
+		}
+		app.Annotations[deployerv1.VersionConstraintAnnotationKey] = constraint
+		app.Spec.Version = version
+		changed = true
+	}
+	return changed, nil
+}
@@ -0,0 +1,174 @@
+package syncer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes/fake"
+
+	deployerv1 "github.com/Azure/aks-deployer/pkg/api/v1"
+	"github.com/Azure/aks-deployer/pkg/configmaps"
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test version constraints", func() {
+	matches := func(constraint, version string) bool {
+		c, err := parseVersionConstraint(constraint)
+		Expect(err).To(BeNil())
+		return c.matches(utilversion.MustParseSemantic(version))
+	}
+
+	It("Test parseVersionConstraint", func() {
+		Expect(matches("~1.4", "1.4.0")).To(BeTrue())
+		Expect(matches("~1.4", "1.4.9")).To(BeTrue())
+		Expect(matches("~1.4", "1.5.0")).To(BeFalse())
+		Expect(matches("~1.4.2", "1.4.1")).To(BeFalse())
+		Expect(matches("~1", "1.9.0")).To(BeTrue())
+		Expect(matches("^1.4.2", "1.9.0")).To(BeTrue())
+		Expect(matches("^1.4.2", "2.0.0")).To(BeFalse())
+		Expect(matches("^0.4.2", "0.5.0")).To(BeFalse())
+		Expect(matches("1.4.x", "1.4.3")).To(BeTrue())
+		Expect(matches("1.x", "2.0.0")).To(BeFalse())
+		Expect(matches(">=1.4.2, <1.6.0", "1.5.0")).To(BeTrue())
+		Expect(matches(">1.4.2 <=1.6.0", "1.4.2")).To(BeFalse())
+		Expect(matches(">1.4.2 <=1.6.0", "1.6.0")).To(BeTrue())
+		Expect(matches("1.4.2", "1.4.2")).To(BeTrue())
+	})
+
+	It("Test isVersionConstraint", func() {
+		for _, constraint := range []string{"~1.4", "^1.4.2", "1.4.x", "1.*", ">=1.4.2, <1.6.0", "=1.4.2"} {
+			Expect(isVersionConstraint(constraint)).To(BeTrue(), constraint)
+		}
+		for _, version := range []string{"1.4", "1.4.2", "20210101", "v1.2.3", "latest"} {
+			Expect(isVersionConstraint(version)).To(BeFalse(), version)
+		}
+	})
+
+	It("Test parseVersionConstraint rejects invalid constraints", func() {
+		for _, constraint := range []string{"", "stable", "~a.b", "1.x.2", "1.2.3.4", ">=1.4"} {
+			_, err := parseVersionConstraint(constraint)
+			Expect(err).NotTo(BeNil(), constraint)
+		}
+	})
+})
+
+var _ = Describe("Test Syncer Run with version constraints", func() {
+	var (
+		logger     *logrus.Entry
+		kubeClient *fake.Clientset
+		root       string
+		syncer     *Syncer
+	)
+
+	getApp := func() *deployerv1.AksApp {
+		cm, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(),
+			configmaps.ClusterConfigMapName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		scheme := runtime.NewScheme()
+		_ = deployerv1.AddToScheme(scheme)
+		objs, err := configmaps.ParseConfig(logger, scheme, cm.Data[configmaps.ConfigDataKey])
+		Expect(err).To(BeNil())
+		return objs[0].(*deployerv1.AksApp)
+	}
+
+	BeforeEach(func() {
+		var err error
+		logger = log.New("test-service", "test-version")
+		kubeClient = fake.NewSimpleClientset()
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		syncer = NewSyncerWithConfigSource(kubeClient, NewLocalSource(root, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+
+		writeFiles(root, map[string]string{
+			"aksapp/type-a/1.3.9.yaml":       testAppConfig,
+			"aksapp/type-a/1.4.1.yaml":       testAppConfig,
+			"aksapp/type-a/1.4.10/a.yaml":    testAppConfig,
+			"aksapp/type-a/1.4.11-rc.1.yaml": testAppConfig,
+			"aksapp/type-a/1.5.0.yaml":       testAppConfig,
+			"aksapp/type-a/channels.yaml":    "stable: 1.4.1\ncanary: ~1.5\n",
+		})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Test Run resolves constraints to the highest matching version", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "~1.4"),
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		app := getApp()
+		Expect(app.Spec.Version).To(Equal("1.4.10"))
+		Expect(app.Annotations).To(HaveKeyWithValue(deployerv1.VersionConstraintAnnotationKey, "~1.4"))
+		_, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(), "type-a-1.4.10", metav1.GetOptions{})
+		Expect(err).To(BeNil())
+	})
+
+	It("Test Run resolves channels", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "stable"),
+		})
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		Expect(getApp().Spec.Version).To(Equal("1.4.1"))
+
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "canary"),
+		})
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		app := getApp()
+		Expect(app.Spec.Version).To(Equal("1.5.0"))
+		Expect(app.Annotations).To(HaveKeyWithValue(deployerv1.VersionConstraintAnnotationKey, "canary"))
+	})
+
+	It("Test Run uses versions which are not constraints as blob names", func() {
+		writeFiles(root, map[string]string{
+			"aksapp/type-a/1.4.yaml":      testAppConfig,
+			"aksapp/type-a/20210101.yaml": testAppConfig,
+			"aksapp/type-a/v1.2.3/a.yaml": testAppConfig,
+		})
+
+		for _, version := range []string{"1.4", "20210101", "v1.2.3"} {
+			// Quoted so YAML does not read the version as a number
+			writeFiles(root, map[string]string{
+				"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", `"`+version+`"`),
+			})
+			Expect(syncer.Run(context.Background())).To(Succeed(), version)
+			app := getApp()
+			Expect(app.Spec.Version).To(Equal(version))
+			Expect(app.Annotations).NotTo(HaveKey(deployerv1.VersionConstraintAnnotationKey))
+			_, err := kubeClient.CoreV1().ConfigMaps("test-namespace").Get(context.Background(),
+				"type-a-"+version, metav1.GetOptions{})
+			Expect(err).To(BeNil(), version)
+		}
+	})
+
+	It("Test Run resolves constraints to the name of v-prefixed versions", func() {
+		writeFiles(root, map[string]string{
+			"aksapp/type-a/v1.6.2.yaml":   testAppConfig,
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "~1.6"),
+		})
+
+		Expect(syncer.Run(context.Background())).To(Succeed())
+		Expect(getApp().Spec.Version).To(Equal("v1.6.2"))
+	})
+
+	It("Test Run fails when no version matches", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-a", "type-a", "~2.0"),
+		})
+
+		err := syncer.Run(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("no version of aksapp type-a matches ~2.0"))
+	})
+})
@@ -0,0 +1,184 @@
+package syncer
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	eventTypeSubscriptionValidation = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	eventTypeBlobCreated            = "Microsoft.Storage.BlobCreated"
+	eventTypeBlobDeleted            = "Microsoft.Storage.BlobDeleted"
+
+	// subjects of blob events are /blobServices/default/containers/<container>/blobs/<blob>
+	blobEventSubjectContainers = "/containers/"
+	blobEventSubjectBlobs      = "/blobs/"
+
+	maxEventPayloadSize = 1 << 20
+
+	// webhookTokenQueryKey is the query parameter of the endpoint URL of the
+	// Event Grid subscription carrying the shared secret of the receiver
+	webhookTokenQueryKey = "token"
+)
+
+// event is an Event Grid event, see
+// https://docs.microsoft.com/en-us/azure/event-grid/event-schema
+type event struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"eventType"`
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type subscriptionValidationData struct {
+	ValidationCode string `json:"validationCode"`
+}
+
+type subscriptionValidationResponse struct {
+	ValidationResponse string `json:"validationResponse"`
+}
+
+// EventReceiver receives Event Grid BlobCreated/BlobDeleted notifications of the
+// configuration storage account and triggers a sync when a blob used by the
+// cluster changes. Syncs are debounced: a burst of events, e.g. a release
+// uploading several blobs, triggers one sync the debounce period after its
+// first event, so a steady stream of events does not delay the syncs.
+//
+// Requests must carry the shared secret of the receiver as the token query
+// parameter, set in the endpoint URL of the Event Grid subscription. It can be
+// exercised locally by posting the sample payloads of testdata/eventgrid:
+//
+//	curl -X POST -d @pkg/syncer/testdata/eventgrid/blob-created.json 'http://localhost:8081/?token=<token>'
+type EventReceiver struct {
+	syncer   *Syncer
+	debounce time.Duration
+	token    string
+	triggers chan struct{}
+	logger   *logrus.Entry
+
+	lock  sync.Mutex
+	timer *time.Timer
+}
+
+// NewEventReceiver returns an EventReceiver triggering syncs of syncer for the
+// requests carrying token
+func NewEventReceiver(syncer *Syncer, debounce time.Duration, token string, logger *logrus.Entry) *EventReceiver {
+	return &EventReceiver{
+		syncer:   syncer,
+		debounce: debounce,
+		token:    token,
+		// One pending trigger is enough, the sync reads the latest configuration
+		triggers: make(chan struct{}, 1),
+		logger:   logger,
+	}
+}
+
+// Triggers returns the channel receiving a value when a sync should run
+func (e *EventReceiver) Triggers() <-chan struct{} {
+	return e.triggers
+}
+
+// ServeHTTP handles the events delivered by Event Grid
+func (e *EventReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// An empty token never matches, the receiver refuses every request
+	token := r.URL.Query().Get(webhookTokenQueryKey)
+	if e.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(e.token)) != 1 {
+		e.logger.Warnf("Reject event delivery from %s without a valid token", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var events []event
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventPayloadSize)).Decode(&events); err != nil {
+		e.logger.Warnf("Failed to decode events, %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	relevant := false
+	for _, ev := range events {
+		switch ev.EventType {
+		case eventTypeSubscriptionValidation:
+			var data subscriptionValidationData
+			if err := json.Unmarshal(ev.Data, &data); err != nil || data.ValidationCode == "" {
+				e.logger.Warnf("Invalid subscription validation event %s", ev.ID)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			e.logger.Infof("Validate Event Grid subscription with event %s", ev.ID)
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(subscriptionValidationResponse{
+				ValidationResponse: data.ValidationCode,
+			}); err != nil {
+				e.logger.Errorf("Failed to write subscription validation response, %s", err.Error())
+			}
+			return
+		case eventTypeBlobCreated, eventTypeBlobDeleted:
+			containerName, blobName, ok := parseBlobEventSubject(ev.Subject)
+			if !ok {
+				e.logger.Warnf("Ignore event %s with unexpected subject %s", ev.ID, ev.Subject)
+				continue
+			}
+			if e.syncer.IsBlobRelevant(containerName, blobName) {
+				e.logger.Infof("Received %s event %s of blob %s/%s", ev.EventType, ev.ID, containerName, blobName)
+				relevant = true
+			}
+		default:
+			e.logger.Infof("Ignore event %s of type %s", ev.ID, ev.EventType)
+		}
+	}
+
+	if relevant {
+		e.trigger()
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// trigger schedules a sync after the debounce period, the events received
+// while a sync is scheduled join it
+func (e *EventReceiver) trigger() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.timer != nil {
+		return
+	}
+	e.timer = time.AfterFunc(e.debounce, func() {
+		e.lock.Lock()
+		e.timer = nil
+		e.lock.Unlock()
+
+		select {
+		case e.triggers <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// parseBlobEventSubject returns the container and blob names of a blob event subject
+func parseBlobEventSubject(subject string) (string, string, bool) {
+	i := strings.Index(subject, blobEventSubjectContainers)
+	if i < 0 {
+		return "", "", false
+	}
+	rest := subject[i+len(blobEventSubjectContainers):]
+	j := strings.Index(rest, blobEventSubjectBlobs)
+	if j <= 0 {
+		return "", "", false
+	}
+	blobName := rest[j+len(blobEventSubjectBlobs):]
+	if blobName == "" {
+		return "", "", false
+	}
+	return rest[:j], blobName, true
+}
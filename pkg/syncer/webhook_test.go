@@ -0,0 +1,119 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Azure/aks-deployer/pkg/log"
+)
+
+var _ = Describe("Test EventReceiver", func() {
+	var (
+		root     string
+		syncer   *Syncer
+		receiver *EventReceiver
+	)
+
+	post := func(payload []byte) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		receiver.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/?token=test-token", bytes.NewReader(payload)))
+		return recorder
+	}
+
+	postSample := func(name string) *httptest.ResponseRecorder {
+		payload, err := ioutil.ReadFile(filepath.Join("testdata", "eventgrid", name))
+		Expect(err).To(BeNil())
+		return post(payload)
+	}
+
+	BeforeEach(func() {
+		var err error
+		logger := log.New("test-service", "test-version")
+		root, err = ioutil.TempDir("", "syncer")
+		Expect(err).To(BeNil())
+		syncer = NewSyncerWithConfigSource(fake.NewSimpleClientset(), NewLocalSource(root, logger), "test-cluster", logger)
+		syncer.SetOptions(Options{Namespace: "test-namespace"})
+		receiver = NewEventReceiver(syncer, 50*time.Millisecond, "test-token", logger)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Test subscription validation handshake", func() {
+		recorder := postSample("subscription-validation.json")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+
+		var response subscriptionValidationResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.ValidationResponse).To(Equal("512d38b6-c7b8-40c8-89fe-f46f9e9622b6"))
+		Consistently(receiver.Triggers(), 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("Test debounced trigger on cluster blob events", func() {
+		Expect(postSample("blob-created.json").Code).To(Equal(http.StatusOK))
+		Expect(postSample("blob-created.json").Code).To(Equal(http.StatusOK))
+		Eventually(receiver.Triggers()).Should(Receive())
+		Consistently(receiver.Triggers(), 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("Test a steady stream of events does not delay the trigger", func() {
+		start := time.Now()
+		triggered := false
+		for !triggered && time.Since(start) < time.Second {
+			Expect(postSample("blob-created.json").Code).To(Equal(http.StatusOK))
+			select {
+			case <-receiver.Triggers():
+				triggered = true
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		Expect(triggered).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+	})
+
+	It("Test events of other clusters and apps are ignored", func() {
+		writeFiles(root, map[string]string{
+			"cluster/test-cluster/a.yaml": testClusterConfig("app-b", "type-b", "1.0.0"),
+			"aksapp/type-b/1.0.0.yaml":    testAppConfig,
+		})
+		Expect(syncer.Run(context.Background())).To(Succeed())
+
+		Expect(postSample("blob-deleted.json").Code).To(Equal(http.StatusOK))
+		Expect(post([]byte(`[{"id": "1", "eventType": "Microsoft.Storage.BlobCreated",
+			"subject": "/blobServices/default/containers/cluster/blobs/other-cluster/apps.yaml"}]`)).Code).
+			To(Equal(http.StatusOK))
+		Consistently(receiver.Triggers(), 100*time.Millisecond).ShouldNot(Receive())
+
+		Expect(post([]byte(`[{"id": "2", "eventType": "Microsoft.Storage.BlobCreated",
+			"subject": "/blobServices/default/containers/aksapp/blobs/type-b/1.0.0.yaml"}]`)).Code).
+			To(Equal(http.StatusOK))
+		Eventually(receiver.Triggers()).Should(Receive())
+	})
+
+	It("Test requests without the token are rejected", func() {
+		payload, err := ioutil.ReadFile(filepath.Join("testdata", "eventgrid", "blob-created.json"))
+		Expect(err).To(BeNil())
+		for _, target := range []string{"/", "/?token=", "/?token=other-token"} {
+			recorder := httptest.NewRecorder()
+			receiver.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, bytes.NewReader(payload)))
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized), target)
+		}
+		Consistently(receiver.Triggers(), 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("Test invalid payloads are rejected", func() {
+		Expect(post([]byte("not json")).Code).To(Equal(http.StatusBadRequest))
+	})
+})